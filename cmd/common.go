@@ -1,31 +1,108 @@
 package cmd
 
+import (
+	"fmt"
+	"time"
+)
+
 type DBConfig struct {
-	Project  string
-	Region   string
-	Instance string
-	DB       string
-	User     string
-	Password string
-	Port     string
+	App       string
+	Namespace string
+	Project   string
+	Region    string
+	Instance  string
+	Host      string
+	Port      string
+	DB        string
+	User      string
+	Password  string
 }
 
 type Config struct {
 	*DBConfig
 
-	ExcludeTables   []string
-	IncludeTables   []string
-	ReplicationSlot string
-	Publication     string
-	DataFreshness   int
+	ExcludeTables           []string
+	IncludeTables           []string
+	IncludeColumns          map[string][]string
+	ExcludeColumns          map[string][]string
+	ReplicationSlot         string
+	Publication             string
+	DataFreshness           int
+	Dataset                 string
+	DatasetLocation         string
+	DatasetPerSchema        bool
+	Backend                 string
+	Start                   bool
+	Resume                  bool
+	SkipTableValidation     bool
+	SkipPreflight           bool
+	SkipInstanceCheck       bool
+	TablesWithoutPrimaryKey string
+	AppendOnly              bool
+	Heartbeat               bool
+}
+
+const (
+	Namespace               = "namespace"
+	Context                 = "context"
+	IncludeTables           = "include-tables"
+	ExcludeTables           = "exclude-tables"
+	ReplicationSlotName     = "replication-slot"
+	PublicationName         = "publication-name"
+	DataFreshness           = "dataFreshness"
+	Backend                 = "backend"
+	DryRun                  = "dry-run"
+	PlanDelete              = "delete"
+	Output                  = "output"
+	Start                   = "start"
+	Resume                  = "resume"
+	File                    = "file"
+	DatasetPerSchema        = "dataset-per-schema"
+	IncludeColumns          = "include-columns"
+	ExcludeColumns          = "exclude-columns"
+	DBHost                  = "db-host"
+	DBPort                  = "db-port"
+	SkipTableValidation     = "skip-table-validation"
+	SkipPreflight           = "skip-preflight"
+	SkipInstanceCheck       = "skip-instance-check"
+	DBOwner                 = "db-owner"
+	PrintSQL                = "print-sql"
+	Flyway                  = "flyway"
+	MigrationDir            = "migration-dir"
+	MigrationVersion        = "migration-version"
+	KeepReplication         = "keep-replication"
+	TablesWithoutPrimaryKey = "tables-without-primary-key"
+	MaxLag                  = "max-lag"
+	MaxRetainedWAL          = "max-retained-wal"
+	Heartbeat               = "heartbeat"
+	Interval                = "interval"
+	Instance                = "instance"
+	Database                = "database"
+)
+
+// What to do with selected tables without a primary key, which Datastream
+// can't merge changes to in BigQuery.
+const (
+	WithoutPrimaryKeyWarn       = "warn"
+	WithoutPrimaryKeyExclude    = "exclude"
+	WithoutPrimaryKeyAppendOnly = "append-only"
+)
+
+// CheckTablesWithoutPrimaryKey returns an error unless mode is empty or one of
+// the ways to handle tables without a primary key.
+func CheckTablesWithoutPrimaryKey(mode string) error {
+	switch mode {
+	case "", WithoutPrimaryKeyWarn, WithoutPrimaryKeyExclude, WithoutPrimaryKeyAppendOnly:
+		return nil
+	default:
+		return fmt.Errorf("unknown handling %q of tables without a primary key, should be %v, %v or %v",
+			mode, WithoutPrimaryKeyWarn, WithoutPrimaryKeyExclude, WithoutPrimaryKeyAppendOnly)
+	}
 }
 
 const (
-	Namespace           = "namespace"
-	Context             = "context"
-	IncludeTables       = "include-tables"
-	ExcludeTables       = "exclude-tables"
-	ReplicationSlotName = "replication-slot"
-	PublicationName     = "publication-name"
-	DataFreshness       = "dataFreshness"
+	DefaultPublication       = "ds_publication"
+	DefaultReplicationSlot   = "ds_replication"
+	DefaultDataFreshness     = 900
+	DefaultHeartbeatInterval = 5 * time.Minute
 )
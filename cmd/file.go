@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+)
+
+// StreamFile describes the streams of one or more apps, and is reconciled with
+// the apply command. Both YAML and JSON are accepted.
+type StreamFile struct {
+	Streams []StreamSpec `json:"streams"`
+}
+
+// StreamSpec is the desired configuration of the stream of a single app and
+// database user. Fields left out get the same defaults as the flags of create.
+type StreamSpec struct {
+	App       string `json:"app"`
+	DBUser    string `json:"dbUser"`
+	Namespace string `json:"namespace,omitempty"`
+	Context   string `json:"context,omitempty"`
+	// Instance and Database select the sqlinstance and database when the app has several.
+	Instance string `json:"instance,omitempty"`
+	Database string `json:"database,omitempty"`
+
+	IncludeTables []string `json:"includeTables,omitempty"`
+	ExcludeTables []string `json:"excludeTables,omitempty"`
+	// IncludeColumns and ExcludeColumns select columns by table, e.g. {users: [id, name]}.
+	IncludeColumns  map[string][]string `json:"includeColumns,omitempty"`
+	ExcludeColumns  map[string][]string `json:"excludeColumns,omitempty"`
+	ReplicationSlot string              `json:"replicationSlot,omitempty"`
+	Publication     string              `json:"publication,omitempty"`
+	DataFreshness   int                 `json:"dataFreshness,omitempty"`
+	Dataset         DatasetSpec         `json:"dataset,omitempty"`
+	Start           bool                `json:"start,omitempty"`
+	// TablesWithoutPrimaryKey is either warn, exclude or append-only.
+	TablesWithoutPrimaryKey string `json:"tablesWithoutPrimaryKey,omitempty"`
+	// Heartbeat creates a heartbeat table in the publication as DBOwner,
+	// which defaults to the app name.
+	Heartbeat bool   `json:"heartbeat,omitempty"`
+	DBOwner   string `json:"dbOwner,omitempty"`
+}
+
+// DatasetSpec is the BigQuery dataset the stream writes to.
+type DatasetSpec struct {
+	// Name defaults to datastream_<db>.
+	Name string `json:"name,omitempty"`
+	// Location defaults to the region of the database.
+	Location string `json:"location,omitempty"`
+	// PerSchema writes each schema to its own dataset, named <name>_<schema>.
+	PerSchema bool `json:"perSchema,omitempty"`
+}
+
+// ReadStreamFile reads and validates the stream file at path.
+func ReadStreamFile(path string) (*StreamFile, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &StreamFile{}
+	if err := yaml.UnmarshalStrict(bytes, file); err != nil {
+		return nil, fmt.Errorf("reading %v: %w", path, err)
+	}
+
+	seen := map[string]bool{}
+	for i, s := range file.Streams {
+		if s.App == "" || s.DBUser == "" {
+			return nil, fmt.Errorf("%v: stream %v is missing app or dbUser", path, i)
+		}
+		if err := CheckTablesWithoutPrimaryKey(s.TablesWithoutPrimaryKey); err != nil {
+			return nil, fmt.Errorf("%v: stream for app %v and db user %v: %w", path, s.App, s.DBUser, err)
+		}
+		key := fmt.Sprintf("%v/%v/%v/%v", s.Context, s.Namespace, s.App, s.DBUser)
+		if seen[key] {
+			return nil, fmt.Errorf("%v: stream for app %v and db user %v is listed more than once", path, s.App, s.DBUser)
+		}
+		seen[key] = true
+	}
+
+	return file, nil
+}
+
+// Config returns the config of the stream, using the database config of the app.
+func (s StreamSpec) Config(dbCfg *DBConfig) *Config {
+	cfg := &Config{
+		DBConfig:         dbCfg,
+		IncludeTables:    s.IncludeTables,
+		ExcludeTables:    s.ExcludeTables,
+		IncludeColumns:   s.IncludeColumns,
+		ExcludeColumns:   s.ExcludeColumns,
+		ReplicationSlot:  s.ReplicationSlot,
+		Publication:      s.Publication,
+		DataFreshness:    s.DataFreshness,
+		Dataset:          s.Dataset.Name,
+		DatasetLocation:  s.Dataset.Location,
+		DatasetPerSchema: s.Dataset.PerSchema,
+		Start:            s.Start,
+		Heartbeat:        s.Heartbeat,
+
+		TablesWithoutPrimaryKey: s.TablesWithoutPrimaryKey,
+	}
+	if cfg.ReplicationSlot == "" {
+		cfg.ReplicationSlot = DefaultReplicationSlot
+	}
+	if cfg.Publication == "" {
+		cfg.Publication = DefaultPublication
+	}
+	if cfg.DataFreshness == 0 {
+		cfg.DataFreshness = DefaultDataFreshness
+	}
+
+	return cfg
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadStreamFile(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		content string
+		streams int
+		// err is part of the error reading the file, if it fails
+		err string
+	}{
+		{
+			name: "yaml",
+			content: `streams:
+- app: app
+  dbUser: datastream
+  includeTables: [users, audit.*]
+  includeColumns:
+    users: [id, name]
+  dataset:
+    perSchema: true
+- app: other
+  dbUser: datastream
+  tablesWithoutPrimaryKey: append-only
+`,
+			streams: 2,
+		},
+		{
+			name:    "json",
+			content: `{"streams": [{"app": "app", "dbUser": "datastream", "heartbeat": true}]}`,
+			streams: 1,
+		},
+		{
+			name:    "same app in other namespaces",
+			content: `{"streams": [{"app": "app", "dbUser": "datastream", "namespace": "a"}, {"app": "app", "dbUser": "datastream", "namespace": "b"}]}`,
+			streams: 2,
+		},
+		{
+			name:    "missing db user",
+			content: `{"streams": [{"app": "app"}]}`,
+			err:     "stream 0 is missing app or dbUser",
+		},
+		{
+			name:    "unknown field",
+			content: `{"streams": [{"app": "app", "dbUser": "datastream", "includeTable": ["users"]}]}`,
+			err:     "includeTable",
+		},
+		{
+			name:    "invalid mode for tables without primary key",
+			content: `{"streams": [{"app": "app", "dbUser": "datastream", "tablesWithoutPrimaryKey": "ignore"}]}`,
+			err:     "stream for app app and db user datastream",
+		},
+		{
+			name:    "stream listed twice",
+			content: `{"streams": [{"app": "app", "dbUser": "datastream"}, {"app": "app", "dbUser": "datastream"}]}`,
+			err:     "listed more than once",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "streams.yaml")
+			if err := os.WriteFile(path, []byte(tc.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			file, err := ReadStreamFile(path)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("got error %v, want it to contain %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadStreamFile: %v", err)
+			}
+			if len(file.Streams) != tc.streams {
+				t.Errorf("got %v streams, want %v", len(file.Streams), tc.streams)
+			}
+		})
+	}
+}
+
+func TestReadMissingStreamFile(t *testing.T) {
+	if _, err := ReadStreamFile(filepath.Join(t.TempDir(), "streams.yaml")); !os.IsNotExist(err) {
+		t.Errorf("got error %v, want the file not to exist", err)
+	}
+}
+
+func TestStreamSpecConfig(t *testing.T) {
+	dbCfg := &DBConfig{DB: "mydb"}
+
+	cfg := StreamSpec{App: "app", DBUser: "datastream", Dataset: DatasetSpec{Name: "ds", PerSchema: true}}.Config(dbCfg)
+	if cfg.DBConfig != dbCfg {
+		t.Error("config does not use the database config of the app")
+	}
+	if cfg.ReplicationSlot != DefaultReplicationSlot || cfg.Publication != DefaultPublication || cfg.DataFreshness != DefaultDataFreshness {
+		t.Errorf("got slot %q, publication %q and freshness %v, want the defaults", cfg.ReplicationSlot, cfg.Publication, cfg.DataFreshness)
+	}
+	if cfg.Dataset != "ds" || !cfg.DatasetPerSchema {
+		t.Errorf("got dataset %q per schema %v, want ds per schema", cfg.Dataset, cfg.DatasetPerSchema)
+	}
+
+	cfg = StreamSpec{ReplicationSlot: "slot", Publication: "pub", DataFreshness: 60}.Config(dbCfg)
+	if cfg.ReplicationSlot != "slot" || cfg.Publication != "pub" || cfg.DataFreshness != 60 {
+		t.Errorf("got slot %q, publication %q and freshness %v, want the ones of the spec", cfg.ReplicationSlot, cfg.Publication, cfg.DataFreshness)
+	}
+}
@@ -0,0 +1,126 @@
+package root
+
+import (
+	"context"
+	"fmt"
+
+	dsCmd "github.com/navikt/nada-datastream/cmd"
+	"github.com/navikt/nada-datastream/pkg/datastream"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var apply = &cobra.Command{
+	Use:   "apply -f [file]",
+	Short: "Create or update the datastreams described in a file",
+	Long: `Create or update the datastreams described in a YAML or JSON file.
+
+Streams that don't exist are created, and existing streams are updated to
+match the file. Streams that are not in the file are left alone.
+
+  streams:
+    - app: appnavn
+      dbUser: databasebruker
+      namespace: team
+      context: prod-gcp
+      includeTables: [tabell1, tabell2]
+      dataFreshness: 3600
+      dataset:
+        name: mitt_dataset
+        location: europe-north1
+      start: true
+      heartbeat: true`,
+	PreRunE: bindFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := viper.GetString(dsCmd.File)
+		if path == "" {
+			return fmt.Errorf("missing file, use -f")
+		}
+
+		file, err := dsCmd.ReadStreamFile(path)
+		if err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		log := logrus.New()
+
+		failed := []string{}
+		for _, s := range file.Streams {
+			streamLog := log.WithFields(logrus.Fields{"app": s.App, "dbUser": s.DBUser})
+			if err := applyStream(ctx, s, streamLog); err != nil {
+				streamLog.Error(err)
+				failed = append(failed, fmt.Sprintf("%v/%v", s.App, s.DBUser))
+			}
+		}
+
+		if len(failed) > 0 {
+			return fmt.Errorf("failed to apply %v of %v streams: %v", len(failed), len(file.Streams), failed)
+		}
+		return nil
+	},
+}
+
+func applyStream(ctx context.Context, s dsCmd.StreamSpec, log logrus.FieldLogger) error {
+	namespace := s.Namespace
+	if namespace == "" {
+		namespace = viper.GetString(dsCmd.Namespace)
+	}
+	kubeContext := s.Context
+	if kubeContext == "" {
+		kubeContext = viper.GetString(dsCmd.Context)
+	}
+
+	instance := s.Instance
+	if instance == "" {
+		instance = viper.GetString(dsCmd.Instance)
+	}
+	database := s.Database
+	if database == "" {
+		database = viper.GetString(dsCmd.Database)
+	}
+
+	dbCfg, err := datastream.GetDBConfig(ctx, s.App, s.DBUser, kubeContext, namespace, dbSelection(instance, database), log)
+	if err != nil {
+		return err
+	}
+	setDBAddress(dbCfg)
+	cfg := s.Config(dbCfg)
+	cfg.Backend = viper.GetString(dsCmd.Backend)
+	cfg.SkipTableValidation = viper.GetBool(dsCmd.SkipTableValidation)
+	cfg.Resume = viper.GetBool(dsCmd.Resume)
+	cfg.SkipPreflight = viper.GetBool(dsCmd.SkipPreflight)
+	cfg.SkipInstanceCheck = viper.GetBool(dsCmd.SkipInstanceCheck)
+
+	if viper.GetBool(dsCmd.DryRun) {
+		fmt.Printf("# %v/%v\n", s.App, s.DBUser)
+		if err := printPlan(datastream.PlanApply(ctx, cfg, log)); err != nil {
+			return err
+		}
+		fmt.Println()
+		return nil
+	}
+
+	var owner *dsCmd.DBConfig
+	if cfg.Heartbeat {
+		owner, err = dbOwnerConfig(ctx, s.App, s.DBOwner, kubeContext, namespace, dbCfg, log)
+		if err != nil {
+			return err
+		}
+	}
+
+	return datastream.Apply(ctx, cfg, owner, log)
+}
+
+func init() {
+	apply.PersistentFlags().StringP(dsCmd.File, "f", "", "file describing the datastreams")
+	apply.PersistentFlags().Bool(dsCmd.DryRun, false, "only print what would be created and updated, without changing anything")
+	apply.PersistentFlags().Bool(dsCmd.Resume, false, "continue the create runs that were interrupted, for the streams that have one")
+	apply.PersistentFlags().Bool(dsCmd.SkipPreflight, false, "don't check that the database is ready for datastream before creating a stream")
+	apply.PersistentFlags().Bool(dsCmd.SkipInstanceCheck, false, "don't check that the settings of the Cloud SQL instance allow datastream before creating a stream")
+
+	apply.PersistentFlags().Bool(dsCmd.SkipTableValidation, false, "don't check that the selected tables and columns exist in the databases (table patterns are still resolved)")
+
+	rootCmd.AddCommand(apply)
+}
@@ -3,19 +3,22 @@ package root
 import (
 	"context"
 	"fmt"
+	"os"
 	"strings"
 
 	dsCmd "github.com/navikt/nada-datastream/cmd"
 	"github.com/navikt/nada-datastream/pkg/datastream"
+	"github.com/navikt/nada-datastream/pkg/google"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 var create = &cobra.Command{
-	Use:   "create [app-name] [db-user] [flags]",
-	Short: "Create a new datastream",
-	Long:  `Create a new datastream`,
+	Use:     "create [app-name] [db-user] [flags]",
+	Short:   "Create a new datastream",
+	Long:    `Create a new datastream`,
+	PreRunE: bindFlags,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) != 2 {
 			return fmt.Errorf("Invalid number of arguments.")
@@ -23,46 +26,31 @@ var create = &cobra.Command{
 
 		ctx := context.Background()
 		log := logrus.New()
-		cfg := &dsCmd.Config{
-			Publication:     "ds_publication",
-			ReplicationSlot: "ds_replication",
-		}
-
-		appName := args[0]
-		dbUser := args[1]
-
-		namespace := viper.GetString(dsCmd.Namespace)
-		context := viper.GetString(dsCmd.Context)
 
-		included := viper.GetString(dsCmd.IncludeTables)
-		if included != "" {
-			cfg.IncludeTables = strings.Split(included, ",")
+		cfg, err := streamConfig(ctx, args[0], args[1], log)
+		if err != nil {
+			return err
 		}
 
-		excluded := viper.GetString(dsCmd.ExcludeTables)
-		if excluded != "" {
-			cfg.ExcludeTables = strings.Split(excluded, ",")
-		}
+		cfg.Start = viper.GetBool(dsCmd.Start)
+		cfg.Resume = viper.GetBool(dsCmd.Resume)
+		cfg.SkipPreflight = viper.GetBool(dsCmd.SkipPreflight)
+		cfg.SkipInstanceCheck = viper.GetBool(dsCmd.SkipInstanceCheck)
+		cfg.Heartbeat = viper.GetBool(dsCmd.Heartbeat)
 
-		publication := viper.GetString(dsCmd.PublicationName)
-		if publication != "" {
-			cfg.Publication = publication
-		}
-		replicationSlot := viper.GetString(dsCmd.ReplicationSlotName)
-		if replicationSlot != "" {
-			cfg.ReplicationSlot = replicationSlot
+		if viper.GetBool(dsCmd.DryRun) {
+			return printPlan(datastream.PlanCreate(ctx, cfg, log))
 		}
 
-		dataFreshness := viper.GetInt(dsCmd.DataFreshness)
-		cfg.DataFreshness = dataFreshness
-
-		dbCfg, err := datastream.GetDBConfig(ctx, appName, dbUser, context, namespace, log)
-		if err != nil {
-			return err
+		var owner *dsCmd.DBConfig
+		if cfg.Heartbeat {
+			owner, err = ownerConfig(ctx, args[0], cfg.DBConfig, log)
+			if err != nil {
+				return err
+			}
 		}
-		cfg.DBConfig = dbCfg
 
-		if err := datastream.Create(ctx, cfg, log); err != nil {
+		if err := datastream.Create(ctx, cfg, owner, log); err != nil {
 			return err
 		}
 
@@ -70,17 +58,133 @@ var create = &cobra.Command{
 	},
 }
 
+// bindFlags binds the flags of the command being run to viper. Flags are bound
+// when the command runs rather than in init, since several commands define
+// flags with the same name.
+func bindFlags(cmd *cobra.Command, args []string) error {
+	return viper.BindPFlags(cmd.Flags())
+}
+
+// addStreamFlags adds the flags describing the stream to cmd.
+func addStreamFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().String(dsCmd.IncludeTables, "", "comma separated list of tables in postgres db that should be included in the datastream, as table (in the public schema), schema.table or schema.*")
+	cmd.PersistentFlags().String(dsCmd.ExcludeTables, "", "comma separated list of tables in postgres db that should be excluded from the datastream, as table (in the public schema), schema.table or schema.*")
+	cmd.PersistentFlags().String(dsCmd.ReplicationSlotName, "", "name the of replication slot in database (defaults to 'ds_replication')")
+	cmd.PersistentFlags().String(dsCmd.PublicationName, "", "name the of publication in database (defaults to 'ds_publication')")
+	cmd.PersistentFlags().StringArray(dsCmd.IncludeColumns, nil, "columns to stream for an included table, as table=column1,column2 (repeat the flag for more tables)")
+	cmd.PersistentFlags().StringArray(dsCmd.ExcludeColumns, nil, "columns to leave out of a table, as table=column1,column2 (repeat the flag for more tables)")
+	cmd.PersistentFlags().Bool(dsCmd.DatasetPerSchema, false, "write each postgres schema to its own bigquery dataset instead of a single dataset")
+	cmd.PersistentFlags().Bool(dsCmd.SkipTableValidation, false, "don't check that the selected tables and columns exist in the database (table patterns are still resolved)")
+	cmd.PersistentFlags().String(dsCmd.TablesWithoutPrimaryKey, dsCmd.WithoutPrimaryKeyWarn, "what to do with selected tables without a primary key: 'warn', 'exclude' them, or write the datastream 'append-only'")
+	cmd.PersistentFlags().Int(dsCmd.DataFreshness, dsCmd.DefaultDataFreshness, "data freshness in seconds (how often data is fetched from database and stored in bigquery)")
+}
+
+// streamConfig builds the stream config from the flags bound to viper and the
+// database config of the app.
+func streamConfig(ctx context.Context, appName, dbUser string, log logrus.FieldLogger) (*dsCmd.Config, error) {
+	cfg, err := baseConfig(ctx, appName, dbUser, log)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Publication = dsCmd.DefaultPublication
+	cfg.ReplicationSlot = dsCmd.DefaultReplicationSlot
+
+	included := viper.GetString(dsCmd.IncludeTables)
+	if included != "" {
+		cfg.IncludeTables = strings.Split(included, ",")
+	}
+
+	excluded := viper.GetString(dsCmd.ExcludeTables)
+	if excluded != "" {
+		cfg.ExcludeTables = strings.Split(excluded, ",")
+	}
+
+	cfg.IncludeColumns, err = parseColumns(viper.GetStringSlice(dsCmd.IncludeColumns))
+	if err != nil {
+		return nil, err
+	}
+	cfg.ExcludeColumns, err = parseColumns(viper.GetStringSlice(dsCmd.ExcludeColumns))
+	if err != nil {
+		return nil, err
+	}
+
+	publication := viper.GetString(dsCmd.PublicationName)
+	if publication != "" {
+		cfg.Publication = publication
+	}
+	replicationSlot := viper.GetString(dsCmd.ReplicationSlotName)
+	if replicationSlot != "" {
+		cfg.ReplicationSlot = replicationSlot
+	}
+
+	dataFreshness := viper.GetInt(dsCmd.DataFreshness)
+	cfg.DataFreshness = dataFreshness
+	cfg.DatasetPerSchema = viper.GetBool(dsCmd.DatasetPerSchema)
+	cfg.SkipTableValidation = viper.GetBool(dsCmd.SkipTableValidation)
+	cfg.TablesWithoutPrimaryKey = viper.GetString(dsCmd.TablesWithoutPrimaryKey)
+	if err := dsCmd.CheckTablesWithoutPrimaryKey(cfg.TablesWithoutPrimaryKey); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// parseColumns parses column selections given as table=column1,column2.
+func parseColumns(values []string) (map[string][]string, error) {
+	columns := map[string][]string{}
+	for _, v := range values {
+		table, cols, found := strings.Cut(v, "=")
+		if !found || table == "" || cols == "" {
+			return nil, fmt.Errorf("invalid column selection %q, should be table=column1,column2", v)
+		}
+		columns[table] = append(columns[table], strings.Split(cols, ",")...)
+	}
+
+	return columns, nil
+}
+
+// baseConfig returns a config with the database config of the app and the
+// global flags set.
+func baseConfig(ctx context.Context, appName, dbUser string, log logrus.FieldLogger) (*dsCmd.Config, error) {
+	cfg := &dsCmd.Config{
+		Backend: viper.GetString(dsCmd.Backend),
+	}
+
+	namespace := viper.GetString(dsCmd.Namespace)
+	context := viper.GetString(dsCmd.Context)
+	sel := dbSelection(viper.GetString(dsCmd.Instance), viper.GetString(dsCmd.Database))
+	dbCfg, err := datastream.GetDBConfig(ctx, appName, dbUser, context, namespace, sel, log)
+	if err != nil {
+		return nil, err
+	}
+	setDBAddress(dbCfg)
+	cfg.DBConfig = dbCfg
+
+	return cfg, nil
+}
+
+// setDBAddress sets where the database can be reached from this machine.
+func setDBAddress(dbCfg *dsCmd.DBConfig) {
+	dbCfg.Host = viper.GetString(dsCmd.DBHost)
+	dbCfg.Port = viper.GetString(dsCmd.DBPort)
+}
+
+func printPlan(plan *google.Plan, err error) error {
+	if err != nil {
+		return err
+	}
+	return plan.Write(os.Stdout)
+}
+
 func init() {
-	create.PersistentFlags().String(dsCmd.IncludeTables, "", "comma separated list of tables in postgres db that should be included in the datastream")
-	viper.BindPFlag(dsCmd.IncludeTables, create.PersistentFlags().Lookup(dsCmd.IncludeTables))
-	create.PersistentFlags().String(dsCmd.ExcludeTables, "", "comma separated list of tables in postgres db that should be excluded from the datastream")
-	viper.BindPFlag(dsCmd.ExcludeTables, create.PersistentFlags().Lookup(dsCmd.ExcludeTables))
-	create.PersistentFlags().String(dsCmd.ReplicationSlotName, "", "name the of replication slot in database (defaults to 'ds_replication')")
-	viper.BindPFlag(dsCmd.ReplicationSlotName, create.PersistentFlags().Lookup(dsCmd.ReplicationSlotName))
-	create.PersistentFlags().String(dsCmd.PublicationName, "", "name the of publication in database (defaults to 'ds_publication')")
-	viper.BindPFlag(dsCmd.PublicationName, create.PersistentFlags().Lookup(dsCmd.PublicationName))
-	create.PersistentFlags().Int(dsCmd.DataFreshness, 900, "data freshness in seconds (how often data is fetched from database and stored in bigquery)")
-	viper.BindPFlag(dsCmd.DataFreshness, create.PersistentFlags().Lookup(dsCmd.DataFreshness))
+	addStreamFlags(create)
+	create.PersistentFlags().Bool(dsCmd.DryRun, false, "only print which resources would be created, without creating anything")
+	create.PersistentFlags().Bool(dsCmd.Start, false, "start the datastream after it is created, and wait for it to run")
+	create.PersistentFlags().Bool(dsCmd.Resume, false, "continue a create run that was interrupted")
+	create.PersistentFlags().Bool(dsCmd.Heartbeat, false, "create a heartbeat table in the publication, which the heartbeat command updates to keep the replication slot advancing")
+	create.PersistentFlags().String(dsCmd.DBOwner, "", "database user owning the tables, which the heartbeat table is created as (defaults to the app name)")
+	create.PersistentFlags().Bool(dsCmd.SkipPreflight, false, "don't check that the database is ready for datastream before creating anything")
+	create.PersistentFlags().Bool(dsCmd.SkipInstanceCheck, false, "don't check that the settings of the Cloud SQL instance allow datastream before creating anything")
 
 	rootCmd.AddCommand(create)
 }
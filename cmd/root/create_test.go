@@ -0,0 +1,39 @@
+package root
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseColumns(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		values  []string
+		want    map[string][]string
+		wantErr bool
+	}{
+		{name: "none", want: map[string][]string{}},
+		{name: "table", values: []string{"users=id,name"}, want: map[string][]string{"users": {"id", "name"}}},
+		{name: "schema", values: []string{"audit.log=ip"}, want: map[string][]string{"audit.log": {"ip"}}},
+		{name: "repeated table", values: []string{"users=id", "users=name", "events=*"}, want: map[string][]string{"users": {"id", "name"}, "events": {"*"}}},
+		{name: "without columns", values: []string{"users="}, wantErr: true},
+		{name: "without table", values: []string{"=id"}, wantErr: true},
+		{name: "without separator", values: []string{"users"}, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseColumns(tc.values)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("parseColumns(%q) succeeded with %v", tc.values, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseColumns(%q): %v", tc.values, err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("parseColumns(%q) = %v, want %v", tc.values, got, tc.want)
+			}
+		})
+	}
+}
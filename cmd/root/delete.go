@@ -12,9 +12,10 @@ import (
 )
 
 var delete = &cobra.Command{
-	Use:   "delete [app-name] [db-user]",
-	Short: "Delete a datastream",
-	Long:  `Delete a datastream`,
+	Use:     "delete [app-name] [db-user]",
+	Short:   "Delete a datastream",
+	Long:    `Delete a datastream, and then drop the publication and replication slot from the database unless --keep-replication is given.`,
+	PreRunE: bindFlags,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) != 2 {
 			return fmt.Errorf("Invalid number of arguments.")
@@ -22,20 +23,33 @@ var delete = &cobra.Command{
 
 		ctx := context.Background()
 		log := logrus.New()
-		cfg := &dsCmd.Config{}
 
-		appName := args[0]
-		dbUser := args[1]
-
-		namespace := viper.GetString(dsCmd.Namespace)
-		context := viper.GetString(dsCmd.Context)
-		dbCfg, err := datastream.GetDBConfig(ctx, appName, dbUser, context, namespace, log)
+		cfg, err := baseConfig(ctx, args[0], args[1], log)
 		if err != nil {
 			return err
 		}
-		cfg.DBConfig = dbCfg
 
-		if err := datastream.Delete(ctx, cfg, log); err != nil {
+		keepReplication := viper.GetBool(dsCmd.KeepReplication)
+		if !keepReplication {
+			cfg.Publication = viper.GetString(dsCmd.PublicationName)
+			cfg.ReplicationSlot = viper.GetString(dsCmd.ReplicationSlotName)
+		}
+
+		if viper.GetBool(dsCmd.DryRun) {
+			return printPlan(datastream.PlanDelete(ctx, cfg, keepReplication, log))
+		}
+
+		// with --keep-replication the heartbeat table is kept along with the
+		// slot it keeps advancing, for the next datastream reading from it
+		var owner *dsCmd.DBConfig
+		if !keepReplication {
+			owner, err = ownerConfig(ctx, args[0], cfg.DBConfig, log)
+			if err != nil {
+				return fmt.Errorf("finding the database owner the publication and replication slot are dropped as: %w\nuse --%v to name the owner, or --%v to delete the datastream without dropping them", err, dsCmd.DBOwner, dsCmd.KeepReplication)
+			}
+		}
+
+		if err := datastream.Delete(ctx, cfg, owner, log); err != nil {
 			return err
 		}
 
@@ -44,5 +58,11 @@ var delete = &cobra.Command{
 }
 
 func init() {
+	delete.PersistentFlags().Bool(dsCmd.DryRun, false, "only print which resources would be deleted, without deleting anything")
+	delete.PersistentFlags().Bool(dsCmd.KeepReplication, false, "keep the publication, replication slot and heartbeat table in the database")
+	delete.PersistentFlags().String(dsCmd.DBOwner, "", "database user owning the publication, which it is dropped as (defaults to the app name)")
+	delete.PersistentFlags().String(dsCmd.ReplicationSlotName, "", "name of the replication slot to drop (defaults to the one the datastream uses)")
+	delete.PersistentFlags().String(dsCmd.PublicationName, "", "name of the publication to drop (defaults to the one the datastream uses)")
+
 	rootCmd.AddCommand(delete)
 }
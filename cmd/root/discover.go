@@ -0,0 +1,56 @@
+package root
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	dsCmd "github.com/navikt/nada-datastream/cmd"
+	"github.com/navikt/nada-datastream/pkg/datastream"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var discover = &cobra.Command{
+	Use:     "discover [app-name] [db-user]",
+	Short:   "List the tables datastream can see in the database",
+	Long:    `List the schemas, tables, columns and primary keys datastream can see in the database through the source connection profile, which is set up by create.`,
+	PreRunE: bindFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return fmt.Errorf("Invalid number of arguments.")
+		}
+
+		ctx := context.Background()
+		log := logrus.New()
+
+		cfg, err := baseConfig(ctx, args[0], args[1], log)
+		if err != nil {
+			return err
+		}
+
+		tables, err := datastream.Discover(ctx, cfg, log)
+		if err != nil {
+			return err
+		}
+
+		switch output := viper.GetString(dsCmd.Output); output {
+		case "table":
+			return tables.Write(os.Stdout)
+		case "json":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(tables)
+		default:
+			return fmt.Errorf("unknown output format %q, should be either table or json", output)
+		}
+	},
+}
+
+func init() {
+	discover.PersistentFlags().StringP(dsCmd.Output, "o", "table", "output format, either 'table' or 'json'")
+
+	rootCmd.AddCommand(discover)
+}
@@ -0,0 +1,47 @@
+package root
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	dsCmd "github.com/navikt/nada-datastream/cmd"
+	"github.com/navikt/nada-datastream/pkg/datastream"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var heartbeat = &cobra.Command{
+	Use:   "heartbeat [app-name] [db-user]",
+	Short: "Update the heartbeat table to keep the replication slot advancing",
+	Long: `Update the heartbeat table created by create --heartbeat, so that the replication slot advances on databases that rarely change.
+Runs until it is stopped, updating the table every --interval, or updates it once with --interval=0, e.g. from a cron job.`,
+	PreRunE: bindFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return fmt.Errorf("Invalid number of arguments.")
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		log := logrus.New()
+
+		cfg, err := baseConfig(ctx, args[0], args[1], log)
+		if err != nil {
+			return err
+		}
+		cfg.ReplicationSlot = viper.GetString(dsCmd.ReplicationSlotName)
+
+		return datastream.Heartbeat(ctx, cfg, viper.GetDuration(dsCmd.Interval), log)
+	},
+}
+
+func init() {
+	heartbeat.PersistentFlags().String(dsCmd.ReplicationSlotName, dsCmd.DefaultReplicationSlot, "name of the replication slot the heartbeat table belongs to")
+	heartbeat.PersistentFlags().Duration(dsCmd.Interval, dsCmd.DefaultHeartbeatInterval, "how often to update the heartbeat table, 0 updates it once")
+
+	rootCmd.AddCommand(heartbeat)
+}
@@ -0,0 +1,42 @@
+package root
+
+import (
+	"context"
+	"fmt"
+
+	dsCmd "github.com/navikt/nada-datastream/cmd"
+	"github.com/navikt/nada-datastream/pkg/datastream"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// streamStateCommand returns a command changing the state of the stream with change.
+func streamStateCommand(use, short string, change func(context.Context, *dsCmd.Config, logrus.FieldLogger) error) *cobra.Command {
+	return &cobra.Command{
+		Use:     use + " [app-name] [db-user]",
+		Short:   short,
+		Long:    short,
+		PreRunE: bindFlags,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("Invalid number of arguments.")
+			}
+
+			ctx := context.Background()
+			log := logrus.New()
+
+			cfg, err := baseConfig(ctx, args[0], args[1], log)
+			if err != nil {
+				return err
+			}
+
+			return change(ctx, cfg, log)
+		},
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(streamStateCommand("start", "Start a datastream that has not been started, and wait for it to run", datastream.Start))
+	rootCmd.AddCommand(streamStateCommand("pause", "Pause a running datastream", datastream.Pause))
+	rootCmd.AddCommand(streamStateCommand("resume", "Resume a paused or failed datastream, and wait for it to run", datastream.Resume))
+}
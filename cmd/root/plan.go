@@ -0,0 +1,49 @@
+package root
+
+import (
+	"context"
+	"fmt"
+
+	dsCmd "github.com/navikt/nada-datastream/cmd"
+	"github.com/navikt/nada-datastream/pkg/datastream"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var plan = &cobra.Command{
+	Use:     "plan [app-name] [db-user] [flags]",
+	Short:   "Show what create or delete would do",
+	Long:    `Show which resources create (or delete with --delete) would create, skip or delete, and the stream config that would be sent, without changing anything.`,
+	PreRunE: bindFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return fmt.Errorf("Invalid number of arguments.")
+		}
+
+		ctx := context.Background()
+		log := logrus.New()
+
+		cfg, err := streamConfig(ctx, args[0], args[1], log)
+		if err != nil {
+			return err
+		}
+
+		if viper.GetBool(dsCmd.PlanDelete) {
+			// like delete, drop the publication and replication slot the
+			// datastream reads from unless they are named
+			cfg.Publication = viper.GetString(dsCmd.PublicationName)
+			cfg.ReplicationSlot = viper.GetString(dsCmd.ReplicationSlotName)
+			return printPlan(datastream.PlanDelete(ctx, cfg, false, log))
+		}
+
+		return printPlan(datastream.PlanCreate(ctx, cfg, log))
+	},
+}
+
+func init() {
+	addStreamFlags(plan)
+	plan.PersistentFlags().Bool(dsCmd.PlanDelete, false, "show what delete would do instead of create")
+
+	rootCmd.AddCommand(plan)
+}
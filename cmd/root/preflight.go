@@ -0,0 +1,66 @@
+package root
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	dsCmd "github.com/navikt/nada-datastream/cmd"
+	"github.com/navikt/nada-datastream/pkg/datastream"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var preflight = &cobra.Command{
+	Use:     "preflight [app-name] [db-user] [flags]",
+	Short:   "Check that the database is ready for datastream",
+	Long:    `Check that the database is ready for datastream: logical decoding, the replication role of the users, select grants on the tables, the publication and the replication slot. The database is reached through --db-host and --db-port, e.g. a local cloud-sql-proxy.`,
+	PreRunE: bindFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return fmt.Errorf("Invalid number of arguments.")
+		}
+
+		ctx := context.Background()
+		log := logrus.New()
+
+		cfg, err := streamConfig(ctx, args[0], args[1], log)
+		if err != nil {
+			return err
+		}
+
+		report, err := datastream.Preflight(ctx, cfg, log)
+		if err != nil {
+			return err
+		}
+
+		switch output := viper.GetString(dsCmd.Output); output {
+		case "table":
+			if err := report.Write(os.Stdout); err != nil {
+				return err
+			}
+		case "json":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(report); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown output format %q, should be either table or json", output)
+		}
+
+		if !report.Passed() {
+			return fmt.Errorf("preflight checks failed")
+		}
+		return nil
+	},
+}
+
+func init() {
+	addStreamFlags(preflight)
+	preflight.PersistentFlags().StringP(dsCmd.Output, "o", "table", "output format, either 'table' or 'json'")
+
+	rootCmd.AddCommand(preflight)
+}
@@ -0,0 +1,103 @@
+package root
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	dsCmd "github.com/navikt/nada-datastream/cmd"
+	"github.com/navikt/nada-datastream/pkg/datastream"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var prepareDB = &cobra.Command{
+	Use:   "prepare-db [app-name] [db-user] [flags]",
+	Short: "Prepare the database for datastream",
+	Long: `Give the database user the replication role and access to the tables, and create the publication and replication slot.
+The statements are run as the user the app owns the tables with, or printed as a migration with --print-sql or --flyway.`,
+	PreRunE: bindFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return fmt.Errorf("Invalid number of arguments.")
+		}
+
+		ctx := context.Background()
+		log := logrus.New()
+
+		cfg, err := streamConfig(ctx, args[0], args[1], log)
+		if err != nil {
+			return err
+		}
+
+		owner, err := ownerConfig(ctx, args[0], cfg.DBConfig, log)
+		if err != nil {
+			return err
+		}
+
+		printSQL := viper.GetBool(dsCmd.PrintSQL)
+		flyway := viper.GetBool(dsCmd.Flyway)
+		if !printSQL && !flyway {
+			return datastream.PrepareDB(ctx, cfg, owner, log)
+		}
+
+		migration, err := datastream.Migration(ctx, cfg, owner, log)
+		if err != nil {
+			return err
+		}
+		if printSQL {
+			return migration.WriteSQL(os.Stdout)
+		}
+
+		version := viper.GetString(dsCmd.MigrationVersion)
+		if version == "" {
+			version = time.Now().Format("20060102150405")
+		}
+		paths, err := migration.WriteFlyway(viper.GetString(dsCmd.MigrationDir), version)
+		if err != nil {
+			return err
+		}
+		for _, p := range paths {
+			log.Infof("Wrote migration %v", p)
+		}
+
+		return nil
+	},
+}
+
+// ownerConfig returns the database config of the user given with --db-owner,
+// defaulting to the user named after the app, for the same instance and
+// database as dbCfg.
+func ownerConfig(ctx context.Context, appName string, dbCfg *dsCmd.DBConfig, log logrus.FieldLogger) (*dsCmd.DBConfig, error) {
+	return dbOwnerConfig(ctx, appName, viper.GetString(dsCmd.DBOwner), viper.GetString(dsCmd.Context), viper.GetString(dsCmd.Namespace), dbCfg, log)
+}
+
+// dbOwnerConfig returns the database config of user, or of the user named
+// after the app when user is empty, in the same database as dbCfg.
+func dbOwnerConfig(ctx context.Context, appName, user, kubeContext, namespace string, dbCfg *dsCmd.DBConfig, log logrus.FieldLogger) (*dsCmd.DBConfig, error) {
+	if user == "" {
+		user = appName
+	}
+
+	sel := dbSelection(dbCfg.Instance, dbCfg.DB)
+	owner, err := datastream.GetDBConfig(ctx, appName, user, kubeContext, namespace, sel, log)
+	if err != nil {
+		return nil, err
+	}
+	setDBAddress(owner)
+
+	return owner, nil
+}
+
+func init() {
+	addStreamFlags(prepareDB)
+	prepareDB.PersistentFlags().String(dsCmd.DBOwner, "", "database user owning the tables, which the statements are run as (defaults to the app name)")
+	prepareDB.PersistentFlags().Bool(dsCmd.PrintSQL, false, "print the statements as a sql script instead of running them")
+	prepareDB.PersistentFlags().Bool(dsCmd.Flyway, false, "write the statements as flyway migrations instead of running them")
+	prepareDB.PersistentFlags().String(dsCmd.MigrationDir, ".", "directory to write the flyway migrations to")
+	prepareDB.PersistentFlags().String(dsCmd.MigrationVersion, "", "version of the flyway migrations (defaults to the current time, as yyyyMMddHHmmss)")
+
+	rootCmd.AddCommand(prepareDB)
+}
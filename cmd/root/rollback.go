@@ -0,0 +1,39 @@
+package root
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/navikt/nada-datastream/pkg/datastream"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var rollback = &cobra.Command{
+	Use:   "rollback [app-name] [db-user]",
+	Short: "Delete the resources created by a create run that did not finish",
+	Long: `Delete the resources created by a create run that did not finish.
+
+Every create run keeps a journal of the resources it creates, until it
+succeeds. Resources that existed before the run are left alone.`,
+	PreRunE: bindFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return fmt.Errorf("Invalid number of arguments.")
+		}
+
+		ctx := context.Background()
+		log := logrus.New()
+
+		cfg, err := baseConfig(ctx, args[0], args[1], log)
+		if err != nil {
+			return err
+		}
+
+		return datastream.Rollback(ctx, cfg, log)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rollback)
+}
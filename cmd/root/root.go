@@ -19,6 +19,17 @@ func Execute(ctx context.Context) error {
 	viper.BindPFlag(dsCmd.Namespace, rootCmd.PersistentFlags().Lookup(dsCmd.Namespace))
 	rootCmd.PersistentFlags().StringP(dsCmd.Context, "c", "", "kubernetes context where the app is deployed (defaults to the one defined in kubeconfig)")
 	viper.BindPFlag(dsCmd.Context, rootCmd.PersistentFlags().Lookup(dsCmd.Context))
+	rootCmd.PersistentFlags().String(dsCmd.Backend, "gcloud", "how to talk to google cloud, either 'gcloud' (requires the gcloud cli) or 'api' (uses the google cloud apis directly)")
+	viper.BindPFlag(dsCmd.Backend, rootCmd.PersistentFlags().Lookup(dsCmd.Backend))
+	rootCmd.PersistentFlags().String(dsCmd.DBHost, "localhost", "host where the database can be reached from this machine, e.g. through cloud-sql-proxy")
+	viper.BindPFlag(dsCmd.DBHost, rootCmd.PersistentFlags().Lookup(dsCmd.DBHost))
+	rootCmd.PersistentFlags().String(dsCmd.DBPort, "5432", "port where the database can be reached from this machine")
+	viper.BindPFlag(dsCmd.DBPort, rootCmd.PersistentFlags().Lookup(dsCmd.DBPort))
+
+	rootCmd.PersistentFlags().String(dsCmd.Instance, "", "sqlinstance of the app to use, when it has several (asks when not given)")
+	viper.BindPFlag(dsCmd.Instance, rootCmd.PersistentFlags().Lookup(dsCmd.Instance))
+	rootCmd.PersistentFlags().String(dsCmd.Database, "", "database of the app to use, when it has several (asks when not given)")
+	viper.BindPFlag(dsCmd.Database, rootCmd.PersistentFlags().Lookup(dsCmd.Database))
 
 	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		return err
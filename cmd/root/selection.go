@@ -0,0 +1,60 @@
+package root
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	dsCmd "github.com/navikt/nada-datastream/cmd"
+	"github.com/navikt/nada-datastream/pkg/k8s"
+)
+
+// dbSelection selects the sqlinstance and database given, and asks the user
+// to pick one when the app has several and none is given.
+func dbSelection(instance, database string) k8s.Selection {
+	return k8s.Selection{
+		Instance: instance,
+		Database: database,
+		Choose:   chooseInteractively,
+	}
+}
+
+// chooseInteractively asks the user to pick one of the candidates, and fails
+// with the flag selecting it when there is no terminal to ask in.
+func chooseInteractively(what string, candidates []string) (string, error) {
+	flag := dsCmd.Instance
+	if what == k8s.CandidateDatabase {
+		flag = dsCmd.Database
+	}
+
+	stat, err := os.Stdin.Stat()
+	if err != nil || stat.Mode()&os.ModeCharDevice == 0 {
+		return "", fmt.Errorf("found several %vs: %v, select one with --%v", what, strings.Join(candidates, ", "), flag)
+	}
+
+	fmt.Fprintf(os.Stderr, "Found several %vs:\n", what)
+	for i, c := range candidates {
+		fmt.Fprintf(os.Stderr, "  %v) %v\n", i+1, c)
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Fprintf(os.Stderr, "Select %v [1-%v]: ", what, len(candidates))
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("selecting %v: %w", what, err)
+		}
+
+		answer := strings.TrimSpace(line)
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(candidates) {
+			return candidates[n-1], nil
+		}
+		for _, c := range candidates {
+			if c == answer {
+				return c, nil
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package root
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	dsCmd "github.com/navikt/nada-datastream/cmd"
+	"github.com/navikt/nada-datastream/pkg/datastream"
+	"github.com/navikt/nada-datastream/pkg/postgres"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var slotStatus = &cobra.Command{
+	Use:   "slot-status [app-name] [db-user]",
+	Short: "Show how far the replication slot is behind the database",
+	Long: `Show whether the replication slot is in use, how far the position confirmed by datastream is behind the database, and how much WAL the database keeps for the slot.
+With --max-lag or --max-retained-wal the command fails when the slot is further behind, e.g. to alert from a cron job.`,
+	PreRunE: bindFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return fmt.Errorf("Invalid number of arguments.")
+		}
+
+		maxLag, err := parseBytes(viper.GetString(dsCmd.MaxLag))
+		if err != nil {
+			return err
+		}
+		maxRetained, err := parseBytes(viper.GetString(dsCmd.MaxRetainedWAL))
+		if err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		log := logrus.New()
+
+		cfg, err := baseConfig(ctx, args[0], args[1], log)
+		if err != nil {
+			return err
+		}
+		cfg.ReplicationSlot = viper.GetString(dsCmd.ReplicationSlotName)
+
+		status, err := datastream.SlotStatus(ctx, cfg, log)
+		if err != nil {
+			return err
+		}
+
+		switch output := viper.GetString(dsCmd.Output); output {
+		case "table":
+			err = status.Write(os.Stdout)
+		case "json":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(status)
+		default:
+			return fmt.Errorf("unknown output format %q, should be either table or json", output)
+		}
+		if err != nil {
+			return err
+		}
+
+		if maxLag > 0 && status.LagBytes > maxLag {
+			return fmt.Errorf("replication slot %v lags %v behind the database, more than %v", status.Name, postgres.FormatBytes(status.LagBytes), postgres.FormatBytes(maxLag))
+		}
+		if maxRetained > 0 && status.RetainedWALBytes > maxRetained {
+			return fmt.Errorf("replication slot %v retains %v of WAL, more than %v", status.Name, postgres.FormatBytes(status.RetainedWALBytes), postgres.FormatBytes(maxRetained))
+		}
+		return nil
+	},
+}
+
+// parseBytes parses a size such as 512MB or 10GB, in units of 1024. An empty
+// size is 0.
+func parseBytes(size string) (int64, error) {
+	size = strings.TrimSpace(size)
+	if size == "" {
+		return 0, nil
+	}
+
+	multipliers := []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"TB", 1 << 40},
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	}
+	upper := strings.ToUpper(size)
+	for _, m := range multipliers {
+		if number, found := strings.CutSuffix(upper, m.suffix); found {
+			value, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+			if err != nil || value < 0 {
+				return 0, fmt.Errorf("invalid size %q, should be e.g. 512MB or 10GB", size)
+			}
+			return int64(value * float64(m.multiplier)), nil
+		}
+	}
+
+	value, err := strconv.ParseInt(upper, 10, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size %q, should be e.g. 512MB or 10GB", size)
+	}
+	return value, nil
+}
+
+func init() {
+	slotStatus.PersistentFlags().String(dsCmd.ReplicationSlotName, dsCmd.DefaultReplicationSlot, "name of the replication slot")
+	slotStatus.PersistentFlags().String(dsCmd.MaxLag, "", "fail when the slot lags more than this behind the database, e.g. 1GB")
+	slotStatus.PersistentFlags().String(dsCmd.MaxRetainedWAL, "", "fail when the database keeps more WAL than this for the slot, e.g. 10GB")
+	slotStatus.PersistentFlags().StringP(dsCmd.Output, "o", "table", "output format, either 'table' or 'json'")
+
+	rootCmd.AddCommand(slotStatus)
+}
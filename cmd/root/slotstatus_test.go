@@ -0,0 +1,40 @@
+package root
+
+import "testing"
+
+func TestParseBytes(t *testing.T) {
+	for _, tc := range []struct {
+		size    string
+		want    int64
+		wantErr bool
+	}{
+		{size: "", want: 0},
+		{size: "512", want: 512},
+		{size: "100B", want: 100},
+		{size: "2KB", want: 2 << 10},
+		{size: "512MB", want: 512 << 20},
+		{size: " 10 GB ", want: 10 << 30},
+		{size: "1.5gb", want: 3 << 29},
+		{size: "1TB", want: 1 << 40},
+		{size: "GB", wantErr: true},
+		{size: "-1GB", wantErr: true},
+		{size: "-1", wantErr: true},
+		{size: "10 GiB", wantErr: true},
+		{size: "ten", wantErr: true},
+	} {
+		got, err := parseBytes(tc.size)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("parseBytes(%q) = %v, want an error", tc.size, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseBytes(%q): %v", tc.size, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("parseBytes(%q) = %v, want %v", tc.size, got, tc.want)
+		}
+	}
+}
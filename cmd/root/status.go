@@ -0,0 +1,56 @@
+package root
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	dsCmd "github.com/navikt/nada-datastream/cmd"
+	"github.com/navikt/nada-datastream/pkg/datastream"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var status = &cobra.Command{
+	Use:     "status [app-name] [db-user]",
+	Short:   "Show the status of a datastream",
+	Long:    `Show whether each resource of a datastream exists, and the state of the proxy VM, private connection and stream.`,
+	PreRunE: bindFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return fmt.Errorf("Invalid number of arguments.")
+		}
+
+		ctx := context.Background()
+		log := logrus.New()
+
+		cfg, err := baseConfig(ctx, args[0], args[1], log)
+		if err != nil {
+			return err
+		}
+
+		resources, err := datastream.Status(ctx, cfg, log)
+		if err != nil {
+			return err
+		}
+
+		switch output := viper.GetString(dsCmd.Output); output {
+		case "table":
+			return resources.Write(os.Stdout)
+		case "json":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(resources)
+		default:
+			return fmt.Errorf("unknown output format %q, should be either table or json", output)
+		}
+	},
+}
+
+func init() {
+	status.PersistentFlags().StringP(dsCmd.Output, "o", "table", "output format, either 'table' or 'json'")
+
+	rootCmd.AddCommand(status)
+}
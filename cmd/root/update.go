@@ -0,0 +1,54 @@
+package root
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	dsCmd "github.com/navikt/nada-datastream/cmd"
+	"github.com/navikt/nada-datastream/pkg/datastream"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var update = &cobra.Command{
+	Use:   "update [app-name] [db-user] [flags]",
+	Short: "Update the tables and data freshness of an existing datastream",
+	Long: `Update the tables and data freshness of an existing datastream.
+
+The flags describe the complete desired configuration of the stream, the same
+way as for create. Only the fields that differ from the running stream are
+changed, and tables that are added to the stream are backfilled.`,
+	PreRunE: bindFlags,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return fmt.Errorf("Invalid number of arguments.")
+		}
+
+		ctx := context.Background()
+		log := logrus.New()
+
+		cfg, err := streamConfig(ctx, args[0], args[1], log)
+		if err != nil {
+			return err
+		}
+
+		if viper.GetBool(dsCmd.DryRun) {
+			update, err := datastream.PlanUpdate(ctx, cfg, log)
+			if err != nil {
+				return err
+			}
+			return update.Write(os.Stdout)
+		}
+
+		return datastream.Update(ctx, cfg, log)
+	},
+}
+
+func init() {
+	addStreamFlags(update)
+	update.PersistentFlags().Bool(dsCmd.DryRun, false, "only print which fields would be updated and which tables would be backfilled")
+
+	rootCmd.AddCommand(update)
+}
@@ -2,6 +2,7 @@ package datastream
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/navikt/nada-datastream/cmd"
 	"github.com/navikt/nada-datastream/pkg/google"
@@ -9,24 +10,234 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-func GetDBConfig(ctx context.Context, appName, dbUser, context, namespace string, log *logrus.Logger) (*cmd.DBConfig, error) {
+func GetDBConfig(ctx context.Context, appName, dbUser, context, namespace string, sel k8s.Selection, log logrus.FieldLogger) (*cmd.DBConfig, error) {
 	log.Info("Retrieving datastream configurations...")
 	k8sClient, err := k8s.New(context, namespace)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	cfg, err := k8sClient.DBConfig(ctx, appName, dbUser)
+	cfg, err := k8sClient.DBConfig(ctx, appName, dbUser, sel)
 	if err != nil {
 		return nil, err
 	}
 	return &cfg, nil
 }
 
-func Create(ctx context.Context, cfg *cmd.Config, log *logrus.Logger) error {
-	return google.New(log.WithFields(logrus.Fields{}), cfg).CreateResources(ctx)
+// Create creates the datastream and the resources it needs. With heartbeat
+// mode, the heartbeat table is created in the database as owner.
+func Create(ctx context.Context, cfg *cmd.Config, owner *cmd.DBConfig, log logrus.FieldLogger) error {
+	g, err := google.New(ctx, log.WithFields(logrus.Fields{}), cfg)
+	if err != nil {
+		return err
+	}
+	if err := prepareCreate(ctx, g, cfg, owner, log); err != nil {
+		return err
+	}
+	return g.CreateResources(ctx)
+}
+
+// prepareCreate checks that the Cloud SQL instance and the database are ready
+// for a new datastream and resolves the tables it reads from, for both create
+// and apply. The heartbeat table is created last, so that nothing is changed
+// in the database when a check fails.
+func prepareCreate(ctx context.Context, g *google.Google, cfg *cmd.Config, owner *cmd.DBConfig, log logrus.FieldLogger) error {
+	if !cfg.SkipInstanceCheck {
+		if err := g.CheckSQLInstance(ctx); err != nil {
+			return err
+		}
+	}
+	if err := prepareTables(ctx, g, cfg, log); err != nil {
+		return err
+	}
+	if err := preflight(ctx, cfg, log); err != nil {
+		return err
+	}
+	if cfg.Heartbeat {
+		return createHeartbeat(ctx, cfg, owner, log)
+	}
+	return nil
+}
+
+// Delete deletes the datastream and the resources no other datastream uses.
+// Unless owner is nil, the publication and replication slot are dropped from
+// the database afterwards, connecting as owner. The database is cleaned up
+// last, so that the datastream is deleted even when the database can't be
+// reached. With owner nil, the heartbeat table is kept too, since it belongs
+// to the replication slot and keeps it advancing for the next datastream
+// reading from it.
+func Delete(ctx context.Context, cfg *cmd.Config, owner *cmd.DBConfig, log logrus.FieldLogger) error {
+	g, err := google.New(ctx, log.WithFields(logrus.Fields{}), cfg)
+	if err != nil {
+		return err
+	}
+	if owner == nil {
+		return g.DeleteResources(ctx)
+	}
+
+	if err := replicationNames(ctx, g, cfg); err != nil {
+		return err
+	}
+	if err := g.DeleteResources(ctx); err != nil {
+		return err
+	}
+	if err := dropReplication(ctx, cfg, owner, log); err != nil {
+		return fmt.Errorf("the datastream is deleted, but cleaning up database %v failed: %w\nuse --%v to delete datastreams without dropping the publication and replication slot", cfg.DB, err, cmd.KeepReplication)
+	}
+	return nil
+}
+
+// PlanCreate returns what Create would do. With heartbeat mode, the stream
+// reads from the heartbeat table Create would create.
+func PlanCreate(ctx context.Context, cfg *cmd.Config, log logrus.FieldLogger) (*google.Plan, error) {
+	g, err := google.New(ctx, log.WithFields(logrus.Fields{}), cfg)
+	if err != nil {
+		return nil, err
+	}
+	return planCreate(ctx, g, cfg, log)
+}
+
+func planCreate(ctx context.Context, g *google.Google, cfg *cmd.Config, log logrus.FieldLogger) (*google.Plan, error) {
+	if err := prepareTables(ctx, g, cfg, log); err != nil {
+		return nil, err
+	}
+	if cfg.Heartbeat {
+		includeHeartbeat(cfg)
+	}
+	return g.PlanCreate(ctx)
+}
+
+// PlanDelete returns what Delete would do. Unless keepReplication is set, the
+// publication, replication slot and heartbeat table Delete would drop from the
+// database are listed too, without connecting to the database.
+func PlanDelete(ctx context.Context, cfg *cmd.Config, keepReplication bool, log logrus.FieldLogger) (*google.Plan, error) {
+	g, err := google.New(ctx, log.WithFields(logrus.Fields{}), cfg)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := g.PlanDelete(ctx)
+	if err != nil || keepReplication {
+		return plan, err
+	}
+
+	if err := replicationNames(ctx, g, cfg); err != nil {
+		return nil, err
+	}
+	planDropReplication(plan, cfg)
+	return plan, nil
+}
+
+func Status(ctx context.Context, cfg *cmd.Config, log logrus.FieldLogger) (*google.Status, error) {
+	g, err := google.New(ctx, log.WithFields(logrus.Fields{}), cfg)
+	if err != nil {
+		return nil, err
+	}
+	return g.Status(ctx)
+}
+
+func Start(ctx context.Context, cfg *cmd.Config, log logrus.FieldLogger) error {
+	g, err := google.New(ctx, log.WithFields(logrus.Fields{}), cfg)
+	if err != nil {
+		return err
+	}
+	return g.StartStream(ctx)
 }
 
-func Delete(ctx context.Context, cfg *cmd.Config, log *logrus.Logger) error {
-	return google.New(log.WithFields(logrus.Fields{}), cfg).DeleteResources(ctx)
+func Pause(ctx context.Context, cfg *cmd.Config, log logrus.FieldLogger) error {
+	g, err := google.New(ctx, log.WithFields(logrus.Fields{}), cfg)
+	if err != nil {
+		return err
+	}
+	return g.PauseStream(ctx)
+}
+
+func Resume(ctx context.Context, cfg *cmd.Config, log logrus.FieldLogger) error {
+	g, err := google.New(ctx, log.WithFields(logrus.Fields{}), cfg)
+	if err != nil {
+		return err
+	}
+	return g.ResumeStream(ctx)
+}
+
+func Update(ctx context.Context, cfg *cmd.Config, log logrus.FieldLogger) error {
+	g, err := google.New(ctx, log.WithFields(logrus.Fields{}), cfg)
+	if err != nil {
+		return err
+	}
+	if err := prepareTables(ctx, g, cfg, log); err != nil {
+		return err
+	}
+	return g.UpdateStream(ctx)
+}
+
+func PlanUpdate(ctx context.Context, cfg *cmd.Config, log logrus.FieldLogger) (*google.StreamUpdate, error) {
+	g, err := google.New(ctx, log.WithFields(logrus.Fields{}), cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := prepareTables(ctx, g, cfg, log); err != nil {
+		return nil, err
+	}
+	return g.PlanStreamUpdate(ctx)
+}
+
+func Rollback(ctx context.Context, cfg *cmd.Config, log logrus.FieldLogger) error {
+	g, err := google.New(ctx, log.WithFields(logrus.Fields{}), cfg)
+	if err != nil {
+		return err
+	}
+	return g.Rollback(ctx)
+}
+
+// Apply creates or updates the datastream to match cfg. A datastream that
+// does not exist is checked the same way as with Create before it is created.
+// With heartbeat mode, the heartbeat table is created in the database as
+// owner, also for an existing datastream.
+func Apply(ctx context.Context, cfg *cmd.Config, owner *cmd.DBConfig, log logrus.FieldLogger) error {
+	g, err := google.New(ctx, log.WithFields(logrus.Fields{}), cfg)
+	if err != nil {
+		return err
+	}
+	exists, err := g.StreamExists(ctx)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err := prepareCreate(ctx, g, cfg, owner, log); err != nil {
+			return err
+		}
+		return g.Apply(ctx)
+	}
+
+	if err := prepareTables(ctx, g, cfg, log); err != nil {
+		return err
+	}
+	if cfg.Heartbeat {
+		if err := createHeartbeat(ctx, cfg, owner, log); err != nil {
+			return err
+		}
+	}
+	return g.Apply(ctx)
+}
+
+func PlanApply(ctx context.Context, cfg *cmd.Config, log logrus.FieldLogger) (*google.Plan, error) {
+	g, err := google.New(ctx, log.WithFields(logrus.Fields{}), cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := prepareTables(ctx, g, cfg, log); err != nil {
+		return nil, err
+	}
+	if cfg.Heartbeat {
+		includeHeartbeat(cfg)
+	}
+	return g.PlanApply(ctx)
+}
+
+func Discover(ctx context.Context, cfg *cmd.Config, log logrus.FieldLogger) (*google.Discovery, error) {
+	g, err := google.New(ctx, log.WithFields(logrus.Fields{}), cfg)
+	if err != nil {
+		return nil, err
+	}
+	return g.Discover(ctx)
 }
@@ -0,0 +1,58 @@
+package datastream
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/navikt/nada-datastream/cmd"
+	"github.com/navikt/nada-datastream/pkg/google"
+	"github.com/navikt/nada-datastream/pkg/postgres"
+	"github.com/sirupsen/logrus"
+)
+
+// emptyProject answers every gcloud command as if the project had none of the
+// resources listed.
+type emptyProject struct{}
+
+func (emptyProject) Execute(ctx context.Context, args []string) ([]byte, error) {
+	return []byte("[]"), nil
+}
+
+func TestPlanCreateIncludesHeartbeatTable(t *testing.T) {
+	heartbeat := postgres.HeartbeatTableName(cmd.DefaultReplicationSlot)
+	_, heartbeatName := google.SplitTableName(heartbeat)
+
+	for _, withHeartbeat := range []bool{true, false} {
+		cfg := &cmd.Config{
+			DBConfig:            &cmd.DBConfig{Project: "test-project", Region: "europe-north1", Instance: "app-instance", DB: "mydb", User: "datastream"},
+			IncludeTables:       []string{"users"},
+			Publication:         cmd.DefaultPublication,
+			ReplicationSlot:     cmd.DefaultReplicationSlot,
+			DatasetPerSchema:    true,
+			SkipTableValidation: true,
+			Heartbeat:           withHeartbeat,
+		}
+		log := logrus.New()
+		log.SetOutput(io.Discard)
+		g := google.NewWithExecutor(logrus.NewEntry(log), cfg, emptyProject{})
+
+		plan, err := planCreate(context.Background(), g, cfg, log)
+		if err != nil {
+			t.Fatalf("planCreate: %v", err)
+		}
+		if plan.Stream == nil {
+			t.Fatal("plan does not create the stream")
+		}
+
+		streamed := []string{}
+		for _, s := range plan.Stream.SourceConfig.PostgresqlSourceConfig.IncludeObjects.PostgresqlSchemas {
+			for _, table := range s.PostgresqlTables {
+				streamed = append(streamed, table.Table)
+			}
+		}
+		if got := contains(streamed, heartbeatName); got != withHeartbeat {
+			t.Errorf("with heartbeat %v: stream reads from %v, want heartbeat table included %v", withHeartbeat, streamed, withHeartbeat)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package datastream
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/navikt/nada-datastream/cmd"
+	"github.com/navikt/nada-datastream/pkg/google"
+	"github.com/navikt/nada-datastream/pkg/postgres"
+	"github.com/sirupsen/logrus"
+)
+
+// createHeartbeat creates the heartbeat table of the replication slot of cfg
+// as owner, and includes it in the datastream.
+func createHeartbeat(ctx context.Context, cfg *cmd.Config, owner *cmd.DBConfig, log logrus.FieldLogger) error {
+	client, err := postgres.New(ctx, owner)
+	if err != nil {
+		return err
+	}
+	defer client.Close(ctx)
+
+	table := postgres.HeartbeatTableName(cfg.ReplicationSlot)
+	log.Infof("Creating heartbeat table %v...", table)
+	if err := client.CreateHeartbeat(ctx, cfg.ReplicationSlot, cfg.Publication, cfg.User); err != nil {
+		return err
+	}
+
+	includeHeartbeat(cfg)
+	return nil
+}
+
+// includeHeartbeat adds the heartbeat table of the replication slot of cfg to
+// the included tables, unless all tables are included.
+func includeHeartbeat(cfg *cmd.Config) {
+	table := postgres.HeartbeatTableName(cfg.ReplicationSlot)
+	schema, name := google.SplitTableName(table)
+	if len(cfg.IncludeTables) > 0 && !isSelected(cfg, schema, name) {
+		cfg.IncludeTables = append(cfg.IncludeTables, table)
+	}
+}
+
+// maxHeartbeatFailures is how many updates in a row may fail before Heartbeat
+// gives up.
+const maxHeartbeatFailures = 5
+
+// Heartbeat updates the heartbeat table of the replication slot of cfg every
+// interval until ctx is done, or once when interval is 0. Failed updates are
+// logged and retried at the next interval, until maxHeartbeatFailures updates
+// in a row have failed or the database returns an error retrying won't fix.
+func Heartbeat(ctx context.Context, cfg *cmd.Config, interval time.Duration, log logrus.FieldLogger) error {
+	update := func(ctx context.Context) error { return beat(ctx, cfg, log) }
+	if interval == 0 {
+		return update(ctx)
+	}
+
+	log.Infof("Updating heartbeat table %v every %v", postgres.HeartbeatTableName(cfg.ReplicationSlot), interval)
+	return heartbeatLoop(ctx, interval, update, log)
+}
+
+func heartbeatLoop(ctx context.Context, interval time.Duration, update func(context.Context) error, log logrus.FieldLogger) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	failures := 0
+	for {
+		err := update(ctx)
+		switch {
+		case err == nil:
+			failures = 0
+		case ctx.Err() != nil:
+		case postgres.IsPermanent(err):
+			return err
+		default:
+			failures++
+			if failures >= maxHeartbeatFailures {
+				return fmt.Errorf("giving up after %v failed heartbeats in a row: %w", failures, err)
+			}
+			log.Errorf("Heartbeat failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func beat(ctx context.Context, cfg *cmd.Config, log logrus.FieldLogger) error {
+	client, err := postgres.New(ctx, cfg.DBConfig)
+	if err != nil {
+		return err
+	}
+	defer client.Close(ctx)
+
+	if err := client.Beat(ctx, cfg.ReplicationSlot); err != nil {
+		return err
+	}
+	log.Debugf("Updated heartbeat table %v", postgres.HeartbeatTableName(cfg.ReplicationSlot))
+	return nil
+}
@@ -0,0 +1,72 @@
+package datastream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestHeartbeatLoop(t *testing.T) {
+	transient := errors.New("connection refused")
+	for _, tc := range []struct {
+		name string
+		// errs are the results of the updates in order, after which the
+		// updates succeed
+		errs      []error
+		wantCalls int
+		wantErr   bool
+	}{
+		{
+			name:      "transient failures below the limit",
+			errs:      []error{transient, transient, nil, transient, transient, transient, transient},
+			wantCalls: 10,
+		},
+		{
+			name:      "transient failures in a row",
+			errs:      []error{transient, transient, transient, transient, transient},
+			wantCalls: maxHeartbeatFailures,
+			wantErr:   true,
+		},
+		{
+			name:      "missing heartbeat table",
+			errs:      []error{nil, fmt.Errorf("updating heartbeat table: %w", &pgconn.PgError{Code: "42P01"})},
+			wantCalls: 2,
+			wantErr:   true,
+		},
+		{
+			name:      "failed authentication",
+			errs:      []error{transient, fmt.Errorf("connecting to database: %w", &pgconn.PgError{Code: "28P01"})},
+			wantCalls: 2,
+			wantErr:   true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			calls := 0
+			update := func(ctx context.Context) error {
+				calls++
+				if calls == 10 {
+					cancel()
+				}
+				if calls <= len(tc.errs) {
+					return tc.errs[calls-1]
+				}
+				return nil
+			}
+
+			err := heartbeatLoop(ctx, time.Millisecond, update, discardLog())
+			if (err != nil) != tc.wantErr {
+				t.Errorf("heartbeatLoop returned %v, want error %v", err, tc.wantErr)
+			}
+			if calls != tc.wantCalls {
+				t.Errorf("updated %v times, want %v", calls, tc.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package datastream
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/navikt/nada-datastream/pkg/google"
+)
+
+// isPattern reports whether a table name given by the user is a pattern to be
+// resolved against the tables in the database, rather than the name of a
+// table. Names are regular expressions if they are wrapped in slashes or start
+// with ^, and globs if they contain *, ? or [. A table name of just * selects
+// a whole schema and is not a pattern. Postgres identifiers may contain $, so
+// $ alone does not make a name a pattern.
+func isPattern(name string) bool {
+	if isRegexp(name) {
+		return true
+	}
+	_, table := google.SplitTableName(name)
+	return table != google.AllTables && strings.ContainsAny(name, "*?[")
+}
+
+func isRegexp(name string) bool {
+	return (len(name) > 1 && strings.HasPrefix(name, "/") && strings.HasSuffix(name, "/")) ||
+		strings.HasPrefix(name, "^")
+}
+
+// matchPattern returns the tables, given as schema.table, matching pattern.
+// Regular expressions match if they match either the table name or
+// schema.table. Globs are matched against the table in the public schema, or
+// as schema.table if they contain a dot.
+func matchPattern(pattern string, tables []string) ([]string, error) {
+	matches := []string{}
+
+	if isRegexp(pattern) {
+		expr := strings.TrimSuffix(strings.TrimPrefix(pattern, "/"), "/")
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid table pattern %q: %w", pattern, err)
+		}
+		for _, t := range tables {
+			_, table := google.SplitTableName(t)
+			if re.MatchString(table) || re.MatchString(t) {
+				matches = append(matches, t)
+			}
+		}
+		return matches, nil
+	}
+
+	schemaPattern, tablePattern := google.SplitTableName(pattern)
+	for _, t := range tables {
+		schema, table := google.SplitTableName(t)
+		schemaMatch, err := path.Match(schemaPattern, schema)
+		if err != nil {
+			return nil, fmt.Errorf("invalid table pattern %q: %w", pattern, err)
+		}
+		tableMatch, err := path.Match(tablePattern, table)
+		if err != nil {
+			return nil, fmt.Errorf("invalid table pattern %q: %w", pattern, err)
+		}
+		if schemaMatch && tableMatch {
+			matches = append(matches, t)
+		}
+	}
+	return matches, nil
+}
+
+// expandPatterns replaces the patterns in names with the tables they match,
+// given as schema.table. It returns the tables each pattern matched.
+func expandPatterns(names, tables []string) ([]string, map[string][]string, error) {
+	sorted := append([]string{}, tables...)
+	sort.Strings(sorted)
+
+	expanded := []string{}
+	matched := map[string][]string{}
+	for _, n := range names {
+		n = strings.TrimSpace(n)
+		if !isPattern(n) {
+			if !contains(expanded, n) {
+				expanded = append(expanded, n)
+			}
+			continue
+		}
+
+		matches, err := matchPattern(n, sorted)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(matches) == 0 {
+			return nil, nil, fmt.Errorf("table pattern %q does not match any tables", n)
+		}
+		matched[n] = matches
+		for _, m := range matches {
+			if !contains(expanded, m) {
+				expanded = append(expanded, m)
+			}
+		}
+	}
+
+	return expanded, matched, nil
+}
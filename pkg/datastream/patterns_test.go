@@ -0,0 +1,57 @@
+package datastream
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIsPattern(t *testing.T) {
+	for name, want := range map[string]bool{
+		"users":          false,
+		"app.users":      false,
+		"app.*":          false,
+		"price$history":  false,
+		"app.audit$":     false,
+		"audit_*":        true,
+		"logg_202?":      true,
+		"app.hendelse_*": true,
+		"^tmp_":          true,
+		"/_old$/":        true,
+		"/":              false,
+	} {
+		if got := isPattern(name); got != want {
+			t.Errorf("isPattern(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestExpandPatterns(t *testing.T) {
+	tables := []string{"public.users", "public.price$history", "public.tmp_import", "public.audit_2024", "app.audit_2024", "app.events_old"}
+
+	for _, tc := range []struct {
+		names []string
+		want  []string
+	}{
+		{names: []string{"price$history"}, want: []string{"price$history"}},
+		{names: []string{"audit_*"}, want: []string{"public.audit_2024"}},
+		{names: []string{"*.audit_*"}, want: []string{"app.audit_2024", "public.audit_2024"}},
+		{names: []string{"^tmp_", "users"}, want: []string{"public.tmp_import", "users"}},
+		{names: []string{"/_old$/"}, want: []string{"app.events_old"}},
+	} {
+		got, _, err := expandPatterns(tc.names, tables)
+		if err != nil {
+			t.Errorf("expandPatterns(%v): %v", tc.names, err)
+			continue
+		}
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("expandPatterns(%v) = %v, want %v", tc.names, got, tc.want)
+		}
+	}
+}
+
+func TestExpandPatternsWithoutMatch(t *testing.T) {
+	_, _, err := expandPatterns([]string{"^nothing_"}, []string{"public.users"})
+	if err == nil {
+		t.Error("expandPatterns succeeded for a pattern matching no tables")
+	}
+}
@@ -0,0 +1,123 @@
+package datastream
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/navikt/nada-datastream/cmd"
+	"github.com/navikt/nada-datastream/pkg/google"
+	"github.com/navikt/nada-datastream/pkg/postgres"
+	"github.com/sirupsen/logrus"
+)
+
+// Preflight connects to the database and checks that it is ready for
+// logical replication of the tables selected in cfg.
+func Preflight(ctx context.Context, cfg *cmd.Config, log logrus.FieldLogger) (*postgres.Report, error) {
+	return runPreflight(ctx, cfg, true, log)
+}
+
+// runPreflight runs the preflight checks for the tables selected in cfg. With
+// resolve, the selection is resolved against the tables in the database first,
+// otherwise it has been resolved already, like create does with prepareTables.
+func runPreflight(ctx context.Context, cfg *cmd.Config, resolve bool, log logrus.FieldLogger) (*postgres.Report, error) {
+	log.Infof("Running preflight checks against database %v...", cfg.DB)
+	client, err := postgres.New(ctx, cfg.DBConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close(ctx)
+
+	var tables []postgres.Table
+	if resolve {
+		tables, err = resolveTables(ctx, client, cfg, log)
+	} else {
+		tables, err = client.Tables(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Preflight(ctx, cfg, selectedTables(cfg, tables))
+}
+
+// resolveTables lists the tables in the database and resolves the table
+// selection of cfg against them with resolveSelection.
+func resolveTables(ctx context.Context, client *postgres.Client, cfg *cmd.Config, log logrus.FieldLogger) ([]postgres.Table, error) {
+	tables, err := client.Tables(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string][]string{}
+	withoutKey := []string{}
+	for _, t := range tables {
+		for _, c := range t.Columns {
+			columns[t.FullName()] = append(columns[t.FullName()], c.Name)
+		}
+		if len(t.PrimaryKey) == 0 {
+			withoutKey = append(withoutKey, t.FullName())
+		}
+	}
+	if err := resolveSelection(cfg, columns, withoutKey, log); err != nil {
+		return nil, err
+	}
+
+	return tables, nil
+}
+
+// preflight runs the preflight checks for the selection prepareTables has
+// resolved, and fails unless every check passes.
+func preflight(ctx context.Context, cfg *cmd.Config, log logrus.FieldLogger) error {
+	if cfg.SkipPreflight {
+		return nil
+	}
+
+	report, err := runPreflight(ctx, cfg, false, log)
+	if err != nil {
+		return fmt.Errorf("%w\nuse --%v to skip the preflight checks", err, cmd.SkipPreflight)
+	}
+	for _, c := range report.Warnings() {
+		log.Warnf("%v: %v\n%v", c.Name, c.Details, c.Fix)
+	}
+	if report.Passed() {
+		return nil
+	}
+
+	out := &strings.Builder{}
+	if err := report.Write(out); err != nil {
+		return err
+	}
+	return fmt.Errorf("the database is not ready for datastream:\n%v\nuse --%v to skip the preflight checks", out, cmd.SkipPreflight)
+}
+
+// selectedTables returns the tables the stream described by cfg reads from.
+func selectedTables(cfg *cmd.Config, tables []postgres.Table) []postgres.Table {
+	selected := []postgres.Table{}
+	for _, t := range tables {
+		if isSelected(cfg, t.Schema, t.Name) {
+			selected = append(selected, t)
+		}
+	}
+	return selected
+}
+
+// isSelected reports whether the stream described by cfg reads from the table.
+// All tables are selected unless tables are included, and whole tables and
+// schemas that are excluded are left out.
+func isSelected(cfg *cmd.Config, schema, table string) bool {
+	matches := func(names []string) bool {
+		for _, n := range names {
+			s, t := google.SplitTableName(strings.TrimSpace(n))
+			if s == schema && (t == google.AllTables || t == table) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(cfg.IncludeTables) > 0 && !matches(cfg.IncludeTables) {
+		return false
+	}
+	return !matches(cfg.ExcludeTables)
+}
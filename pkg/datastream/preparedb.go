@@ -0,0 +1,74 @@
+package datastream
+
+import (
+	"context"
+	"strings"
+
+	"github.com/navikt/nada-datastream/cmd"
+	"github.com/navikt/nada-datastream/pkg/google"
+	"github.com/navikt/nada-datastream/pkg/postgres"
+	"github.com/sirupsen/logrus"
+)
+
+// Migration returns the SQL that prepares the database for the stream
+// described by cfg. The tables are listed by connecting to the database as
+// owner, the user the app migrates the database with.
+func Migration(ctx context.Context, cfg *cmd.Config, owner *cmd.DBConfig, log logrus.FieldLogger) (*postgres.Migration, error) {
+	client, err := postgres.New(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close(ctx)
+
+	return migration(ctx, client, cfg, owner, log)
+}
+
+// PrepareDB grants the database user of cfg access to the selected tables,
+// and creates the publication and replication slot, as owner.
+func PrepareDB(ctx context.Context, cfg *cmd.Config, owner *cmd.DBConfig, log logrus.FieldLogger) error {
+	client, err := postgres.New(ctx, owner)
+	if err != nil {
+		return err
+	}
+	defer client.Close(ctx)
+
+	m, err := migration(ctx, client, cfg, owner, log)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Preparing database %v for datastream as %v...", cfg.DB, owner.User)
+	if err := client.Migrate(ctx, m); err != nil {
+		return err
+	}
+	log.Infof("Database %v is ready, publication %v and replication slot %v exist", cfg.DB, cfg.Publication, cfg.ReplicationSlot)
+
+	return nil
+}
+
+func migration(ctx context.Context, client *postgres.Client, cfg *cmd.Config, owner *cmd.DBConfig, log logrus.FieldLogger) (*postgres.Migration, error) {
+	tables, err := resolveTables(ctx, client, cfg, log)
+	if err != nil {
+		return nil, err
+	}
+	selected := selectedTables(cfg, tables)
+
+	// select is granted on whole schemas where the stream reads whole schemas,
+	// so that tables created later are readable too
+	schemas := []string{}
+	if len(cfg.IncludeTables) == 0 {
+		for _, t := range selected {
+			if !contains(schemas, t.Schema) {
+				schemas = append(schemas, t.Schema)
+			}
+		}
+	}
+	for _, name := range cfg.IncludeTables {
+		schema, table := google.SplitTableName(strings.TrimSpace(name))
+		if table == google.AllTables && !contains(schemas, schema) {
+			schemas = append(schemas, schema)
+		}
+	}
+
+	return postgres.NewMigration(cfg, owner.User, schemas, selected)
+}
@@ -0,0 +1,79 @@
+package datastream
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/navikt/nada-datastream/cmd"
+	"github.com/navikt/nada-datastream/pkg/google"
+	"github.com/sirupsen/logrus"
+)
+
+// handleTablesWithoutPrimaryKey excludes the selected tables without a primary
+// key, given as schema.table, from cfg, or makes the datastream append-only,
+// as cfg says. The datastream is only made append-only when a selected table
+// has no primary key, since the whole datastream is either append-only or
+// merging. Warning about them is left to the preflight checks.
+func handleTablesWithoutPrimaryKey(cfg *cmd.Config, withoutKey []string, log logrus.FieldLogger) error {
+	selected := []string{}
+	for _, t := range withoutKey {
+		schema, table := google.SplitTableName(t)
+		if isSelected(cfg, schema, table) {
+			selected = append(selected, t)
+		}
+	}
+	sort.Strings(selected)
+	cfg.AppendOnly = len(selected) > 0 && cfg.TablesWithoutPrimaryKey == cmd.WithoutPrimaryKeyAppendOnly
+	if len(selected) == 0 {
+		return nil
+	}
+
+	switch cfg.TablesWithoutPrimaryKey {
+	case cmd.WithoutPrimaryKeyExclude:
+		log.Infof("Excluding tables without a primary key: %v", strings.Join(selected, ", "))
+		for _, t := range selected {
+			included, err := withoutTable(cfg.IncludeTables, t)
+			if err != nil {
+				return fmt.Errorf("%w\nadd a primary key to the table, or use --%v=%v", err, cmd.TablesWithoutPrimaryKey, cmd.WithoutPrimaryKeyAppendOnly)
+			}
+			cfg.IncludeTables = included
+			cfg.ExcludeTables = append(cfg.ExcludeTables, t)
+			dropColumnSelections(cfg, t, log)
+		}
+	case cmd.WithoutPrimaryKeyAppendOnly:
+		log.Infof("Writing to BigQuery in append-only mode, these tables have no primary key: %v", strings.Join(selected, ", "))
+	}
+	return nil
+}
+
+// dropColumnSelections removes the columns selected for the table, given as
+// schema.table, from cfg, since they can't be selected once the whole table is
+// excluded.
+func dropColumnSelections(cfg *cmd.Config, table string, log logrus.FieldLogger) {
+	for _, columns := range []map[string][]string{cfg.IncludeColumns, cfg.ExcludeColumns} {
+		for name := range columns {
+			schema, t := google.SplitTableName(strings.TrimSpace(name))
+			if schema+"."+t == table {
+				log.Infof("Ignoring the columns selected for %v, since the table is excluded", table)
+				delete(columns, name)
+			}
+		}
+	}
+}
+
+// withoutTable removes the table, given as schema.table, from names. Removing
+// the last name fails, since no included tables means all tables.
+func withoutTable(names []string, table string) ([]string, error) {
+	kept := []string{}
+	for _, n := range names {
+		schema, name := google.SplitTableName(strings.TrimSpace(n))
+		if schema+"."+name != table {
+			kept = append(kept, n)
+		}
+	}
+	if len(names) > 0 && len(kept) == 0 {
+		return nil, fmt.Errorf("table %v has no primary key, and excluding it leaves no included tables, which would stream every table instead", table)
+	}
+	return kept, nil
+}
@@ -0,0 +1,110 @@
+package datastream
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/navikt/nada-datastream/cmd"
+	"github.com/navikt/nada-datastream/pkg/google"
+	"github.com/sirupsen/logrus"
+)
+
+func discardLog() logrus.FieldLogger {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	return log
+}
+
+func TestAppendOnlyOnlyWithSelectedTableWithoutPrimaryKey(t *testing.T) {
+	for _, tc := range []struct {
+		mode     string
+		included []string
+		want     bool
+	}{
+		{mode: cmd.WithoutPrimaryKeyAppendOnly, included: []string{"users", "events"}, want: true},
+		{mode: cmd.WithoutPrimaryKeyAppendOnly, included: []string{"users"}, want: false},
+		{mode: cmd.WithoutPrimaryKeyAppendOnly, want: true},
+		{mode: cmd.WithoutPrimaryKeyWarn, included: []string{"events"}, want: false},
+	} {
+		cfg := &cmd.Config{DBConfig: &cmd.DBConfig{}, TablesWithoutPrimaryKey: tc.mode, IncludeTables: tc.included}
+
+		if err := handleTablesWithoutPrimaryKey(cfg, []string{"public.events"}, discardLog()); err != nil {
+			t.Fatalf("handleTablesWithoutPrimaryKey: %v", err)
+		}
+		if cfg.AppendOnly != tc.want {
+			t.Errorf("%v with tables %v: got append-only %v, want %v", tc.mode, tc.included, cfg.AppendOnly, tc.want)
+		}
+	}
+}
+
+func TestExcludeTablesWithoutPrimaryKey(t *testing.T) {
+	cfg := &cmd.Config{DBConfig: &cmd.DBConfig{}, TablesWithoutPrimaryKey: cmd.WithoutPrimaryKeyExclude, IncludeTables: []string{"users", "events"}}
+
+	if err := handleTablesWithoutPrimaryKey(cfg, []string{"public.events", "public.logg"}, discardLog()); err != nil {
+		t.Fatalf("handleTablesWithoutPrimaryKey: %v", err)
+	}
+	if strings.Join(cfg.IncludeTables, ",") != "users" {
+		t.Errorf("got included tables %v, want users", cfg.IncludeTables)
+	}
+	if strings.Join(cfg.ExcludeTables, ",") != "public.events" {
+		t.Errorf("got excluded tables %v, want public.events", cfg.ExcludeTables)
+	}
+	if cfg.AppendOnly {
+		t.Error("datastream excluding tables without a primary key is append-only")
+	}
+}
+
+func TestExcludeOnlyIncludedTableWithoutPrimaryKey(t *testing.T) {
+	cfg := &cmd.Config{DBConfig: &cmd.DBConfig{}, TablesWithoutPrimaryKey: cmd.WithoutPrimaryKeyExclude, IncludeTables: []string{"events"}}
+
+	err := handleTablesWithoutPrimaryKey(cfg, []string{"public.events"}, discardLog())
+	if err == nil {
+		t.Fatalf("excluding the only included table succeeded with included tables %v", cfg.IncludeTables)
+	}
+	if !strings.Contains(err.Error(), "public.events") {
+		t.Errorf("error does not name the table: %v", err)
+	}
+}
+
+func TestExcludeTableWithoutPrimaryKeyWithColumnSelection(t *testing.T) {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	cfg := &cmd.Config{
+		DBConfig:                &cmd.DBConfig{Project: "test-project", Region: "europe-north1", Instance: "app-instance", DB: "mydb", User: "datastream"},
+		TablesWithoutPrimaryKey: cmd.WithoutPrimaryKeyExclude,
+		IncludeTables:           []string{"users", "events"},
+		IncludeColumns:          map[string][]string{"users": {"id", "name"}, "events": {"payload"}},
+		ExcludeColumns:          map[string][]string{"public.events": {"secret"}},
+		Publication:             cmd.DefaultPublication,
+		ReplicationSlot:         cmd.DefaultReplicationSlot,
+		DatasetPerSchema:        true,
+	}
+	tables := map[string][]string{
+		"public.users":  {"id", "name"},
+		"public.events": {"payload", "secret"},
+	}
+
+	if err := resolveSelection(cfg, tables, []string{"public.events"}, log); err != nil {
+		t.Fatalf("resolveSelection: %v", err)
+	}
+	if _, ok := cfg.IncludeColumns["events"]; ok {
+		t.Errorf("columns are still included for the excluded table: %v", cfg.IncludeColumns)
+	}
+	if len(cfg.ExcludeColumns) > 0 {
+		t.Errorf("columns are still excluded for the excluded table: %v", cfg.ExcludeColumns)
+	}
+	if strings.Join(cfg.IncludeColumns["users"], ",") != "id,name" {
+		t.Errorf("got included columns %v, want the selection of users kept", cfg.IncludeColumns)
+	}
+
+	g := google.NewWithExecutor(logrus.NewEntry(log), cfg, emptyProject{})
+	plan, err := g.PlanCreate(context.Background())
+	if err != nil {
+		t.Fatalf("PlanCreate with the resolved selection: %v", err)
+	}
+	if excluded := plan.Stream.SourceConfig.PostgresqlSourceConfig.ExcludeObjects; excluded == nil || len(excluded.PostgresqlSchemas) != 1 || len(excluded.PostgresqlSchemas[0].PostgresqlTables) != 1 || excluded.PostgresqlSchemas[0].PostgresqlTables[0].Table != "events" {
+		t.Errorf("stream does not exclude public.events: %+v", excluded)
+	}
+}
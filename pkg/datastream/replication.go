@@ -0,0 +1,99 @@
+package datastream
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/navikt/nada-datastream/cmd"
+	"github.com/navikt/nada-datastream/pkg/google"
+	"github.com/navikt/nada-datastream/pkg/postgres"
+	"github.com/sirupsen/logrus"
+)
+
+// replicationNames sets the publication and replication slot of cfg that are
+// not given to the ones the datastream reads from, or to the defaults when the
+// datastream does not exist.
+func replicationNames(ctx context.Context, g *google.Google, cfg *cmd.Config) error {
+	publication, slot, err := g.StreamReplication(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range []struct {
+		name              *string
+		live, defaultName string
+	}{
+		{name: &cfg.Publication, live: publication, defaultName: cmd.DefaultPublication},
+		{name: &cfg.ReplicationSlot, live: slot, defaultName: cmd.DefaultReplicationSlot},
+	} {
+		switch {
+		case *n.name != "":
+		case n.live != "":
+			*n.name = n.live
+		default:
+			*n.name = n.defaultName
+		}
+	}
+
+	return nil
+}
+
+// planDropReplication adds the publication, replication slot and heartbeat
+// table dropReplication drops to plan.
+func planDropReplication(plan *google.Plan, cfg *cmd.Config) {
+	reason := fmt.Sprintf("dropped from database %v if it exists", cfg.DB)
+	for _, c := range []struct{ resource, name string }{
+		{resource: "publication", name: cfg.Publication},
+		{resource: "replication slot", name: cfg.ReplicationSlot},
+		{resource: "heartbeat table", name: postgres.HeartbeatTableName(cfg.ReplicationSlot)},
+	} {
+		plan.Changes = append(plan.Changes, google.PlannedChange{
+			Resource: c.resource,
+			Name:     c.name,
+			Action:   google.ActionDelete,
+			Reason:   reason,
+		})
+	}
+}
+
+// dropReplication drops the publication and replication slot of cfg, and the
+// heartbeat table of the slot, from the database as owner.
+func dropReplication(ctx context.Context, cfg *cmd.Config, owner *cmd.DBConfig, log logrus.FieldLogger) error {
+	client, err := postgres.New(ctx, owner)
+	if err != nil {
+		return fmt.Errorf("%w\ndrop them as the database owner when the database can be reached:\n%v", err, postgres.DropReplicationSQL(cfg.Publication, cfg.ReplicationSlot))
+	}
+	defer client.Close(ctx)
+
+	dropped, err := client.DropReplication(ctx, cfg.Publication, cfg.ReplicationSlot)
+	if err == nil {
+		var existed bool
+		existed, err = client.DropHeartbeat(ctx, cfg.ReplicationSlot)
+		if existed {
+			dropped = append(dropped, "heartbeat table "+postgres.HeartbeatTableName(cfg.ReplicationSlot))
+		}
+	}
+	if len(dropped) > 0 {
+		log.Infof("Dropped %v from database %v", strings.Join(dropped, ", "), cfg.DB)
+	}
+	if err != nil {
+		return err
+	}
+	if len(dropped) == 0 {
+		log.Infof("Publication %v and replication slot %v do not exist in database %v, nothing to drop", cfg.Publication, cfg.ReplicationSlot, cfg.DB)
+	}
+
+	return nil
+}
+
+// SlotStatus returns how far the replication slot of cfg is behind the database.
+func SlotStatus(ctx context.Context, cfg *cmd.Config, log logrus.FieldLogger) (*postgres.SlotStatus, error) {
+	client, err := postgres.New(ctx, cfg.DBConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close(ctx)
+
+	return client.SlotStatus(ctx, cfg.ReplicationSlot)
+}
@@ -0,0 +1,281 @@
+package datastream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/navikt/nada-datastream/cmd"
+	"github.com/navikt/nada-datastream/pkg/google"
+	"github.com/navikt/nada-datastream/pkg/postgres"
+	"github.com/sirupsen/logrus"
+)
+
+// sourceTables returns the columns of every table in the source database, by
+// schema.table, and the tables without a primary key. The tables are
+// discovered through the source connection profile when it exists, and
+// otherwise by querying the database directly.
+func sourceTables(ctx context.Context, g *google.Google, cfg *cmd.Config, log logrus.FieldLogger) (map[string][]string, []string, error) {
+	tables := map[string][]string{}
+
+	exists, err := g.SourceProfileExists(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if exists {
+		discovery, err := g.Discover(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, t := range discovery.Tables {
+			columns := []string{}
+			for _, c := range t.Columns {
+				columns = append(columns, c.Name)
+			}
+			tables[t.Name()] = columns
+		}
+		return tables, discovery.TablesWithoutPrimaryKey(), nil
+	}
+
+	log.Infof("Listing tables in database %v...", cfg.DB)
+	client, err := postgres.New(ctx, cfg.DBConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer client.Close(ctx)
+
+	pgTables, err := client.Tables(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	withoutKey := []string{}
+	for _, t := range pgTables {
+		columns := []string{}
+		for _, c := range t.Columns {
+			columns = append(columns, c.Name)
+		}
+		tables[t.FullName()] = columns
+		if len(t.PrimaryKey) == 0 {
+			withoutKey = append(withoutKey, t.FullName())
+		}
+	}
+	return tables, withoutKey, nil
+}
+
+// prepareTables resolves the table patterns in cfg against the tables in the
+// source database, and checks that the tables and columns selected exist,
+// before anything is created, suggesting the closest name for those that don't.
+// Selected tables without a primary key are handled as cfg says.
+func prepareTables(ctx context.Context, g *google.Google, cfg *cmd.Config, log logrus.FieldLogger) error {
+	hasPatterns := hasPatterns(cfg)
+	// excluding tables without a primary key, or writing append-only when
+	// there are any, needs the tables in the database
+	handleWithoutKey := cfg.TablesWithoutPrimaryKey == cmd.WithoutPrimaryKeyExclude || cfg.TablesWithoutPrimaryKey == cmd.WithoutPrimaryKeyAppendOnly
+	if cfg.SkipTableValidation && !hasPatterns && !handleWithoutKey {
+		return nil
+	}
+	if len(cfg.IncludeTables) == 0 && len(cfg.ExcludeTables) == 0 && len(cfg.IncludeColumns) == 0 && len(cfg.ExcludeColumns) == 0 && !handleWithoutKey {
+		return nil
+	}
+
+	tables, withoutKey, err := sourceTables(ctx, g, cfg, log)
+	if err != nil {
+		if hasPatterns {
+			return fmt.Errorf("%w\nthe table patterns can't be resolved without the list of tables", err)
+		}
+		if handleWithoutKey {
+			return fmt.Errorf("%w\nthe tables without a primary key can't be found without the list of tables", err)
+		}
+		return fmt.Errorf("%w\nthe table names can't be validated, use --%v to skip validation", err, cmd.SkipTableValidation)
+	}
+
+	return resolveSelection(cfg, tables, withoutKey, log)
+}
+
+// resolveSelection resolves the table patterns in cfg against tables, the
+// columns of each table by schema.table, checks that the tables and columns
+// selected exist, and handles the selected tables without a primary key, given
+// in withoutKey, as cfg says. It is run once per config, since excluding the
+// tables without a primary key changes the selection.
+func resolveSelection(cfg *cmd.Config, tables map[string][]string, withoutKey []string, log logrus.FieldLogger) error {
+	if hasPatterns(cfg) {
+		names := []string{}
+		for t := range tables {
+			names = append(names, t)
+		}
+		if err := resolvePatterns(cfg, names, log); err != nil {
+			return err
+		}
+	}
+
+	if !cfg.SkipTableValidation {
+		if err := checkTables(cfg, tables); err != nil {
+			return err
+		}
+	}
+
+	return handleTablesWithoutPrimaryKey(cfg, withoutKey, log)
+}
+
+// hasPatterns reports whether any of the included or excluded tables of cfg is a pattern.
+func hasPatterns(cfg *cmd.Config) bool {
+	for _, t := range append(append([]string{}, cfg.IncludeTables...), cfg.ExcludeTables...) {
+		if isPattern(strings.TrimSpace(t)) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolvePatterns replaces the patterns in the included and excluded tables of
+// cfg with the tables they match.
+func resolvePatterns(cfg *cmd.Config, tables []string, log logrus.FieldLogger) error {
+	for _, list := range []*[]string{&cfg.IncludeTables, &cfg.ExcludeTables} {
+		expanded, matched, err := expandPatterns(*list, tables)
+		if err != nil {
+			return err
+		}
+		for _, pattern := range sortedKeys(matched) {
+			log.Infof("Table pattern %q matches %v", pattern, strings.Join(matched[pattern], ", "))
+		}
+		*list = expanded
+	}
+
+	return nil
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// checkTables checks the tables and columns selected in cfg against tables,
+// the columns of each table by schema.table.
+func checkTables(cfg *cmd.Config, tables map[string][]string) error {
+	names := []string{}
+	schemas := []string{}
+	for name := range tables {
+		names = append(names, name)
+		schema, _ := google.SplitTableName(name)
+		if !contains(schemas, schema) {
+			schemas = append(schemas, schema)
+		}
+	}
+	sort.Strings(names)
+	sort.Strings(schemas)
+
+	errs := []error{}
+	checkTable := func(name string) bool {
+		schema, table := google.SplitTableName(strings.TrimSpace(name))
+		if table == google.AllTables {
+			if !contains(schemas, schema) {
+				errs = append(errs, fmt.Errorf("schema %q does not exist in database %v%v", schema, cfg.DB, didYouMean(closest(schema, schemas))))
+				return false
+			}
+			return true
+		}
+
+		key := schema + "." + table
+		if _, ok := tables[key]; !ok {
+			suggestion := closest(key, names)
+			// suggest the name in the same form it was given
+			if !strings.Contains(name, ".") {
+				suggestion = strings.TrimPrefix(suggestion, "public.")
+			}
+			errs = append(errs, fmt.Errorf("table %q does not exist in database %v%v", strings.TrimSpace(name), cfg.DB, didYouMean(suggestion)))
+			return false
+		}
+		return true
+	}
+
+	for _, t := range cfg.IncludeTables {
+		checkTable(t)
+	}
+	for _, t := range cfg.ExcludeTables {
+		checkTable(t)
+	}
+
+	for _, columns := range []map[string][]string{cfg.IncludeColumns, cfg.ExcludeColumns} {
+		for table, cols := range columns {
+			if !checkTable(table) {
+				continue
+			}
+			schema, name := google.SplitTableName(table)
+			existing := tables[schema+"."+name]
+			for _, c := range cols {
+				c = strings.TrimSpace(c)
+				if c == google.AllTables || contains(existing, c) {
+					continue
+				}
+				errs = append(errs, fmt.Errorf("column %q does not exist in table %v.%v%v", c, schema, name, didYouMean(closest(c, existing))))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func didYouMean(suggestions ...string) string {
+	for _, s := range suggestions {
+		if s != "" {
+			return fmt.Sprintf(", did you mean %q?", s)
+		}
+	}
+	return ""
+}
+
+// closest returns the candidate closest to name, or an empty string if none
+// of them are close enough to be a likely typo.
+func closest(name string, candidates []string) string {
+	best := ""
+	bestDistance := max(2, len(name)/3) + 1
+	for _, c := range candidates {
+		if strings.EqualFold(c, name) {
+			return c
+		}
+		if d := levenshtein(strings.ToLower(name), strings.ToLower(c)); d < bestDistance {
+			best = c
+			bestDistance = d
+		}
+	}
+	return best
+}
+
+// levenshtein returns the number of single character edits needed to turn a into b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+
+	return prev[len(rb)]
+}
+
+func contains(vals []string, val string) bool {
+	for _, v := range vals {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package datastream
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/navikt/nada-datastream/cmd"
+)
+
+func TestCheckTables(t *testing.T) {
+	tables := map[string][]string{
+		"public.users":  {"id", "name", "email"},
+		"public.events": {"payload"},
+		"audit.log":     {"id", "ip"},
+	}
+
+	for _, tc := range []struct {
+		name string
+		cfg  cmd.Config
+		// errs are the error for a single problem, or parts of the error,
+		// one for each problem
+		errs []string
+	}{
+		{
+			name: "existing tables and columns",
+			cfg: cmd.Config{
+				IncludeTables:  []string{"users", " audit.log", "audit.*"},
+				ExcludeTables:  []string{"public.events"},
+				IncludeColumns: map[string][]string{"users": {"id", " name", "*"}},
+				ExcludeColumns: map[string][]string{"audit.log": {"ip"}},
+			},
+		},
+		{
+			name: "misspelled table",
+			cfg:  cmd.Config{IncludeTables: []string{"user"}},
+			errs: []string{`table "user" does not exist in database mydb, did you mean "users"?`},
+		},
+		{
+			name: "misspelled table with schema",
+			cfg:  cmd.Config{ExcludeTables: []string{"public.event"}},
+			errs: []string{`table "public.event" does not exist in database mydb, did you mean "public.events"?`},
+		},
+		{
+			name: "unknown table",
+			cfg:  cmd.Config{IncludeTables: []string{"invoices"}},
+			errs: []string{`table "invoices" does not exist in database mydb`},
+		},
+		{
+			name: "misspelled schema",
+			cfg:  cmd.Config{IncludeTables: []string{"audt.*"}},
+			errs: []string{`schema "audt" does not exist in database mydb, did you mean "audit"?`},
+		},
+		{
+			name: "misspelled column",
+			cfg:  cmd.Config{IncludeColumns: map[string][]string{"users": {"id", "emial"}}},
+			errs: []string{`column "emial" does not exist in table public.users, did you mean "email"?`},
+		},
+		{
+			name: "columns of unknown table",
+			cfg:  cmd.Config{ExcludeColumns: map[string][]string{"audit.logs": {"secret"}}},
+			errs: []string{`table "audit.logs" does not exist in database mydb, did you mean "audit.log"?`},
+		},
+		{
+			name: "several problems",
+			cfg:  cmd.Config{IncludeTables: []string{"user", "audit.logg"}, IncludeColumns: map[string][]string{"users": {"nam"}}},
+			errs: []string{`table "user"`, `table "audit.logg"`, `column "nam"`},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := tc.cfg
+			cfg.DBConfig = &cmd.DBConfig{DB: "mydb"}
+
+			err := checkTables(&cfg, tables)
+			if len(tc.errs) == 0 {
+				if err != nil {
+					t.Errorf("checkTables: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("checkTables succeeded, want an error")
+			}
+			if got := strings.Count(err.Error(), "\n") + 1; got != len(tc.errs) {
+				t.Errorf("got %v problems, want %v:\n%v", got, len(tc.errs), err)
+			}
+			for _, e := range tc.errs {
+				if !strings.Contains(err.Error(), e) {
+					t.Errorf("error does not contain %q:\n%v", e, err)
+				}
+			}
+			if len(tc.errs) == 1 && err.Error() != tc.errs[0] {
+				t.Errorf("got error %q, want %q", err, tc.errs[0])
+			}
+		})
+	}
+}
+
+func TestClosest(t *testing.T) {
+	candidates := []string{"public.users", "public.user_roles", "public.events", "audit.log"}
+
+	for _, tc := range []struct {
+		name string
+		want string
+	}{
+		{name: "public.users", want: "public.users"},
+		{name: "PUBLIC.Users", want: "public.users"},
+		{name: "public.user", want: "public.users"},
+		{name: "public.evnets", want: "public.events"},
+		{name: "audit.lgo", want: "audit.log"},
+		{name: "public.invoices", want: ""},
+		{name: "x", want: ""},
+	} {
+		if got := closest(tc.name, candidates); got != tc.want {
+			t.Errorf("closest(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want int
+	}{
+		{a: "", b: "", want: 0},
+		{a: "users", b: "users", want: 0},
+		{a: "", b: "users", want: 5},
+		{a: "user", b: "users", want: 1},
+		{a: "evnets", b: "events", want: 2},
+		{a: "kitten", b: "sitting", want: 3},
+		{a: "tabell_æ", b: "tabell_ø", want: 1},
+	} {
+		if got := levenshtein(tc.a, tc.b); got != tc.want {
+			t.Errorf("levenshtein(%q, %q) = %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+		if got := levenshtein(tc.b, tc.a); got != tc.want {
+			t.Errorf("levenshtein(%q, %q) = %v, want %v", tc.b, tc.a, got, tc.want)
+		}
+	}
+}
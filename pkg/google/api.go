@@ -0,0 +1,775 @@
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/api/cloudresourcemanager/v1"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/datastream/v1"
+	"google.golang.org/api/iam/v1"
+	"google.golang.org/api/option"
+	"google.golang.org/api/serviceusage/v1"
+	"google.golang.org/api/sqladmin/v1"
+)
+
+// operationPollInterval is how long to wait between checks of long-running operations.
+var operationPollInterval = 5 * time.Second
+
+type apiBackend struct {
+	project string
+	opts    []option.ClientOption
+
+	compute         *compute.Service
+	datastream      *datastream.Service
+	iam             *iam.Service
+	serviceUsage    *serviceusage.Service
+	resourceManager *cloudresourcemanager.Service
+	sqlAdmin        *sqladmin.Service
+}
+
+// NewAPIBackend returns a Backend that uses the Google Cloud client libraries
+// directly. The options are passed on to every client, which makes it possible
+// to point the backend at local stand-ins with option.WithEndpoint.
+func NewAPIBackend(ctx context.Context, project string, opts ...option.ClientOption) (Backend, error) {
+	computeService, err := compute.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating compute client: %w", err)
+	}
+
+	datastreamService, err := datastream.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating datastream client: %w", err)
+	}
+
+	iamService, err := iam.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating iam client: %w", err)
+	}
+
+	serviceUsageService, err := serviceusage.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating service usage client: %w", err)
+	}
+
+	resourceManagerService, err := cloudresourcemanager.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating resource manager client: %w", err)
+	}
+
+	sqlAdminService, err := sqladmin.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating sql admin client: %w", err)
+	}
+
+	return &apiBackend{
+		project:         project,
+		opts:            opts,
+		compute:         computeService,
+		datastream:      datastreamService,
+		iam:             iamService,
+		serviceUsage:    serviceUsageService,
+		resourceManager: resourceManagerService,
+		sqlAdmin:        sqlAdminService,
+	}, nil
+}
+
+func (b *apiBackend) projectName() string {
+	return "projects/" + b.project
+}
+
+func (b *apiBackend) EnabledServices(ctx context.Context) ([]string, error) {
+	names := []string{}
+	err := b.serviceUsage.Services.List(b.projectName()).Filter("state:ENABLED").Pages(ctx, func(page *serviceusage.ListServicesResponse) error {
+		for _, s := range page.Services {
+			names = append(names, lastPathElement(s.Name))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing enabled services: %w", err)
+	}
+
+	return names, nil
+}
+
+func (b *apiBackend) EnableService(ctx context.Context, service string) error {
+	op, err := b.serviceUsage.Services.Enable(b.projectName()+"/services/"+service, &serviceusage.EnableServiceRequest{}).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("enabling service %v: %w", service, err)
+	}
+
+	return b.waitForServiceUsageOperation(ctx, op)
+}
+
+func (b *apiBackend) DisableService(ctx context.Context, service string) error {
+	op, err := b.serviceUsage.Services.Disable(b.projectName()+"/services/"+service, &serviceusage.DisableServiceRequest{
+		DisableDependentServices: true,
+	}).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("disabling service %v: %w", service, err)
+	}
+
+	return b.waitForServiceUsageOperation(ctx, op)
+}
+
+func (b *apiBackend) waitForServiceUsageOperation(ctx context.Context, op *serviceusage.Operation) error {
+	var err error
+	for !op.Done {
+		if err := sleep(ctx, operationPollInterval); err != nil {
+			return err
+		}
+		name := op.Name
+		op, err = b.serviceUsage.Operations.Get(name).Context(ctx).Do()
+		if err != nil {
+			return fmt.Errorf("getting operation %v: %w", name, err)
+		}
+	}
+
+	if op.Error != nil {
+		return &OperationError{Operation: op.Name, Code: int(op.Error.Code), Message: op.Error.Message}
+	}
+
+	return nil
+}
+
+func (b *apiBackend) Networks(ctx context.Context) ([]string, error) {
+	names := []string{}
+	err := b.compute.Networks.List(b.project).Pages(ctx, func(page *compute.NetworkList) error {
+		for _, n := range page.Items {
+			names = append(names, n.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing networks: %w", err)
+	}
+
+	return names, nil
+}
+
+func (b *apiBackend) CreateNetwork(ctx context.Context, network string) error {
+	op, err := b.compute.Networks.Insert(b.project, &compute.Network{
+		Name:                  network,
+		AutoCreateSubnetworks: true,
+	}).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("creating network %v: %w", network, err)
+	}
+
+	return b.waitForComputeOperation(ctx, op)
+}
+
+func (b *apiBackend) DeleteNetwork(ctx context.Context, network string) error {
+	op, err := b.compute.Networks.Delete(b.project, network).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("deleting network %v: %w", network, err)
+	}
+
+	return b.waitForComputeOperation(ctx, op)
+}
+
+func (b *apiBackend) FirewallRules(ctx context.Context) ([]string, error) {
+	names := []string{}
+	err := b.compute.Firewalls.List(b.project).Pages(ctx, func(page *compute.FirewallList) error {
+		for _, f := range page.Items {
+			names = append(names, f.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing firewall rules: %w", err)
+	}
+
+	return names, nil
+}
+
+func (b *apiBackend) CreateFirewallRule(ctx context.Context, rule FirewallRule) error {
+	op, err := b.compute.Firewalls.Insert(b.project, &compute.Firewall{
+		Name:         rule.Name,
+		Network:      fmt.Sprintf("projects/%v/global/networks/%v", b.project, rule.Network),
+		SourceRanges: []string{rule.SourceRange},
+		Direction:    "INGRESS",
+		Allowed: []*compute.FirewallAllowed{
+			{
+				IPProtocol: rule.Protocol,
+				Ports:      []string{rule.Port},
+			},
+		},
+	}).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("creating firewall rule %v: %w", rule.Name, err)
+	}
+
+	return b.waitForComputeOperation(ctx, op)
+}
+
+func (b *apiBackend) DeleteFirewallRule(ctx context.Context, rule string) error {
+	op, err := b.compute.Firewalls.Delete(b.project, rule).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("deleting firewall rule %v: %w", rule, err)
+	}
+
+	return b.waitForComputeOperation(ctx, op)
+}
+
+func (b *apiBackend) ServiceAccounts(ctx context.Context) ([]string, error) {
+	emails := []string{}
+	err := b.iam.Projects.ServiceAccounts.List(b.projectName()).Pages(ctx, func(page *iam.ListServiceAccountsResponse) error {
+		for _, sa := range page.Accounts {
+			emails = append(emails, sa.Email)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing service accounts: %w", err)
+	}
+
+	return emails, nil
+}
+
+func (b *apiBackend) CreateServiceAccount(ctx context.Context, accountID, displayName, description string) error {
+	_, err := b.iam.Projects.ServiceAccounts.Create(b.projectName(), &iam.CreateServiceAccountRequest{
+		AccountId: accountID,
+		ServiceAccount: &iam.ServiceAccount{
+			DisplayName: displayName,
+			Description: description,
+		},
+	}).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("creating service account %v: %w", accountID, err)
+	}
+
+	return nil
+}
+
+func (b *apiBackend) DeleteServiceAccount(ctx context.Context, email string) error {
+	_, err := b.iam.Projects.ServiceAccounts.Delete(b.projectName() + "/serviceAccounts/" + email).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("deleting service account %v: %w", email, err)
+	}
+
+	return nil
+}
+
+func (b *apiBackend) iamPolicy(ctx context.Context) (*cloudresourcemanager.Policy, error) {
+	policy, err := b.resourceManager.Projects.GetIamPolicy(b.project, &cloudresourcemanager.GetIamPolicyRequest{
+		Options: &cloudresourcemanager.GetPolicyOptions{RequestedPolicyVersion: 3},
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("getting iam policy for project %v: %w", b.project, err)
+	}
+
+	return policy, nil
+}
+
+func (b *apiBackend) setIAMPolicy(ctx context.Context, policy *cloudresourcemanager.Policy) error {
+	_, err := b.resourceManager.Projects.SetIamPolicy(b.project, &cloudresourcemanager.SetIamPolicyRequest{
+		Policy: policy,
+	}).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("setting iam policy for project %v: %w", b.project, err)
+	}
+
+	return nil
+}
+
+func (b *apiBackend) MemberRoles(ctx context.Context, member string) ([]string, error) {
+	policy, err := b.iamPolicy(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := []string{}
+	for _, binding := range policy.Bindings {
+		if contains(binding.Members, member) {
+			roles = append(roles, binding.Role)
+		}
+	}
+
+	return roles, nil
+}
+
+func (b *apiBackend) AddRoleBinding(ctx context.Context, member, role string) error {
+	policy, err := b.iamPolicy(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, binding := range policy.Bindings {
+		if binding.Role == role && binding.Condition == nil {
+			if contains(binding.Members, member) {
+				return nil
+			}
+			binding.Members = append(binding.Members, member)
+			return b.setIAMPolicy(ctx, policy)
+		}
+	}
+
+	policy.Bindings = append(policy.Bindings, &cloudresourcemanager.Binding{
+		Role:    role,
+		Members: []string{member},
+	})
+	return b.setIAMPolicy(ctx, policy)
+}
+
+func (b *apiBackend) RemoveRoleBinding(ctx context.Context, member, role string) error {
+	policy, err := b.iamPolicy(ctx)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	bindings := []*cloudresourcemanager.Binding{}
+	for _, binding := range policy.Bindings {
+		if binding.Role == role && binding.Condition == nil && contains(binding.Members, member) {
+			changed = true
+			members := []string{}
+			for _, m := range binding.Members {
+				if m != member {
+					members = append(members, m)
+				}
+			}
+			// a binding without members is rejected by setIamPolicy
+			if len(members) == 0 {
+				continue
+			}
+			binding.Members = members
+		}
+		bindings = append(bindings, binding)
+	}
+	if !changed {
+		return nil
+	}
+
+	policy.Bindings = bindings
+	return b.setIAMPolicy(ctx, policy)
+}
+
+func (b *apiBackend) Instances(ctx context.Context) ([]string, error) {
+	names := []string{}
+	err := b.compute.Instances.AggregatedList(b.project).Pages(ctx, func(page *compute.InstanceAggregatedList) error {
+		for _, scope := range page.Items {
+			for _, i := range scope.Instances {
+				names = append(names, i.Name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing compute instances: %w", err)
+	}
+
+	return names, nil
+}
+
+func (b *apiBackend) CreateProxyInstance(ctx context.Context, instance ProxyInstance) error {
+	declaration, err := containerDeclaration(instance)
+	if err != nil {
+		return err
+	}
+	loggingEnabled := "true"
+	region := zoneRegion(instance.Zone)
+
+	op, err := b.compute.Instances.Insert(b.project, instance.Zone, &compute.Instance{
+		Name:        instance.Name,
+		MachineType: fmt.Sprintf("zones/%v/machineTypes/%v", instance.Zone, instance.MachineType),
+		Labels:      proxyInstanceLabels(instance),
+		Disks: []*compute.AttachedDisk{
+			{
+				Boot:       true,
+				AutoDelete: true,
+				InitializeParams: &compute.AttachedDiskInitializeParams{
+					SourceImage: "projects/cos-cloud/global/images/family/cos-stable",
+				},
+			},
+			{
+				AutoDelete: true,
+				InitializeParams: &compute.AttachedDiskInitializeParams{
+					SourceImage: fmt.Sprintf("projects/%v/global/images/family/%v", instance.DiskImageProject, instance.DiskImageFamily),
+				},
+			},
+		},
+		NetworkInterfaces: []*compute.NetworkInterface{
+			{
+				Network:    fmt.Sprintf("projects/%v/global/networks/%v", b.project, instance.Network),
+				Subnetwork: fmt.Sprintf("projects/%v/regions/%v/subnetworks/%v", b.project, region, instance.Subnet),
+				AccessConfigs: []*compute.AccessConfig{
+					{
+						Name: "external-nat",
+						Type: "ONE_TO_ONE_NAT",
+					},
+				},
+			},
+		},
+		ServiceAccounts: []*compute.ServiceAccount{
+			{
+				Email:  instance.ServiceAccount,
+				Scopes: []string{"https://www.googleapis.com/auth/cloud-platform"},
+			},
+		},
+		Metadata: &compute.Metadata{
+			Items: []*compute.MetadataItems{
+				{Key: "gce-container-declaration", Value: &declaration},
+				{Key: "google-logging-enabled", Value: &loggingEnabled},
+			},
+		},
+	}).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("creating compute instance %v: %w", instance.Name, err)
+	}
+
+	return b.waitForComputeOperation(ctx, op)
+}
+
+// proxyInstanceLabels returns the labels of the instance, along with the label
+// Container-Optimized OS instances running a container get.
+func proxyInstanceLabels(instance ProxyInstance) map[string]string {
+	labels := map[string]string{
+		"container-vm": "cos-stable",
+	}
+	for k, v := range instance.Labels {
+		labels[k] = v
+	}
+	return labels
+}
+
+// containerDeclaration returns the metadata value the Container-Optimized OS
+// agent reads to start the instance container. JSON is valid YAML, so there is
+// no need for a yaml encoder.
+func containerDeclaration(instance ProxyInstance) (string, error) {
+	type container struct {
+		Name  string   `json:"name"`
+		Image string   `json:"image"`
+		Args  []string `json:"args"`
+		Stdin bool     `json:"stdin"`
+		TTY   bool     `json:"tty"`
+	}
+	declaration := map[string]any{
+		"spec": map[string]any{
+			"containers": []container{
+				{
+					Name:  instance.Name,
+					Image: instance.ContainerImage,
+					Args:  instance.ContainerArgs,
+				},
+			},
+			"restartPolicy": "Always",
+		},
+	}
+
+	bytes, err := json.Marshal(declaration)
+	if err != nil {
+		return "", err
+	}
+
+	return string(bytes), nil
+}
+
+func zoneRegion(zone string) string {
+	i := strings.LastIndex(zone, "-")
+	if i < 0 {
+		return zone
+	}
+	return zone[:i]
+}
+
+func (b *apiBackend) InstanceNetworkIPs(ctx context.Context, zone, instance string) (map[string]string, error) {
+	vm, err := b.compute.Instances.Get(b.project, zone, instance).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("getting compute instance %v: %w", instance, err)
+	}
+
+	ips := map[string]string{}
+	for _, n := range vm.NetworkInterfaces {
+		ips[lastPathElement(n.Network)] = n.NetworkIP
+	}
+
+	return ips, nil
+}
+
+func (b *apiBackend) InstanceStatus(ctx context.Context, zone, instance string) (string, error) {
+	vm, err := b.compute.Instances.Get(b.project, zone, instance).Context(ctx).Do()
+	if err != nil {
+		return "", fmt.Errorf("getting compute instance %v: %w", instance, err)
+	}
+
+	return vm.Status, nil
+}
+
+func (b *apiBackend) DeleteInstance(ctx context.Context, zone, instance string) error {
+	op, err := b.compute.Instances.Delete(b.project, zone, instance).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("deleting compute instance %v: %w", instance, err)
+	}
+
+	return b.waitForComputeOperation(ctx, op)
+}
+
+func (b *apiBackend) waitForComputeOperation(ctx context.Context, op *compute.Operation) error {
+	var err error
+	for op.Status != "DONE" {
+		if op.Zone != "" {
+			op, err = b.compute.ZoneOperations.Wait(b.project, lastPathElement(op.Zone), op.Name).Context(ctx).Do()
+		} else {
+			op, err = b.compute.GlobalOperations.Wait(b.project, op.Name).Context(ctx).Do()
+		}
+		if err != nil {
+			return fmt.Errorf("waiting for compute operation: %w", err)
+		}
+	}
+
+	if op.Error != nil && len(op.Error.Errors) > 0 {
+		messages := []string{}
+		for _, e := range op.Error.Errors {
+			messages = append(messages, e.Message)
+		}
+		return &OperationError{Operation: op.Name, Code: int(op.HttpErrorStatusCode), Message: strings.Join(messages, "; ")}
+	}
+
+	return nil
+}
+
+func (b *apiBackend) PrivateConnections(ctx context.Context, region string) ([]*datastream.PrivateConnection, error) {
+	privateConns := []*datastream.PrivateConnection{}
+	err := b.datastream.Projects.Locations.PrivateConnections.List(locationName(b.project, region)).Pages(ctx, func(page *datastream.ListPrivateConnectionsResponse) error {
+		privateConns = append(privateConns, page.PrivateConnections...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing private connections: %w", err)
+	}
+
+	return privateConns, nil
+}
+
+func (b *apiBackend) CreatePrivateConnection(ctx context.Context, region, id string, connection *datastream.PrivateConnection) error {
+	// the connection is copied so the caller's is left as it was
+	conn := *connection
+	if conn.VpcPeeringConfig != nil && !strings.HasPrefix(conn.VpcPeeringConfig.Vpc, "projects/") {
+		peering := *conn.VpcPeeringConfig
+		peering.Vpc = fmt.Sprintf("projects/%v/global/networks/%v", b.project, peering.Vpc)
+		conn.VpcPeeringConfig = &peering
+	}
+
+	op, err := b.datastream.Projects.Locations.PrivateConnections.Create(locationName(b.project, region), &conn).PrivateConnectionId(id).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("creating private connection %v: %w", id, err)
+	}
+
+	return b.waitForDatastreamOperation(ctx, op)
+}
+
+func (b *apiBackend) DeletePrivateConnection(ctx context.Context, region, id string) error {
+	op, err := b.datastream.Projects.Locations.PrivateConnections.Delete(locationName(b.project, region) + "/privateConnections/" + id).Force(true).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("deleting private connection %v: %w", id, err)
+	}
+
+	return b.waitForDatastreamOperation(ctx, op)
+}
+
+func (b *apiBackend) ConnectionProfiles(ctx context.Context, region string) ([]*datastream.ConnectionProfile, error) {
+	profiles := []*datastream.ConnectionProfile{}
+	err := b.datastream.Projects.Locations.ConnectionProfiles.List(locationName(b.project, region)).Pages(ctx, func(page *datastream.ListConnectionProfilesResponse) error {
+		profiles = append(profiles, page.ConnectionProfiles...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing connection profiles: %w", err)
+	}
+
+	return profiles, nil
+}
+
+func (b *apiBackend) CreateConnectionProfile(ctx context.Context, region, id string, profile *datastream.ConnectionProfile) error {
+	// the profile is copied so the caller's is left as it was
+	p := *profile
+	if p.PrivateConnectivity != nil && !strings.HasPrefix(p.PrivateConnectivity.PrivateConnection, "projects/") {
+		connectivity := *p.PrivateConnectivity
+		connectivity.PrivateConnection = locationName(b.project, region) + "/privateConnections/" + connectivity.PrivateConnection
+		p.PrivateConnectivity = &connectivity
+	}
+
+	op, err := b.datastream.Projects.Locations.ConnectionProfiles.Create(locationName(b.project, region), &p).ConnectionProfileId(id).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("creating connection profile %v: %w", id, err)
+	}
+
+	return b.waitForDatastreamOperation(ctx, op)
+}
+
+func (b *apiBackend) DeleteConnectionProfile(ctx context.Context, region, id string) error {
+	op, err := b.datastream.Projects.Locations.ConnectionProfiles.Delete(locationName(b.project, region) + "/connectionProfiles/" + id).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("deleting connection profile %v: %w", id, err)
+	}
+
+	return b.waitForDatastreamOperation(ctx, op)
+}
+
+func (b *apiBackend) DiscoverPostgres(ctx context.Context, region, profile string) (*datastream.PostgresqlRdbms, error) {
+	resp, err := b.datastream.Projects.Locations.ConnectionProfiles.Discover(locationName(b.project, region), &datastream.DiscoverConnectionProfileRequest{
+		ConnectionProfileName: locationName(b.project, region) + "/connectionProfiles/" + profile,
+		FullHierarchy:         true,
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("discovering connection profile %v: %w", profile, err)
+	}
+	if resp.PostgresqlRdbms == nil {
+		return &datastream.PostgresqlRdbms{}, nil
+	}
+
+	return resp.PostgresqlRdbms, nil
+}
+
+func (b *apiBackend) Regions(ctx context.Context) ([]string, error) {
+	regions := []string{}
+	err := b.datastream.Projects.Locations.List(b.projectName()).Pages(ctx, func(page *datastream.ListLocationsResponse) error {
+		for _, l := range page.Locations {
+			regions = append(regions, l.LocationId)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing datastream locations: %w", err)
+	}
+
+	return regions, nil
+}
+
+func (b *apiBackend) Streams(ctx context.Context, region string) ([]*datastream.Stream, error) {
+	streams := []*datastream.Stream{}
+	err := b.datastream.Projects.Locations.Streams.List(locationName(b.project, region)).Pages(ctx, func(page *datastream.ListStreamsResponse) error {
+		streams = append(streams, page.Streams...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing streams: %w", err)
+	}
+
+	return streams, nil
+}
+
+func (b *apiBackend) GetStream(ctx context.Context, region, id string) (*datastream.Stream, error) {
+	stream, err := b.datastream.Projects.Locations.Streams.Get(locationName(b.project, region) + "/streams/" + id).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("getting stream %v: %w", id, err)
+	}
+
+	return stream, nil
+}
+
+func (b *apiBackend) CreateStream(ctx context.Context, region, id string, stream *datastream.Stream) error {
+	// the stream is copied so the caller's is left as it was
+	s := *stream
+	if s.BackfillAll == nil {
+		s.BackfillNone = &datastream.BackfillNoneStrategy{}
+	}
+
+	op, err := b.datastream.Projects.Locations.Streams.Create(locationName(b.project, region), &s).StreamId(id).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("creating stream %v: %w", id, err)
+	}
+
+	return b.waitForDatastreamOperation(ctx, op)
+}
+
+func (b *apiBackend) UpdateStream(ctx context.Context, region, id string, stream *datastream.Stream, updateMask []string) error {
+	op, err := b.datastream.Projects.Locations.Streams.Patch(locationName(b.project, region)+"/streams/"+id, stream).UpdateMask(strings.Join(updateMask, ",")).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("updating stream %v: %w", id, err)
+	}
+
+	return b.waitForDatastreamOperation(ctx, op)
+}
+
+func (b *apiBackend) DeleteStream(ctx context.Context, region, id string) error {
+	op, err := b.datastream.Projects.Locations.Streams.Delete(locationName(b.project, region) + "/streams/" + id).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("deleting stream %v: %w", id, err)
+	}
+
+	return b.waitForDatastreamOperation(ctx, op)
+}
+
+func (b *apiBackend) StartBackfill(ctx context.Context, region, streamID, schema, table string) error {
+	stream := locationName(b.project, region) + "/streams/" + streamID
+	object, err := b.datastream.Projects.Locations.Streams.Objects.Lookup(stream, &datastream.LookupStreamObjectRequest{
+		SourceObjectIdentifier: &datastream.SourceObjectIdentifier{
+			PostgresqlIdentifier: &datastream.PostgresqlObjectIdentifier{
+				Schema: schema,
+				Table:  table,
+			},
+		},
+	}).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("looking up stream object %v.%v: %w", schema, table, err)
+	}
+
+	_, err = b.datastream.Projects.Locations.Streams.Objects.StartBackfillJob(object.Name, &datastream.StartBackfillJobRequest{}).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("starting backfill of %v.%v: %w", schema, table, err)
+	}
+
+	return nil
+}
+
+func (b *apiBackend) waitForDatastreamOperation(ctx context.Context, op *datastream.Operation) error {
+	var err error
+	for !op.Done {
+		if err := sleep(ctx, operationPollInterval); err != nil {
+			return err
+		}
+		name := op.Name
+		op, err = b.datastream.Projects.Locations.Operations.Get(name).Context(ctx).Do()
+		if err != nil {
+			return fmt.Errorf("getting operation %v: %w", name, err)
+		}
+	}
+
+	if op.Error != nil {
+		return &OperationError{Operation: op.Name, Code: int(op.Error.Code), Message: op.Error.Message}
+	}
+
+	return nil
+}
+
+func (b *apiBackend) SQLInstance(ctx context.Context, instance string) (*sqlInstance, error) {
+	dbInstance, err := b.sqlAdmin.Instances.Get(b.project, instance).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("getting sql instance %v: %w", instance, err)
+	}
+
+	// the fields of sqlInstance are named as in the API
+	bytes, err := json.Marshal(dbInstance)
+	if err != nil {
+		return nil, err
+	}
+	sqlInst := &sqlInstance{}
+	if err := json.Unmarshal(bytes, sqlInst); err != nil {
+		return nil, err
+	}
+
+	return sqlInst, nil
+}
+
+func (b *apiBackend) DatasetExists(ctx context.Context, datasetID string) (bool, error) {
+	return datasetExists(ctx, b.project, datasetID, b.opts...)
+}
+
+func (b *apiBackend) CreateDataset(ctx context.Context, datasetID, location string) error {
+	return createDataset(ctx, b.project, datasetID, location, b.opts...)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
@@ -0,0 +1,345 @@
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"google.golang.org/api/cloudresourcemanager/v1"
+	"google.golang.org/api/datastream/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// newTestAPIBackend returns an API backend sending every request to handler.
+func newTestAPIBackend(t *testing.T, handler http.Handler) Backend {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	original := operationPollInterval
+	operationPollInterval = 0
+	t.Cleanup(func() { operationPollInterval = original })
+
+	backend, err := NewAPIBackend(context.Background(), testProject, option.WithEndpoint(server.URL+"/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("NewAPIBackend: %v", err)
+	}
+	return backend
+}
+
+func writeJSON(t *testing.T, w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		t.Errorf("writing response: %v", err)
+	}
+}
+
+func readJSON(t *testing.T, r *http.Request, v any) {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		t.Errorf("reading request to %v: %v", r.URL.Path, err)
+	}
+}
+
+var testLocation = fmt.Sprintf("/v1/projects/%v/locations/%v", testProject, testRegion)
+
+func TestAPIBackendCreateLeavesArgumentsUnchanged(t *testing.T) {
+	var mu sync.Mutex
+	sent := map[string]json.RawMessage{}
+	record := func(w http.ResponseWriter, r *http.Request) {
+		var body json.RawMessage
+		readJSON(t, r, &body)
+		mu.Lock()
+		sent[r.URL.Path] = body
+		mu.Unlock()
+		writeJSON(t, w, datastream.Operation{Name: "operation", Done: true})
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+testLocation+"/privateConnections", record)
+	mux.HandleFunc("POST "+testLocation+"/connectionProfiles", record)
+	mux.HandleFunc("POST "+testLocation+"/streams", record)
+	backend := newTestAPIBackend(t, mux)
+	ctx := context.Background()
+
+	connection := &datastream.PrivateConnection{
+		DisplayName:      privateConnectionName,
+		VpcPeeringConfig: &datastream.VpcPeeringConfig{Vpc: vpcName, Subnet: datastreamSubnet},
+	}
+	if err := backend.CreatePrivateConnection(ctx, testRegion, privateConnectionName, connection); err != nil {
+		t.Fatalf("CreatePrivateConnection: %v", err)
+	}
+	profile := &datastream.ConnectionProfile{
+		DisplayName:         "postgres-mydb",
+		PrivateConnectivity: &datastream.PrivateConnectivity{PrivateConnection: privateConnectionName},
+		PostgresqlProfile:   &datastream.PostgresqlProfile{Database: "mydb"},
+	}
+	if err := backend.CreateConnectionProfile(ctx, testRegion, "postgres-mydb", profile); err != nil {
+		t.Fatalf("CreateConnectionProfile: %v", err)
+	}
+	stream := &datastream.Stream{DisplayName: "postgres-mydb-bigquery"}
+	if err := backend.CreateStream(ctx, testRegion, "postgres-mydb-bigquery", stream); err != nil {
+		t.Fatalf("CreateStream: %v", err)
+	}
+
+	if connection.VpcPeeringConfig.Vpc != vpcName {
+		t.Errorf("CreatePrivateConnection changed the vpc of the connection to %v", connection.VpcPeeringConfig.Vpc)
+	}
+	if profile.PrivateConnectivity.PrivateConnection != privateConnectionName {
+		t.Errorf("CreateConnectionProfile changed the private connection of the profile to %v", profile.PrivateConnectivity.PrivateConnection)
+	}
+	if stream.BackfillNone != nil {
+		t.Errorf("CreateStream changed the backfill strategy of the stream")
+	}
+
+	sentConnection := &datastream.PrivateConnection{}
+	if err := json.Unmarshal(sent[testLocation+"/privateConnections"], sentConnection); err != nil || sentConnection.VpcPeeringConfig == nil {
+		t.Fatalf("no private connection sent: %v", err)
+	}
+	if want := fmt.Sprintf("projects/%v/global/networks/%v", testProject, vpcName); sentConnection.VpcPeeringConfig.Vpc != want {
+		t.Errorf("sent vpc %v, want %v", sentConnection.VpcPeeringConfig.Vpc, want)
+	}
+	sentProfile := &datastream.ConnectionProfile{}
+	if err := json.Unmarshal(sent[testLocation+"/connectionProfiles"], sentProfile); err != nil || sentProfile.PrivateConnectivity == nil {
+		t.Fatalf("no connection profile sent: %v", err)
+	}
+	if want := testLocation[len("/v1/"):] + "/privateConnections/" + privateConnectionName; sentProfile.PrivateConnectivity.PrivateConnection != want {
+		t.Errorf("sent private connection %v, want %v", sentProfile.PrivateConnectivity.PrivateConnection, want)
+	}
+	sentStream := &datastream.Stream{}
+	if err := json.Unmarshal(sent[testLocation+"/streams"], sentStream); err != nil {
+		t.Fatalf("no stream sent: %v", err)
+	}
+	if sentStream.BackfillNone == nil {
+		t.Errorf("stream without backfill strategy was not sent with backfill none")
+	}
+}
+
+func TestAPIBackendWaitsForFailedOperation(t *testing.T) {
+	polls := 0
+	operation := testLocation[len("/v1/"):] + "/operations/create"
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+testLocation+"/streams", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, datastream.Operation{Name: operation})
+	})
+	mux.HandleFunc("GET "+testLocation+"/operations/create", func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		op := datastream.Operation{Name: operation, Done: polls > 1}
+		if op.Done {
+			op.Error = &datastream.Status{Code: 9, Message: "source profile is not ready"}
+		}
+		writeJSON(t, w, op)
+	})
+	backend := newTestAPIBackend(t, mux)
+
+	err := backend.CreateStream(context.Background(), testRegion, "postgres-mydb-bigquery", &datastream.Stream{})
+
+	opErr := &OperationError{}
+	if !errors.As(err, &opErr) {
+		t.Fatalf("CreateStream returned %v, want an OperationError", err)
+	}
+	if opErr.Code != 9 || opErr.Message != "source profile is not ready" {
+		t.Errorf("got operation error %+v", opErr)
+	}
+	if polls != 2 {
+		t.Errorf("operation polled %v times, want until done after 2", polls)
+	}
+}
+
+func TestAPIBackendReturnsAPIErrors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+testLocation+"/streams/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		writeJSON(t, w, map[string]any{"error": map[string]any{"code": 404, "message": "stream not found"}})
+	})
+	backend := newTestAPIBackend(t, mux)
+
+	_, err := backend.GetStream(context.Background(), testRegion, "missing")
+
+	apiErr := &googleapi.Error{}
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("GetStream returned %v, want a googleapi.Error", err)
+	}
+	if apiErr.Code != http.StatusNotFound {
+		t.Errorf("got status %v, want %v", apiErr.Code, http.StatusNotFound)
+	}
+}
+
+func TestAPIBackendListsEveryPage(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+testLocation+"/streams", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("pageToken") == "" {
+			writeJSON(t, w, datastream.ListStreamsResponse{Streams: []*datastream.Stream{{Name: "first"}}, NextPageToken: "next"})
+			return
+		}
+		writeJSON(t, w, datastream.ListStreamsResponse{Streams: []*datastream.Stream{{Name: "second"}}})
+	})
+	backend := newTestAPIBackend(t, mux)
+
+	streams, err := backend.Streams(context.Background(), testRegion)
+	if err != nil {
+		t.Fatalf("Streams: %v", err)
+	}
+	if len(streams) != 2 || streams[0].Name != "first" || streams[1].Name != "second" {
+		t.Errorf("got streams %v, want first and second", streams)
+	}
+}
+
+// iamTestBackend returns an API backend for a project with the given policy
+// bindings, and a function returning the policy set since, or nil.
+func iamTestBackend(t *testing.T, bindings []*cloudresourcemanager.Binding) (Backend, func() *cloudresourcemanager.Policy) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var set *cloudresourcemanager.Policy
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/projects/"+testProject+":getIamPolicy", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, cloudresourcemanager.Policy{Etag: "etag", Bindings: bindings})
+	})
+	mux.HandleFunc("POST /v1/projects/"+testProject+":setIamPolicy", func(w http.ResponseWriter, r *http.Request) {
+		req := &cloudresourcemanager.SetIamPolicyRequest{}
+		readJSON(t, r, req)
+		mu.Lock()
+		set = req.Policy
+		mu.Unlock()
+		writeJSON(t, w, req.Policy)
+	})
+
+	return newTestAPIBackend(t, mux), func() *cloudresourcemanager.Policy {
+		mu.Lock()
+		defer mu.Unlock()
+		return set
+	}
+}
+
+// bindingMembers returns the members of the bindings by role, with the
+// conditional bindings under the role followed by a question mark.
+func bindingMembers(bindings []*cloudresourcemanager.Binding) map[string][]string {
+	members := map[string][]string{}
+	for _, b := range bindings {
+		role := b.Role
+		if b.Condition != nil {
+			role += "?"
+		}
+		members[role] = append(members[role], b.Members...)
+	}
+	return members
+}
+
+func TestAPIBackendRoleBindings(t *testing.T) {
+	member := "serviceAccount:datastream@" + testProject + ".iam.gserviceaccount.com"
+	other := "user:someone@nav.no"
+	condition := &cloudresourcemanager.Expr{Expression: "request.time < timestamp('2030-01-01T00:00:00Z')"}
+
+	for _, tc := range []struct {
+		name     string
+		remove   bool
+		bindings []*cloudresourcemanager.Binding
+		// want is the members by role of the policy set, or nil when the
+		// policy is left unchanged
+		want map[string][]string
+	}{
+		{
+			name:     "add to existing binding",
+			bindings: []*cloudresourcemanager.Binding{{Role: cloudSQLClientRole, Members: []string{other}}},
+			want:     map[string][]string{cloudSQLClientRole: {other, member}},
+		},
+		{
+			name:     "add new binding",
+			bindings: []*cloudresourcemanager.Binding{{Role: cloudSQLClientRole, Members: []string{other}, Condition: condition}},
+			want:     map[string][]string{cloudSQLClientRole + "?": {other}, cloudSQLClientRole: {member}},
+		},
+		{
+			name:     "add existing member",
+			bindings: []*cloudresourcemanager.Binding{{Role: cloudSQLClientRole, Members: []string{member}}},
+		},
+		{
+			name:     "remove from shared binding",
+			remove:   true,
+			bindings: []*cloudresourcemanager.Binding{{Role: cloudSQLClientRole, Members: []string{other, member}}},
+			want:     map[string][]string{cloudSQLClientRole: {other}},
+		},
+		{
+			name:   "remove last member",
+			remove: true,
+			bindings: []*cloudresourcemanager.Binding{
+				{Role: cloudSQLClientRole, Members: []string{member}},
+				{Role: "roles/viewer", Members: []string{member}},
+			},
+			want: map[string][]string{"roles/viewer": {member}},
+		},
+		{
+			name:   "remove missing member",
+			remove: true,
+			bindings: []*cloudresourcemanager.Binding{
+				{Role: cloudSQLClientRole, Members: []string{other}},
+				{Role: cloudSQLClientRole, Members: []string{member}, Condition: condition},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			backend, set := iamTestBackend(t, tc.bindings)
+
+			var err error
+			if tc.remove {
+				err = backend.RemoveRoleBinding(context.Background(), member, cloudSQLClientRole)
+			} else {
+				err = backend.AddRoleBinding(context.Background(), member, cloudSQLClientRole)
+			}
+			if err != nil {
+				t.Fatalf("changing role binding: %v", err)
+			}
+
+			policy := set()
+			if tc.want == nil {
+				if policy != nil {
+					t.Errorf("policy set to %+v, want it unchanged", bindingMembers(policy.Bindings))
+				}
+				return
+			}
+			if policy == nil {
+				t.Fatal("no policy was set")
+			}
+			if policy.Etag != "etag" {
+				t.Errorf("policy set with etag %q, want the one it was read with", policy.Etag)
+			}
+			if got := bindingMembers(policy.Bindings); fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("policy set with members %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAPIBackendSQLInstance(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/projects/"+testProject+"/instances/app-instance", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, map[string]any{
+			"name":            "app-instance",
+			"databaseVersion": "POSTGRES_15",
+			"settings": map[string]any{
+				"storageAutoResize": false,
+				"databaseFlags":     []map[string]string{{"name": logicalDecodingFlag, "value": "on"}},
+			},
+		})
+	})
+	backend := newTestAPIBackend(t, mux)
+
+	instance, err := backend.SQLInstance(context.Background(), "app-instance")
+	if err != nil {
+		t.Fatalf("SQLInstance: %v", err)
+	}
+	if v := instance.postgresVersion(); v != 15 {
+		t.Errorf("got postgres version %v, want 15", v)
+	}
+	if value, ok := instance.flag(logicalDecodingFlag); !ok || value != "on" {
+		t.Errorf("got flag %v=%q, want on", logicalDecodingFlag, value)
+	}
+	if instance.Settings.StorageAutoResize == nil || *instance.Settings.StorageAutoResize {
+		t.Errorf("disk autoresize is not reported as off")
+	}
+}
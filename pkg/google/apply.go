@@ -0,0 +1,71 @@
+package google
+
+import (
+	"context"
+)
+
+// Apply makes the stream match the config. A stream that does not exist is
+// created along with the resources it depends on, resuming an unfinished run
+// with Resume, while an existing stream is updated, and started if it should
+// be but has not been.
+func (g *Google) Apply(ctx context.Context) error {
+	streamName := generateNameFunc[DATASTREAM](g)
+	exists, err := g.streamExists(ctx, streamName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if g.Resume {
+			// --resume applies to every stream in the file, so the streams
+			// without an unfinished run are created as usual
+			run, err := g.loadJournal()
+			if err != nil {
+				return err
+			}
+			g.Resume = run != nil
+		}
+		return g.CreateResources(ctx)
+	}
+
+	if err := g.UpdateStream(ctx); err != nil {
+		return err
+	}
+
+	if !g.Start {
+		return nil
+	}
+	stream, err := g.backend.GetStream(ctx, g.Region, streamName)
+	if err != nil {
+		return err
+	}
+	if stream.State == StreamNotStarted {
+		return g.StartStream(ctx)
+	}
+	return nil
+}
+
+// PlanApply returns what Apply would do, without changing anything.
+func (g *Google) PlanApply(ctx context.Context) (*Plan, error) {
+	streamName := generateNameFunc[DATASTREAM](g)
+	exists, err := g.streamExists(ctx, streamName)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return g.PlanCreate(ctx)
+	}
+
+	update, err := g.PlanStreamUpdate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{}
+	if len(update.Fields) == 0 {
+		plan.add(DATASTREAM, streamName, ActionSkip, "up to date")
+	} else {
+		plan.add(DATASTREAM, streamName, ActionUpdate, "")
+		plan.Update = update
+	}
+	return plan, nil
+}
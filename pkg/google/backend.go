@@ -0,0 +1,109 @@
+package google
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/api/datastream/v1"
+)
+
+const (
+	BackendGcloud = "gcloud"
+	BackendAPI    = "api"
+)
+
+// Backend performs the Google Cloud operations the managed resources are built
+// from. Datastream resources are described with the Datastream REST API types
+// regardless of how the backend talks to Google.
+type Backend interface {
+	EnabledServices(ctx context.Context) ([]string, error)
+	EnableService(ctx context.Context, service string) error
+	DisableService(ctx context.Context, service string) error
+
+	Networks(ctx context.Context) ([]string, error)
+	CreateNetwork(ctx context.Context, network string) error
+	DeleteNetwork(ctx context.Context, network string) error
+
+	FirewallRules(ctx context.Context) ([]string, error)
+	CreateFirewallRule(ctx context.Context, rule FirewallRule) error
+	DeleteFirewallRule(ctx context.Context, rule string) error
+
+	ServiceAccounts(ctx context.Context) ([]string, error)
+	CreateServiceAccount(ctx context.Context, accountID, displayName, description string) error
+	DeleteServiceAccount(ctx context.Context, email string) error
+	MemberRoles(ctx context.Context, member string) ([]string, error)
+	AddRoleBinding(ctx context.Context, member, role string) error
+	RemoveRoleBinding(ctx context.Context, member, role string) error
+
+	Instances(ctx context.Context) ([]string, error)
+	CreateProxyInstance(ctx context.Context, instance ProxyInstance) error
+	InstanceNetworkIPs(ctx context.Context, zone, instance string) (map[string]string, error)
+	InstanceStatus(ctx context.Context, zone, instance string) (string, error)
+	DeleteInstance(ctx context.Context, zone, instance string) error
+
+	PrivateConnections(ctx context.Context, region string) ([]*datastream.PrivateConnection, error)
+	CreatePrivateConnection(ctx context.Context, region, id string, connection *datastream.PrivateConnection) error
+	DeletePrivateConnection(ctx context.Context, region, id string) error
+
+	ConnectionProfiles(ctx context.Context, region string) ([]*datastream.ConnectionProfile, error)
+	CreateConnectionProfile(ctx context.Context, region, id string, profile *datastream.ConnectionProfile) error
+	DeleteConnectionProfile(ctx context.Context, region, id string) error
+	// DiscoverPostgres returns the schemas, tables and columns visible through a postgres connection profile.
+	DiscoverPostgres(ctx context.Context, region, profile string) (*datastream.PostgresqlRdbms, error)
+
+	// Regions returns the regions Datastream is available in.
+	Regions(ctx context.Context) ([]string, error)
+	Streams(ctx context.Context, region string) ([]*datastream.Stream, error)
+	GetStream(ctx context.Context, region, id string) (*datastream.Stream, error)
+	CreateStream(ctx context.Context, region, id string, stream *datastream.Stream) error
+	// UpdateStream overwrites the fields of the stream listed in updateMask with the values in stream.
+	UpdateStream(ctx context.Context, region, id string, stream *datastream.Stream, updateMask []string) error
+	DeleteStream(ctx context.Context, region, id string) error
+	// StartBackfill starts a backfill job for a single table of the stream.
+	StartBackfill(ctx context.Context, region, streamID, schema, table string) error
+
+	// SQLInstance returns the settings of a Cloud SQL instance.
+	SQLInstance(ctx context.Context, instance string) (*sqlInstance, error)
+
+	DatasetExists(ctx context.Context, datasetID string) (bool, error)
+	CreateDataset(ctx context.Context, datasetID, location string) error
+}
+
+// FirewallRule is an ingress rule allowing traffic from SourceRange to Port on Network.
+type FirewallRule struct {
+	Name        string
+	Network     string
+	SourceRange string
+	Protocol    string
+	Port        string
+}
+
+// ProxyInstance is a compute instance running a single container.
+type ProxyInstance struct {
+	Name             string
+	Zone             string
+	MachineType      string
+	ServiceAccount   string
+	Network          string
+	Subnet           string
+	ContainerImage   string
+	ContainerArgs    []string
+	DiskImageProject string
+	DiskImageFamily  string
+	Labels           map[string]string
+}
+
+// OperationError is returned when a long-running operation completes unsuccessfully.
+type OperationError struct {
+	Operation string
+	Code      int
+	Message   string
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("operation %v failed with code %v: %v", e.Operation, e.Code, e.Message)
+}
+
+func locationName(project, region string) string {
+	return fmt.Sprintf("projects/%v/locations/%v", project, region)
+}
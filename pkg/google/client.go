@@ -1,13 +1,8 @@
 package google
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
-	"os"
-	"os/exec"
 	"time"
 
 	"github.com/navikt/nada-datastream/cmd"
@@ -18,45 +13,39 @@ const (
 	gcloudTimeout = 45 * time.Minute
 )
 
+// pollInterval is how long to wait between checks of resources that are not yet ready.
+var pollInterval = 30 * time.Second
+
 type Google struct {
-	log *logrus.Entry
+	log     *logrus.Entry
+	backend Backend
 	*cmd.Config
 }
 
-func New(log *logrus.Entry, cfg *cmd.Config) *Google {
-	return &Google{
-		log:    log,
-		Config: cfg,
+// New returns a Google using the backend selected in cfg.
+func New(ctx context.Context, log *logrus.Entry, cfg *cmd.Config) (*Google, error) {
+	switch cfg.Backend {
+	case "", BackendGcloud:
+		return NewWithExecutor(log, cfg, GcloudExecutor{}), nil
+	case BackendAPI:
+		backend, err := NewAPIBackend(ctx, cfg.Project)
+		if err != nil {
+			return nil, err
+		}
+		return NewWithBackend(log, cfg, backend), nil
+	default:
+		return nil, fmt.Errorf("unknown backend %q, should be either %v or %v", cfg.Backend, BackendGcloud, BackendAPI)
 	}
 }
 
-func (g *Google) performRequest(ctx context.Context, args []string, out interface{}) error {
-	if out == nil {
-		out = []map[string]interface{}{}
-	}
-
-	args = append(args, fmt.Sprintf("--project=%v", g.Project))
-	args = append(args, "--format=json")
-
-	ctxWithTimeout, cancel := context.WithTimeout(ctx, gcloudTimeout)
-	cmd := exec.CommandContext(
-		ctxWithTimeout,
-		"gcloud",
-		args...,
-	)
-	defer cancel()
-
-	buf := &bytes.Buffer{}
-	cmd.Stdout = buf
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		io.Copy(os.Stdout, buf)
-		return err
-	}
+func NewWithExecutor(log *logrus.Entry, cfg *cmd.Config, executor Executor) *Google {
+	return NewWithBackend(log, cfg, NewGcloudBackend(executor, cfg.Project))
+}
 
-	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
-		return err
+func NewWithBackend(log *logrus.Entry, cfg *cmd.Config, backend Backend) *Google {
+	return &Google{
+		log:     log,
+		backend: backend,
+		Config:  cfg,
 	}
-
-	return nil
 }
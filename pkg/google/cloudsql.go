@@ -3,50 +3,113 @@ package google
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"strings"
+
+	"github.com/navikt/nada-datastream/cmd"
 )
 
 const (
 	proxyVMNamePrefix      = "datastream-"
+	proxyZone              = "europe-north1-b"
 	cloudsqlContainerImage = "gcr.io/cloud-sql-connectors/cloud-sql-proxy:2.1.1-alpine"
 	machineType            = "n1-standard-1"
 	serviceAccountName     = "datastream"
+	cloudSQLClientRole     = "roles/cloudsql.client"
+	logicalDecodingFlag    = "cloudsql.logical_decoding"
+	// minPostgresVersion is the first major version of postgres with the pgoutput plugin.
+	minPostgresVersion = 10
 )
 
 type sqlInstance struct {
-	Name        string              `json:"name"`
-	IpAddresses []map[string]string `json:"ipAddresses"`
-	Settings    struct {
-		DatabaseFlags []map[string]string `json:"databaseFlags"`
+	Name            string              `json:"name"`
+	DatabaseVersion string              `json:"databaseVersion"`
+	IpAddresses     []map[string]string `json:"ipAddresses"`
+	Settings        struct {
+		DatabaseFlags     []map[string]string `json:"databaseFlags"`
+		StorageAutoResize *bool               `json:"storageAutoResize"`
 	} `json:"settings"`
 }
 
-func (g *Google) SAID(sa string) string {
-	return fmt.Sprintf("%v@%v.iam.gserviceaccount.com", sa, g.Project)
+// flag returns the value of a database flag, and whether it is set.
+func (s *sqlInstance) flag(name string) (string, bool) {
+	for _, f := range s.Settings.DatabaseFlags {
+		if f["name"] == name {
+			return f["value"], true
+		}
+	}
+	return "", false
 }
 
-func (g Google) saExists(ctx context.Context, serviceAccount string) (bool, error) {
-	type SA struct {
-		Email string `json:"email"`
+// postgresVersion returns the major version of postgres the instance runs, or
+// 0 when it doesn't run postgres.
+func (s *sqlInstance) postgresVersion() int {
+	version, found := strings.CutPrefix(s.DatabaseVersion, "POSTGRES_")
+	if !found {
+		return 0
 	}
-	sas := []*SA{}
+	major, err := strconv.Atoi(strings.Split(version, "_")[0])
+	if err != nil {
+		return 0
+	}
+	return major
+}
 
-	err := g.performRequest(ctx, []string{
-		"iam",
-		"service-accounts",
-		"list",
-	}, &sas)
+// CheckSQLInstance checks that the settings of the Cloud SQL instance allow
+// datastream to read from it, and fails with how to change them in the nais
+// manifest of the app when they don't.
+func (g *Google) CheckSQLInstance(ctx context.Context) error {
+	g.log.Infof("Checking Cloud SQL instance %v...", g.Instance)
+	instance, err := g.backend.SQLInstance(ctx, g.Instance)
 	if err != nil {
-		return false, err
+		return err
 	}
 
-	for _, sa := range sas {
-		if sa.Email == g.SAID(serviceAccount) {
-			return true, nil
-		}
+	version := instance.postgresVersion()
+	if version == 0 {
+		// changing the type of an existing instance doesn't migrate it
+		return fmt.Errorf("the Cloud SQL instance %v runs %v and is not a postgres instance, datastream only reads from postgres\nuse --%v to skip checking the instance",
+			g.Instance, instance.DatabaseVersion, cmd.SkipInstanceCheck)
+	}
+
+	problems := []string{}
+	manifest := []string{fmt.Sprintf("      - name: %v", g.Instance)}
+
+	if version < minPostgresVersion {
+		problems = append(problems, fmt.Sprintf("the instance runs %v, datastream needs postgres %v or later for pgoutput", instance.DatabaseVersion, minPostgresVersion))
+		manifest = append(manifest, "        type: POSTGRES_17")
+	}
+	if instance.Settings.StorageAutoResize != nil && !*instance.Settings.StorageAutoResize {
+		problems = append(problems, "disk autoresize is off, and the disk fills up if datastream falls behind")
+		manifest = append(manifest, "        diskAutoresize: true")
+	}
+	if value, ok := instance.flag(logicalDecodingFlag); !ok || !strings.EqualFold(value, "on") {
+		problems = append(problems, fmt.Sprintf("the database flag %v is not on", logicalDecodingFlag))
+		manifest = append(manifest,
+			"        flags:",
+			"          - name: "+logicalDecodingFlag,
+			`            value: "on"`,
+		)
 	}
 
-	return false, nil
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("the Cloud SQL instance %v is not ready for datastream:\n  %v\n\nchange the nais manifest of the app (changing flags restarts the database):\nspec:\n  gcp:\n    sqlInstances:\n%v\nuse --%v to skip checking the instance",
+		g.Instance, strings.Join(problems, "\n  "), strings.Join(manifest, "\n"), cmd.SkipInstanceCheck)
+}
+
+func (g *Google) SAID(sa string) string {
+	return fmt.Sprintf("%v@%v.iam.gserviceaccount.com", sa, g.Project)
+}
+
+func (g Google) saExists(ctx context.Context, serviceAccount string) (bool, error) {
+	sas, err := g.backend.ServiceAccounts(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return contains(sas, g.SAID(serviceAccount)), nil
 }
 
 func (g Google) createSAAndGrantRoles(ctx context.Context, serviceAccount string) error {
@@ -59,14 +122,7 @@ func (g Google) createSAAndGrantRoles(ctx context.Context, serviceAccount string
 }
 
 func (g Google) createSA(ctx context.Context, serviceAccount string) error {
-	err := g.performRequest(ctx, []string{
-		"iam",
-		"service-accounts",
-		"create",
-		serviceAccount,
-		`--description="Datastream service account"`,
-		"--display-name=datastream",
-	}, map[string]string{})
+	err := g.backend.CreateServiceAccount(ctx, serviceAccount, "datastream", "Datastream service account")
 	if err != nil {
 		return err
 	}
@@ -75,7 +131,7 @@ func (g Google) createSA(ctx context.Context, serviceAccount string) error {
 }
 
 func (g *Google) grantSARoles(ctx context.Context, serviceAccount string) error {
-	exists, err := g.rolebindingsExist(ctx, "roles/cloudsql.client")
+	exists, err := g.rolebindingsExist(ctx, serviceAccount, cloudSQLClientRole)
 	if err != nil {
 		return err
 	}
@@ -84,14 +140,7 @@ func (g *Google) grantSARoles(ctx context.Context, serviceAccount string) error
 	}
 
 	g.log.Infof("Granting CloudSQL Client role to VM service account...")
-	err = g.performRequest(ctx, []string{
-		"projects",
-		"add-iam-policy-binding",
-		g.Project,
-		fmt.Sprintf("--member=serviceAccount:%v", g.SAID(serviceAccount)),
-		"--role=roles/cloudsql.client",
-		"--condition=None",
-	}, nil)
+	err = g.backend.AddRoleBinding(ctx, "serviceAccount:"+g.SAID(serviceAccount), cloudSQLClientRole)
 	if err != nil {
 		return err
 	}
@@ -99,53 +148,35 @@ func (g *Google) grantSARoles(ctx context.Context, serviceAccount string) error
 	return nil
 }
 
-func (g *Google) rolebindingsExist(ctx context.Context, role string) (bool, error) {
-	type iamPolicy struct {
-		Bindings struct {
-			Role string `json:"role"`
-		} `json:"bindings"`
-	}
-	iamPolicies := []*iamPolicy{}
-
-	err := g.performRequest(ctx, []string{
-		"projects",
-		"get-iam-policy",
-		g.Project,
-		"--flatten=bindings[].members",
-		fmt.Sprintf("--filter=bindings.members=serviceAccount:datastream@%v.iam.gserviceaccount.com", g.Project),
-	}, &iamPolicies)
+func (g *Google) rolebindingsExist(ctx context.Context, serviceAccount, role string) (bool, error) {
+	roles, err := g.backend.MemberRoles(ctx, "serviceAccount:"+g.SAID(serviceAccount))
 	if err != nil {
 		return false, err
 	}
 
-	for _, b := range iamPolicies {
-		if b.Bindings.Role == role {
-			return true, nil
-		}
-	}
-
-	return false, nil
+	return contains(roles, role), nil
 }
 
 func (g Google) createCloudSQLProxy(ctx context.Context, proxyName string) error {
 	g.log.Infof("Creating CloudSQL proxy VM...")
 	said := g.SAID(generateNameFunc[SERVICE_ACCOUNT](&g))
 	vpcid := generateNameFunc[VPC](&g)
-	err := g.performRequest(ctx, []string{
-		"compute",
-		"instances",
-		"create-with-container",
-		proxyName,
-		fmt.Sprintf("--machine-type=%v", machineType),
-		"--zone=europe-north1-b",
-		fmt.Sprintf("--service-account=%v", said),
-		"--create-disk=image-project=debian-cloud,image-family=debian-11",
-		"--scopes=cloud-platform",
-		fmt.Sprintf("--network-interface=network=%v,subnet=%v", vpcid, vpcid),
-		fmt.Sprintf("--container-image=%v", cloudsqlContainerImage),
-		fmt.Sprintf(`--container-arg=%v:%v:%v?port=5432`, g.Project, g.Region, g.Instance),
-		`--container-arg=--address=0.0.0.0`,
-	}, nil)
+	err := g.backend.CreateProxyInstance(ctx, ProxyInstance{
+		Name:           proxyName,
+		Zone:           proxyZone,
+		MachineType:    machineType,
+		ServiceAccount: said,
+		Network:        vpcid,
+		Subnet:         vpcid,
+		ContainerImage: cloudsqlContainerImage,
+		ContainerArgs: []string{
+			fmt.Sprintf("%v:%v:%v?port=5432", g.Project, g.Region, g.Instance),
+			"--address=0.0.0.0",
+		},
+		DiskImageProject: "debian-cloud",
+		DiskImageFamily:  "debian-11",
+		Labels:           g.labels(),
+	})
 	if err != nil {
 		return err
 	}
@@ -154,61 +185,26 @@ func (g Google) createCloudSQLProxy(ctx context.Context, proxyName string) error
 }
 
 func (g Google) cloudSQLProxyExists(ctx context.Context, proxyVMName string) (bool, error) {
-	type ComputeInstance struct {
-		Name string `json:"name"`
-	}
-	instances := []*ComputeInstance{}
-
-	err := g.performRequest(ctx, []string{
-		"compute",
-		"instances",
-		"list",
-	}, &instances)
+	instances, err := g.backend.Instances(ctx)
 	if err != nil {
 		return false, err
 	}
 
-	for _, i := range instances {
-		if i.Name == proxyVMName {
-			return true, nil
-		}
-	}
-
-	return false, nil
+	return contains(instances, proxyVMName), nil
 }
 
 func (g *Google) getProxyIP(ctx context.Context, vmName string) (string, error) {
-	type DBInstance struct {
-		NetworkInterfaces []struct {
-			Network   string `json:"network"`
-			NetworkIP string `json:"networkIP"`
-		} `json:"networkInterfaces"`
-		Metadata struct {
-			Items []map[string]string `json:"items"`
-		} `json:"metadata"`
-	}
-	instance := DBInstance{}
-
-	err := g.performRequest(ctx, []string{
-		"compute",
-		"instances",
-		"describe",
-		vmName,
-		"--zone=europe-north1-b",
-	}, &instance)
+	ips, err := g.backend.InstanceNetworkIPs(ctx, proxyZone, vmName)
 	if err != nil {
 		return "", err
 	}
 
-	if len(instance.NetworkInterfaces) == 0 {
+	if len(ips) == 0 {
 		return "", fmt.Errorf("datastream compute instance does not exist in project %v", g.Project)
 	}
 
-	for _, n := range instance.NetworkInterfaces {
-		nParts := strings.Split(n.Network, "/")
-		if nParts[len(nParts)-1] == vpcName {
-			return n.NetworkIP, nil
-		}
+	if ip, ok := ips[vpcName]; ok {
+		return ip, nil
 	}
 
 	return "", fmt.Errorf("datastream compute instance does not have expected network interface %v", vpcName)
@@ -216,35 +212,16 @@ func (g *Google) getProxyIP(ctx context.Context, vmName string) (string, error)
 
 func (g Google) deleteCloudSQLProxy(ctx context.Context, proxyVMName string) error {
 	g.log.Infof("Deleting CloudSQL proxy VM...")
-	return g.performRequest(ctx, []string{
-		"compute",
-		"instances",
-		"delete",
-		proxyVMName,
-		"--zone=europe-north1-b",
-		"--quiet",
-	}, nil)
+	return g.backend.DeleteInstance(ctx, proxyZone, proxyVMName)
 }
 
 func (g *Google) removeSARoles(ctx context.Context) error {
 	g.log.Infof("Remove CloudSQL Client role with VM service account...")
 	said := g.SAID(generateNameFunc[SERVICE_ACCOUNT](g))
-	return g.performRequest(ctx, []string{
-		"projects",
-		"remove-iam-policy-binding",
-		g.Project,
-		fmt.Sprintf("--member=serviceAccount:%v", said),
-		"--role=roles/cloudsql.client",
-		"--condition=None",
-	}, nil)
+	return g.backend.RemoveRoleBinding(ctx, "serviceAccount:"+said, cloudSQLClientRole)
 }
 
 func (g Google) deleteSA(ctx context.Context, serviceAccount string) error {
 	g.log.Infof("Deleting IAM service account for VM...")
-	return g.performRequest(ctx, []string{
-		"iam",
-		"service-accounts",
-		"delete",
-		g.SAID(serviceAccount),
-	}, nil)
+	return g.backend.DeleteServiceAccount(ctx, g.SAID(serviceAccount))
 }
@@ -0,0 +1,68 @@
+package google
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCheckSQLInstance(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		instance string
+		problems []string
+		// notPostgres is set for instances datastream can't read from at
+		// all, which a change to the manifest doesn't fix
+		notPostgres bool
+	}{
+		{
+			name:     "ready",
+			instance: `{"databaseVersion": "POSTGRES_15", "settings": {"storageAutoResize": true, "databaseFlags": [{"name": "cloudsql.logical_decoding", "value": "on"}]}}`,
+		},
+		{
+			name:     "without logical decoding",
+			instance: `{"databaseVersion": "POSTGRES_15", "settings": {"databaseFlags": [{"name": "cloudsql.logical_decoding", "value": "off"}]}}`,
+			problems: []string{logicalDecodingFlag, `value: "on"`},
+		},
+		{
+			name:     "old postgres without autoresize",
+			instance: `{"databaseVersion": "POSTGRES_9_6", "settings": {"storageAutoResize": false, "databaseFlags": [{"name": "cloudsql.logical_decoding", "value": "on"}]}}`,
+			problems: []string{"POSTGRES_9_6", "type: POSTGRES_17", "diskAutoresize: true"},
+		},
+		{
+			name:        "mysql",
+			instance:    `{"databaseVersion": "MYSQL_8_0", "settings": {"storageAutoResize": false}}`,
+			problems:    []string{"MYSQL_8_0", "not a postgres instance"},
+			notPostgres: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g, project := newTestGoogle(t)
+			project.respond(tc.instance, "sql", "instances", "describe", "app-instance")
+
+			err := g.CheckSQLInstance(context.Background())
+
+			if len(tc.problems) == 0 {
+				if err != nil {
+					t.Errorf("CheckSQLInstance: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("CheckSQLInstance succeeded for an instance that is not ready")
+			}
+			if tc.notPostgres {
+				if strings.Contains(err.Error(), "manifest") {
+					t.Errorf("error suggests changing the manifest:\n%v", err)
+				}
+			} else if !strings.HasPrefix(err.Error(), "the Cloud SQL instance app-instance is not ready") {
+				t.Errorf("got error %q, want it to start with the instance not being ready", err)
+			}
+			for _, p := range append(tc.problems, "--skip-instance-check") {
+				if !strings.Contains(err.Error(), p) {
+					t.Errorf("error does not mention %q:\n%v", p, err)
+				}
+			}
+		})
+	}
+}
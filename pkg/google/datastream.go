@@ -2,16 +2,15 @@ package google
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"os"
+	"sort"
 	"strings"
-	"time"
 
 	"cloud.google.com/go/bigquery"
+	"google.golang.org/api/datastream/v1"
 	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
 )
 
 const (
@@ -20,54 +19,60 @@ const (
 	firewallRuleName      = "allow-datastream-cloudsql-proxy"
 )
 
+func (g *Google) connectionProfileName(profile string) string {
+	return fmt.Sprintf("projects/%v/locations/%v/connectionProfiles/%v", g.Project, g.Region, profile)
+}
+
 func (g Google) createStream(ctx context.Context, streamName string) error {
 	pgConfig, err := g.createPostgresStreamConfig(ctx)
 	if err != nil {
 		return err
 	}
-	defer deleteTempFile(pgConfig)
 
 	bqConfig, err := g.createBigQueryStreamConfig(ctx)
 	if err != nil {
 		return err
 	}
-	defer deleteTempFile(bqConfig)
 
 	g.log.Info("Creating datastream...")
-	err = g.performRequest(ctx, []string{
-		"datastream",
-		"streams",
-		"create",
-		streamName,
-		fmt.Sprintf("--display-name=%v", streamName),
-		fmt.Sprintf("--location=%v", g.Region),
-		fmt.Sprintf("--source=projects/%v/locations/%v/connectionProfiles/postgres-%v", g.Project, g.Region, g.DB),
-		fmt.Sprintf("--postgresql-source-config=%v", pgConfig),
-		fmt.Sprintf("--destination=projects/%v/locations/%v/connectionProfiles/bigquery-%v", g.Project, g.Region, g.DB),
-		fmt.Sprintf("--bigquery-destination-config=%v", bqConfig),
-		"--backfill-all",
-		"--labels=created-by=nada",
-	}, nil)
+	err = g.backend.CreateStream(ctx, g.Region, streamName, g.streamSpec(streamName, pgConfig, bqConfig))
 	if err != nil {
 		return err
 	}
 
-	g.log.Infof("Gå til https://console.cloud.google.com/datastream/streams?referrer=search&project=%v for å aktivere streamen %v", g.Project, streamName)
+	if !g.Start {
+		g.log.Infof("Gå til https://console.cloud.google.com/datastream/streams?referrer=search&project=%v for å aktivere streamen %v, eller kjør nada-datastream start", g.Project, streamName)
+	}
 	return nil
 }
 
+// streamSpec returns the stream that is sent to Datastream when the stream is created.
+func (g *Google) streamSpec(streamName string, pgConfig *datastream.PostgresqlSourceConfig, bqConfig *datastream.BigQueryDestinationConfig) *datastream.Stream {
+	return &datastream.Stream{
+		DisplayName: streamName,
+		SourceConfig: &datastream.SourceConfig{
+			SourceConnectionProfile: g.connectionProfileName(generateNameFunc[SOURCE_PROFILE](g)),
+			PostgresqlSourceConfig:  pgConfig,
+		},
+		DestinationConfig: &datastream.DestinationConfig{
+			DestinationConnectionProfile: g.connectionProfileName(generateNameFunc[DESTINATION_PROFILE](g)),
+			BigqueryDestinationConfig:    bqConfig,
+		},
+		BackfillAll: &datastream.BackfillAllStrategy{},
+		Labels:      g.labels(),
+	}
+}
+
 func (g Google) createPrivateConnection(ctx context.Context, connection string) error {
 	g.log.Infof("Creating Datastream private connection...")
-	err := g.performRequest(ctx, []string{
-		"datastream",
-		"private-connections",
-		"create",
-		connection,
-		fmt.Sprintf("--display-name=%v", privateConnectionName),
-		fmt.Sprintf("--vpc=%v", vpcName),
-		fmt.Sprintf("--subnet=%v", datastreamSubnet),
-		fmt.Sprintf("--location=%v", g.Region),
-	}, nil)
+	err := g.backend.CreatePrivateConnection(ctx, g.Region, connection, &datastream.PrivateConnection{
+		DisplayName: privateConnectionName,
+		VpcPeeringConfig: &datastream.VpcPeeringConfig{
+			Vpc:    vpcName,
+			Subnet: datastreamSubnet,
+		},
+		Labels: g.labels(),
+	})
 	if err != nil {
 		return err
 	}
@@ -80,17 +85,7 @@ func (g Google) createPrivateConnection(ctx context.Context, connection string)
 }
 
 func (g Google) privateConnectionExists(ctx context.Context, privateConnection string) (bool, error) {
-	type privateConn struct {
-		Name string `json:"name"`
-	}
-	privateCons := []*privateConn{}
-
-	err := g.performRequest(ctx, []string{
-		"datastream",
-		"private-connections",
-		"list",
-		fmt.Sprintf("--location=%v", g.Region),
-	}, &privateCons)
+	privateCons, err := g.backend.PrivateConnections(ctx, g.Region)
 	if err != nil {
 		return false, err
 	}
@@ -105,16 +100,13 @@ func (g Google) privateConnectionExists(ctx context.Context, privateConnection s
 }
 
 func (g Google) createDatastreamFirewallRule(ctx context.Context, firewallRuleName string) error {
-	err := g.performRequest(ctx, []string{
-		"compute",
-		"firewall-rules",
-		"create",
-		firewallRuleName,
-		fmt.Sprintf("--source-ranges=%v", datastreamSubnet),
-		fmt.Sprintf("--network=%v", vpcName),
-		"--allow=tcp:5432",
-		"--direction=INGRESS",
-	}, nil)
+	err := g.backend.CreateFirewallRule(ctx, FirewallRule{
+		Name:        firewallRuleName,
+		Network:     vpcName,
+		SourceRange: datastreamSubnet,
+		Protocol:    "tcp",
+		Port:        "5432",
+	})
 	if err != nil {
 		return err
 	}
@@ -123,23 +115,20 @@ func (g Google) createDatastreamFirewallRule(ctx context.Context, firewallRuleNa
 }
 
 func (g *Google) waitForPrivateConnectionUp(ctx context.Context) error {
-	type privateConnection struct {
-		Name  string `json:"name"`
-		State string `json:"state"`
-	}
-	privCons := []*privateConnection{}
+	name := fmt.Sprintf("projects/%v/locations/%v/privateConnections/%v", g.Project, g.Region, privateConnectionName)
 
 	for {
-		err := g.performRequest(ctx, []string{
-			"datastream",
-			"private-connections",
-			"list",
-			fmt.Sprintf("--location=%v", g.Region),
-			fmt.Sprintf("--filter=name=projects/%v/locations/%v/privateConnections/%v", g.Project, g.Region, privateConnectionName),
-		}, &privCons)
+		privateCons, err := g.backend.PrivateConnections(ctx, g.Region)
 		if err != nil {
 			return err
 		}
+
+		privCons := []*datastream.PrivateConnection{}
+		for _, c := range privateCons {
+			if c.Name == name {
+				privCons = append(privCons, c)
+			}
+		}
 		if len(privCons) != 1 {
 			return fmt.Errorf("should be one (and only one) private connection named %v, but got %v", privateConnectionName, len(privCons))
 		}
@@ -147,7 +136,9 @@ func (g *Google) waitForPrivateConnectionUp(ctx context.Context) error {
 		switch privCons[0].State {
 		case "CREATING":
 			g.log.Info("Waiting for datastream private connection up")
-			time.Sleep(30 * time.Second)
+			if err := sleep(ctx, pollInterval); err != nil {
+				return err
+			}
 			continue
 		case "CREATED":
 			return nil
@@ -158,27 +149,12 @@ func (g *Google) waitForPrivateConnectionUp(ctx context.Context) error {
 }
 
 func (g Google) datastreamFirewallRuleExists(ctx context.Context, firewallRule string) (bool, error) {
-	type firewallRuleType struct {
-		Name string `json:"name"`
-	}
-	firewallRules := []*firewallRuleType{}
-
-	err := g.performRequest(ctx, []string{
-		"compute",
-		"firewall-rules",
-		"list",
-	}, &firewallRules)
+	firewallRules, err := g.backend.FirewallRules(ctx)
 	if err != nil {
 		return false, err
 	}
 
-	for _, r := range firewallRules {
-		if r.Name == firewallRule {
-			return true, nil
-		}
-	}
-
-	return false, nil
+	return contains(firewallRules, firewallRule), nil
 }
 
 func (g Google) createPostgresProfile(ctx context.Context, profileName string) error {
@@ -188,21 +164,20 @@ func (g Google) createPostgresProfile(ctx context.Context, profileName string) e
 	}
 
 	g.log.Infof("Creating Datastream postgres profile...")
-	err = g.performRequest(ctx, []string{
-		"datastream",
-		"connection-profiles",
-		"create",
-		profileName,
-		fmt.Sprintf("--display-name=postgres-%v", g.DB),
-		"--type=postgresql",
-		fmt.Sprintf("--location=%v", g.Region),
-		fmt.Sprintf("--private-connection=%v", privateConnectionName),
-		fmt.Sprintf("--postgresql-database=%v", g.DB),
-		fmt.Sprintf("--postgresql-hostname=%v", host),
-		fmt.Sprintf("--postgresql-username=%v", g.User),
-		fmt.Sprintf("--postgresql-password=%v", g.Password),
-		"--postgresql-port=5432",
-	}, nil)
+	err = g.backend.CreateConnectionProfile(ctx, g.Region, profileName, &datastream.ConnectionProfile{
+		DisplayName: fmt.Sprintf("postgres-%v", g.DB),
+		PrivateConnectivity: &datastream.PrivateConnectivity{
+			PrivateConnection: privateConnectionName,
+		},
+		PostgresqlProfile: &datastream.PostgresqlProfile{
+			Database: g.DB,
+			Hostname: host,
+			Username: g.User,
+			Password: g.Password,
+			Port:     5432,
+		},
+		Labels: g.labels(),
+	})
 	if err != nil {
 		return err
 	}
@@ -221,15 +196,11 @@ func (g Google) createPostgresProfile(ctx context.Context, profileName string) e
 
 func (g Google) createBigqueryProfile(ctx context.Context, profileName string) error {
 	g.log.Infof("Creating Datastream Bigquery profile...")
-	err := g.performRequest(ctx, []string{
-		"datastream",
-		"connection-profiles",
-		"create",
-		profileName,
-		fmt.Sprintf("--display-name=bigquery-%v", g.DB),
-		"--type=bigquery",
-		fmt.Sprintf("--location=%v", g.Region),
-	}, nil)
+	err := g.backend.CreateConnectionProfile(ctx, g.Region, profileName, &datastream.ConnectionProfile{
+		DisplayName:     fmt.Sprintf("bigquery-%v", g.DB),
+		BigqueryProfile: &datastream.BigQueryProfile{},
+		Labels:          g.labels(),
+	})
 	if err != nil {
 		return err
 	}
@@ -247,34 +218,25 @@ func (g Google) createBigqueryProfile(ctx context.Context, profileName string) e
 }
 
 func (g Google) profileExists(ctx context.Context, profileName string) (bool, error) {
-	type profile struct {
-		Name        string `json:"name"`
-		DisplayName string `json:"display_name"`
-	}
 	numReadyCheckRetries := 5
 
 OUTER:
 	for i := 0; i < numReadyCheckRetries; i++ {
-		profiles := []*profile{}
-
-		err := g.performRequest(ctx, []string{
-			"datastream",
-			"connection-profiles",
-			"list",
-			fmt.Sprintf("--location=%v", g.Region),
-		}, &profiles)
+		profiles, err := g.backend.ConnectionProfiles(ctx, g.Region)
 		if err != nil {
 			return false, err
 		}
 
 		for _, p := range profiles {
-			if p.Name == fmt.Sprintf("projects/%v/locations/%v/connectionProfiles/%v", g.Project, g.Region, profileName) {
+			if p.Name == g.connectionProfileName(profileName) {
 				// Need this check as the connection profile is not necessarily ready when the list command returns a connection profile.
 				// The next step (create datastream) fails if the connection profiles are not ready.
 				// When the display name field is set to an non empty string, the connection profile is ready.
 				if p.DisplayName == "" {
 					g.log.Infof("Waiting for connection profile %v ready", profileName)
-					time.Sleep(30 * time.Second)
+					if err := sleep(ctx, pollInterval); err != nil {
+						return false, err
+					}
 					continue OUTER
 				}
 				return true, nil
@@ -287,19 +249,8 @@ OUTER:
 	return false, nil
 }
 
-type datastream struct {
-	Name string `json:"name"`
-}
-
 func (g Google) streamExists(ctx context.Context, streamName string) (bool, error) {
-	datastreams := []*datastream{}
-
-	err := g.performRequest(ctx, []string{
-		"datastream",
-		"streams",
-		"list",
-		fmt.Sprintf("--location=%v", g.Region),
-	}, &datastreams)
+	datastreams, err := g.backend.Streams(ctx, g.Region)
 	if err != nil {
 		return false, err
 	}
@@ -313,127 +264,125 @@ func (g Google) streamExists(ctx context.Context, streamName string) (bool, erro
 	return false, nil
 }
 
-func (g *Google) anyOtherStreamExistis(ctx context.Context) (bool, error) {
-	datastreams := []*datastream{}
+// StreamExists reports whether the datastream described by the config exists.
+func (g *Google) StreamExists(ctx context.Context) (bool, error) {
+	return g.streamExists(ctx, generateNameFunc[DATASTREAM](g))
+}
 
-	err := g.performRequest(ctx, []string{
-		"datastream",
-		"streams",
-		"list",
-		fmt.Sprintf("--location=%v", g.Region),
-	}, &datastreams)
-	if err != nil {
-		return false, err
+// StreamReplication returns the publication and replication slot the
+// datastream reads from, or empty names when the datastream does not exist.
+func (g *Google) StreamReplication(ctx context.Context) (string, string, error) {
+	streamName := generateNameFunc[DATASTREAM](g)
+	exists, err := g.streamExists(ctx, streamName)
+	if err != nil || !exists {
+		return "", "", err
 	}
 
-	otherStream := 0
-	stream := generateNameFunc[DATASTREAM](g)
-	for _, ds := range datastreams {
-		if ds.Name != stream {
-			otherStream++
-		}
+	stream, err := g.backend.GetStream(ctx, g.Region, streamName)
+	if err != nil {
+		return "", "", err
 	}
-	return otherStream > 0, nil
+	if stream.SourceConfig == nil || stream.SourceConfig.PostgresqlSourceConfig == nil {
+		return "", "", nil
+	}
+	return stream.SourceConfig.PostgresqlSourceConfig.Publication, stream.SourceConfig.PostgresqlSourceConfig.ReplicationSlot, nil
 }
 
-func (g *Google) createPostgresStreamConfig(ctx context.Context) (string, error) {
-	cfg := map[string]any{}
-	cfg["replicationSlot"] = g.ReplicationSlot
-	cfg["publication"] = g.Publication
-
-	if len(g.IncludeTables) > 0 {
-		tables := []map[string]string{}
-		for _, t := range g.IncludeTables {
-			tables = append(tables, map[string]string{"table": t})
-		}
-		cfg["includeObjects"] = map[string]any{
-			"postgresqlSchemas": []map[string]any{
-				{
-					"schema":           "public",
-					"postgresqlTables": tables,
-				},
-			},
-		}
-	} else if len(g.ExcludeTables) > 0 {
-		tables := []map[string]string{}
-		for _, t := range g.ExcludeTables {
-			tables = append(tables, map[string]string{"table": t})
-		}
-		cfg["excludeObjects"] = map[string]any{
-			"postgresqlSchemas": []map[string]any{
-				{
-					"schema":           "public",
-					"postgresqlTables": tables,
-				},
-			},
-		}
+func (g *Google) createPostgresStreamConfig(ctx context.Context) (*datastream.PostgresqlSourceConfig, error) {
+	cfg := &datastream.PostgresqlSourceConfig{
+		ReplicationSlot: g.ReplicationSlot,
+		Publication:     g.Publication,
 	}
 
-	file, err := ioutil.TempFile("", "ds-pg-config")
-	if err != nil {
-		return "", err
-	}
+	cfg.IncludeObjects = postgresqlObjects(g.IncludeTables)
+	cfg.ExcludeObjects = postgresqlObjects(g.ExcludeTables)
 
-	cfgBytes, err := json.Marshal(cfg)
-	if err != nil {
-		return "", err
+	if err := includeColumns(cfg.IncludeObjects, g.IncludeColumns); err != nil {
+		return nil, err
 	}
-	_, err = file.Write(cfgBytes)
+	excluded, err := excludeColumns(cfg.ExcludeObjects, g.ExcludeColumns)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	cfg.ExcludeObjects = excluded
+
+	for _, w := range contradictions(cfg.IncludeObjects, cfg.ExcludeObjects) {
+		g.log.Warn(w)
 	}
 
-	return file.Name(), nil
+	return cfg, nil
 }
 
-func (g *Google) createBigQueryStreamConfig(ctx context.Context) (string, error) {
-	datasetID := "datastream_" + strings.ReplaceAll(g.DB, "-", "_")
-	exists, err := g.datasetExists(ctx, datasetID)
-	if err != nil {
-		return "", err
+func (g *Google) datasetID() string {
+	if g.Dataset != "" {
+		return g.Dataset
 	}
-	if !exists {
-		if err := g.createDataset(ctx, datasetID); err != nil {
-			return "", err
-		}
+	return "datastream_" + strings.ReplaceAll(g.DB, "-", "_")
+}
+
+func (g *Google) datasetLocation() string {
+	if g.DatasetLocation != "" {
+		return g.DatasetLocation
 	}
+	return g.Region
+}
 
-	cfg := map[string]any{
-		"singleTargetDataset": map[string]string{
-			"datasetId": fmt.Sprintf("%v:%v", g.Project, datasetID),
-		},
-		"dataFreshness": fmt.Sprintf("%ds", g.DataFreshness),
+func (g *Google) createBigQueryStreamConfig(ctx context.Context) (*datastream.BigQueryDestinationConfig, error) {
+	if err := g.ensureDataset(ctx); err != nil {
+		return nil, err
 	}
+	return g.bigQueryStreamConfig(), nil
+}
 
-	file, err := ioutil.TempFile("", "ds-bq-config")
-	if err != nil {
-		return "", err
+// ensureDataset creates the dataset the stream writes to, unless it exists.
+func (g *Google) ensureDataset(ctx context.Context) error {
+	if g.DatasetPerSchema {
+		// datastream creates the dataset of each schema itself
+		return nil
 	}
 
-	cfgBytes, err := json.Marshal(cfg)
-	if err != nil {
-		return "", err
+	exists, err := g.backend.DatasetExists(ctx, g.datasetID())
+	if err != nil || exists {
+		return err
 	}
-	_, err = file.Write(cfgBytes)
-	if err != nil {
-		return "", err
+	return g.backend.CreateDataset(ctx, g.datasetID(), g.datasetLocation())
+}
+
+// bigQueryStreamConfig returns the destination config of the stream. Tables
+// are written to a single dataset as <schema>_<table>, or with DatasetPerSchema
+// to one dataset per schema named <dataset>_<schema>.
+func (g *Google) bigQueryStreamConfig() *datastream.BigQueryDestinationConfig {
+	cfg := &datastream.BigQueryDestinationConfig{
+		SingleTargetDataset: &datastream.SingleTargetDataset{
+			DatasetId: fmt.Sprintf("%v:%v", g.Project, g.datasetID()),
+		},
+		DataFreshness: fmt.Sprintf("%ds", g.DataFreshness),
+	}
+	if g.DatasetPerSchema {
+		cfg.SingleTargetDataset = nil
+		cfg.SourceHierarchyDatasets = &datastream.SourceHierarchyDatasets{
+			DatasetTemplate: &datastream.DatasetTemplate{
+				DatasetIdPrefix: g.datasetID() + "_",
+				Location:        g.datasetLocation(),
+			},
+		}
+	}
+	// changes are merged unless the stream is append-only
+	if g.AppendOnly {
+		cfg.AppendOnly = &datastream.AppendOnly{}
 	}
 
-	return file.Name(), nil
+	return cfg
 }
 
-func (g Google) datasetExists(ctx context.Context, datasetID string) (bool, error) {
-	client, err := bigquery.NewClient(ctx, g.Project)
+func datasetExists(ctx context.Context, project, datasetID string, opts ...option.ClientOption) (bool, error) {
+	client, err := bigquery.NewClient(ctx, project, opts...)
 	if err != nil {
 		return false, err
 	}
 	defer client.Close()
 
 	datasets := client.Datasets(ctx)
-	if err != nil {
-		return false, err
-	}
-
 	for {
 		ds, err := datasets.Next()
 		if err != nil {
@@ -449,22 +398,27 @@ func (g Google) datasetExists(ctx context.Context, datasetID string) (bool, erro
 	}
 }
 
-func (g *Google) createDataset(ctx context.Context, datasetID string) error {
-	client, err := bigquery.NewClient(ctx, g.Project)
+func createDataset(ctx context.Context, project, datasetID, location string, opts ...option.ClientOption) error {
+	client, err := bigquery.NewClient(ctx, project, opts...)
 	if err != nil {
 		return err
 	}
 	defer client.Close()
 
 	return client.Dataset(datasetID).Create(ctx, &bigquery.DatasetMetadata{
-		Location: g.Region,
+		Location: location,
 	})
 }
 
-func deleteTempFile(file string) {
-	if err := os.RemoveAll(file); err != nil {
-		panic(err)
+// formatLabels formats labels the way gcloud's --labels flag expects them.
+func formatLabels(labels map[string]string) string {
+	pairs := []string{}
+	for k, v := range labels {
+		pairs = append(pairs, fmt.Sprintf("%v=%v", k, v))
 	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
 }
 
 func (g Google) deleteStream(ctx context.Context, streamName string) error {
@@ -478,14 +432,7 @@ func (g Google) deleteStream(ctx context.Context, streamName string) error {
 	}
 
 	g.log.Info("Deleting datastream...")
-	return g.performRequest(ctx, []string{
-		"datastream",
-		"streams",
-		"delete",
-		streamName,
-		fmt.Sprintf("--location=%v", g.Region),
-		"--quiet",
-	}, nil)
+	return g.backend.DeleteStream(ctx, g.Region, streamName)
 }
 
 func (g Google) deletePostgresProfile(ctx context.Context, profileName string) error {
@@ -499,14 +446,7 @@ func (g Google) deletePostgresProfile(ctx context.Context, profileName string) e
 	}
 
 	g.log.Infof("Deleting Datastream postgres profile...")
-	return g.performRequest(ctx, []string{
-		"datastream",
-		"connection-profiles",
-		"delete",
-		profileName,
-		fmt.Sprintf("--location=%v", g.Region),
-		"--quiet",
-	}, nil)
+	return g.backend.DeleteConnectionProfile(ctx, g.Region, profileName)
 }
 
 func (g Google) deleteBigqueryProfile(ctx context.Context, profileName string) error {
@@ -520,36 +460,15 @@ func (g Google) deleteBigqueryProfile(ctx context.Context, profileName string) e
 	}
 
 	g.log.Infof("Deleting Datastream Bigquery profile...")
-	return g.performRequest(ctx, []string{
-		"datastream",
-		"connection-profiles",
-		"delete",
-		profileName,
-		fmt.Sprintf("--location=%v", g.Region),
-		"--quiet",
-	}, nil)
+	return g.backend.DeleteConnectionProfile(ctx, g.Region, profileName)
 }
 
 func (g Google) deletePrivateConnection(ctx context.Context, privateConnection string) error {
 	g.log.Infof("Deleting Datastream private connection...")
-	return g.performRequest(ctx, []string{
-		"datastream",
-		"private-connections",
-		"delete",
-		privateConnection,
-		fmt.Sprintf("--location=%v", g.Region),
-		"--quiet",
-		"--force",
-	}, nil)
+	return g.backend.DeletePrivateConnection(ctx, g.Region, privateConnection)
 }
 
 func (g Google) deleteDatastreamFirewallRule(ctx context.Context, firewallRule string) error {
 	g.log.Infof("Deleting Datastream vpc firewall rule...")
-	return g.performRequest(ctx, []string{
-		"compute",
-		"firewall-rules",
-		"delete",
-		firewallRule,
-		"--quiet",
-	}, nil)
+	return g.backend.DeleteFirewallRule(ctx, firewallRule)
 }
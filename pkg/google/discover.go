@@ -0,0 +1,137 @@
+package google
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"google.golang.org/api/datastream/v1"
+)
+
+// DiscoveredColumn is a column of a table in the source database.
+type DiscoveredColumn struct {
+	Name       string `json:"name"`
+	DataType   string `json:"dataType"`
+	Nullable   bool   `json:"nullable"`
+	PrimaryKey bool   `json:"primaryKey"`
+}
+
+// DiscoveredTable is a table in the source database, as seen by Datastream.
+type DiscoveredTable struct {
+	Schema     string             `json:"schema"`
+	Table      string             `json:"table"`
+	Columns    []DiscoveredColumn `json:"columns"`
+	PrimaryKey []string           `json:"primaryKey"`
+}
+
+// Name returns the name of the table as schema.table.
+func (t DiscoveredTable) Name() string {
+	return t.Schema + "." + t.Table
+}
+
+// Discovery is the tables Datastream can see in the source database.
+type Discovery struct {
+	Tables []DiscoveredTable `json:"tables"`
+}
+
+// Write prints the tables, with their primary key and columns.
+func (d *Discovery) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SCHEMA\tTABLE\tPRIMARY KEY\tCOLUMNS")
+	for _, t := range d.Tables {
+		columns := []string{}
+		for _, c := range t.Columns {
+			columns = append(columns, c.Name)
+		}
+		primaryKey := strings.Join(t.PrimaryKey, ",")
+		if primaryKey == "" {
+			primaryKey = "-"
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\n", t.Schema, t.Table, primaryKey, strings.Join(columns, ","))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if missing := d.TablesWithoutPrimaryKey(); len(missing) > 0 {
+		fmt.Fprintf(w, "\nTables without a primary key can only be streamed in append-only mode: %v\n", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// TablesWithoutPrimaryKey returns the tables without a primary key, as schema.table.
+func (d *Discovery) TablesWithoutPrimaryKey() []string {
+	tables := []string{}
+	for _, t := range d.Tables {
+		if len(t.PrimaryKey) == 0 {
+			tables = append(tables, t.Name())
+		}
+	}
+	return tables
+}
+
+// TableNames returns the names of all tables, as schema.table.
+func (d *Discovery) TableNames() []string {
+	tables := []string{}
+	for _, t := range d.Tables {
+		tables = append(tables, t.Name())
+	}
+	return tables
+}
+
+// SourceProfileExists reports whether the source connection profile, which
+// Discover goes through, exists.
+func (g *Google) SourceProfileExists(ctx context.Context) (bool, error) {
+	return g.profileExists(ctx, generateNameFunc[SOURCE_PROFILE](g))
+}
+
+// Discover lists the tables in the source database through the source
+// connection profile, which has to exist.
+func (g *Google) Discover(ctx context.Context) (*Discovery, error) {
+	profile := generateNameFunc[SOURCE_PROFILE](g)
+	exists, err := g.profileExists(ctx, profile)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("source connection profile %v does not exist, run create first", profile)
+	}
+
+	g.log.Infof("Discovering tables through connection profile %v...", profile)
+	rdbms, err := g.backend.DiscoverPostgres(ctx, g.Region, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	return discovery(rdbms), nil
+}
+
+func discovery(rdbms *datastream.PostgresqlRdbms) *Discovery {
+	d := &Discovery{Tables: []DiscoveredTable{}}
+	for _, s := range rdbms.PostgresqlSchemas {
+		for _, t := range s.PostgresqlTables {
+			table := DiscoveredTable{
+				Schema:     s.Schema,
+				Table:      t.Table,
+				Columns:    []DiscoveredColumn{},
+				PrimaryKey: []string{},
+			}
+			for _, c := range t.PostgresqlColumns {
+				table.Columns = append(table.Columns, DiscoveredColumn{
+					Name:       c.Column,
+					DataType:   c.DataType,
+					Nullable:   c.Nullable,
+					PrimaryKey: c.PrimaryKey,
+				})
+				if c.PrimaryKey {
+					table.PrimaryKey = append(table.PrimaryKey, c.Column)
+				}
+			}
+			d.Tables = append(d.Tables, table)
+		}
+	}
+
+	return d
+}
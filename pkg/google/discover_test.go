@@ -0,0 +1,118 @@
+package google
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+const testDiscovery = `{"postgresqlRdbms": {"postgresqlSchemas": [
+	{"schema": "public", "postgresqlTables": [
+		{"table": "users", "postgresqlColumns": [
+			{"column": "id", "dataType": "int4", "primaryKey": true},
+			{"column": "name", "dataType": "text", "nullable": true}
+		]},
+		{"table": "events", "postgresqlColumns": [
+			{"column": "payload", "dataType": "jsonb", "nullable": true}
+		]}
+	]},
+	{"schema": "audit", "postgresqlTables": [
+		{"table": "log", "postgresqlColumns": [
+			{"column": "at", "dataType": "timestamptz", "primaryKey": true},
+			{"column": "id", "dataType": "int8", "primaryKey": true}
+		]}
+	]}
+]}}`
+
+func TestDiscover(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		response string
+		tables   []string
+		// primaryKeys are the primary keys by table, with - for none
+		primaryKeys map[string]string
+	}{
+		{
+			name:        "tables",
+			response:    testDiscovery,
+			tables:      []string{"public.users", "public.events", "audit.log"},
+			primaryKeys: map[string]string{"public.users": "id", "public.events": "-", "audit.log": "at,id"},
+		},
+		{
+			name:     "empty database",
+			response: `{}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			g, project := newTestGoogle(t)
+			if err := g.CreateResources(ctx); err != nil {
+				t.Fatalf("CreateResources: %v", err)
+			}
+			project.respond(tc.response, "datastream", "connection-profiles", "discover")
+
+			d, err := g.Discover(ctx)
+			if err != nil {
+				t.Fatalf("Discover: %v", err)
+			}
+
+			if got := strings.Join(d.TableNames(), ","); got != strings.Join(tc.tables, ",") {
+				t.Errorf("got tables %v, want %v", got, tc.tables)
+			}
+			missing := []string{}
+			for _, table := range d.Tables {
+				want := tc.primaryKeys[table.Name()]
+				if want == "-" {
+					missing = append(missing, table.Name())
+					want = ""
+				}
+				if got := strings.Join(table.PrimaryKey, ","); got != want {
+					t.Errorf("%v: got primary key %q, want %q", table.Name(), got, want)
+				}
+			}
+			if got := d.TablesWithoutPrimaryKey(); strings.Join(got, ",") != strings.Join(missing, ",") {
+				t.Errorf("got tables without primary key %v, want %v", got, missing)
+			}
+			if calls := project.calledWith("datastream", "connection-profiles", "discover"); len(calls) != 1 || !contains(calls[0], "--connection-profile-name=postgres-mydb") {
+				t.Errorf("got discover calls %v, want one through postgres-mydb", calls)
+			}
+		})
+	}
+}
+
+func TestDiscoverWithoutSourceProfile(t *testing.T) {
+	g, project := newTestGoogle(t)
+
+	if _, err := g.Discover(context.Background()); err == nil || !strings.Contains(err.Error(), "run create first") {
+		t.Errorf("got error %v, want hint to run create first", err)
+	}
+	if calls := project.calledWith("datastream", "connection-profiles", "discover"); len(calls) > 0 {
+		t.Errorf("discovered without a source profile: %v", calls)
+	}
+}
+
+func TestDiscoveryWrite(t *testing.T) {
+	d := &Discovery{Tables: []DiscoveredTable{
+		{Schema: "public", Table: "users", PrimaryKey: []string{"id"}, Columns: []DiscoveredColumn{{Name: "id"}, {Name: "name"}}},
+		{Schema: "public", Table: "events", Columns: []DiscoveredColumn{{Name: "payload"}}},
+	}}
+
+	out := &strings.Builder{}
+	if err := d.Write(out); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	for i, want := range [][]string{
+		{"SCHEMA", "TABLE", "PRIMARY", "KEY", "COLUMNS"},
+		{"public", "users", "id", "id,name"},
+		{"public", "events", "-", "payload"},
+	} {
+		if got := strings.Fields(lines[i]); strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("line %v: got %q, want %q", i, got, want)
+		}
+	}
+	if !strings.HasSuffix(out.String(), "append-only mode: public.events\n") {
+		t.Errorf("tables without a primary key are not listed:\n%v", out)
+	}
+}
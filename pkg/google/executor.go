@@ -0,0 +1,35 @@
+package google
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// Executor runs a gcloud command and returns what it wrote to stdout.
+type Executor interface {
+	Execute(ctx context.Context, args []string) ([]byte, error)
+}
+
+// GcloudExecutor runs commands with the gcloud binary found in PATH.
+type GcloudExecutor struct{}
+
+func (GcloudExecutor) Execute(ctx context.Context, args []string) ([]byte, error) {
+	cmd := exec.CommandContext(
+		ctx,
+		"gcloud",
+		args...,
+	)
+
+	buf := &bytes.Buffer{}
+	cmd.Stdout = buf
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		io.Copy(os.Stdout, buf)
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,101 @@
+package google
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// fakeExecutor is an in-memory Executor that records every command it is
+// asked to run and answers with canned output. Commands without a registered
+// response get an empty json list.
+type fakeExecutor struct {
+	mu        sync.Mutex
+	calls     [][]string
+	responses []fakeResponse
+}
+
+type fakeResponse struct {
+	prefix  []string
+	handler func(args []string) (string, error)
+}
+
+func newFakeExecutor() *fakeExecutor {
+	return &fakeExecutor{}
+}
+
+// respond makes commands starting with prefix return output. Responses
+// registered later take precedence over earlier ones.
+func (f *fakeExecutor) respond(output string, prefix ...string) {
+	f.handle(func([]string) (string, error) { return output, nil }, prefix...)
+}
+
+// fail makes commands starting with prefix fail with err.
+func (f *fakeExecutor) fail(err error, prefix ...string) {
+	f.handle(func([]string) (string, error) { return "", err }, prefix...)
+}
+
+// handle makes commands starting with prefix answer with what handler returns
+// for their arguments.
+func (f *fakeExecutor) handle(handler func(args []string) (string, error), prefix ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses = append(f.responses, fakeResponse{prefix: prefix, handler: handler})
+}
+
+// reset removes every registered response.
+func (f *fakeExecutor) reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses = nil
+}
+
+// calledWith returns the argument vectors of the commands run so far that
+// start with prefix.
+func (f *fakeExecutor) calledWith(prefix ...string) [][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	calls := [][]string{}
+	for _, c := range f.calls {
+		if hasPrefix(c, prefix) {
+			calls = append(calls, append([]string{}, c...))
+		}
+	}
+	return calls
+}
+
+func (f *fakeExecutor) Execute(ctx context.Context, args []string) ([]byte, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, append([]string{}, args...))
+	var handler func([]string) (string, error)
+	for i := len(f.responses) - 1; i >= 0; i-- {
+		if hasPrefix(args, f.responses[i].prefix) {
+			handler = f.responses[i].handler
+			break
+		}
+	}
+	f.mu.Unlock()
+
+	if handler == nil {
+		return []byte("[]"), nil
+	}
+	output, err := handler(args)
+	if err != nil {
+		return nil, fmt.Errorf("gcloud %v: %w", strings.Join(args, " "), err)
+	}
+	return []byte(output), nil
+}
+
+func hasPrefix(args, prefix []string) bool {
+	if len(prefix) > len(args) {
+		return false
+	}
+	for i, p := range prefix {
+		if args[i] != p {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,708 @@
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"google.golang.org/api/datastream/v1"
+)
+
+type gcloudBackend struct {
+	executor Executor
+	project  string
+}
+
+// NewGcloudBackend returns a Backend that runs gcloud commands through executor.
+func NewGcloudBackend(executor Executor, project string) Backend {
+	return &gcloudBackend{
+		executor: executor,
+		project:  project,
+	}
+}
+
+func (b *gcloudBackend) performRequest(ctx context.Context, args []string, out interface{}) error {
+	if out == nil {
+		out = []map[string]interface{}{}
+	}
+
+	args = append(args, fmt.Sprintf("--project=%v", b.project))
+	args = append(args, "--format=json")
+
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, gcloudTimeout)
+	defer cancel()
+
+	stdout, err := b.executor.Execute(ctxWithTimeout, args)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(stdout, &out); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// performDatastreamRequest decodes the output of a gcloud datastream command
+// into the Datastream API types. gcloud does not consistently use the field
+// names of the API, so object keys are converted to camel case first.
+func (b *gcloudBackend) performDatastreamRequest(ctx context.Context, args []string, out interface{}) error {
+	var raw interface{}
+	if err := b.performRequest(ctx, args, &raw); err != nil {
+		return err
+	}
+
+	bytes, err := json.Marshal(camelCaseKeys(raw))
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(bytes, out)
+}
+
+func camelCaseKeys(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		converted := map[string]interface{}{}
+		for k, child := range val {
+			if k == "labels" {
+				converted[k] = child
+				continue
+			}
+			converted[camelCase(k)] = camelCaseKeys(child)
+		}
+		return converted
+	case []interface{}:
+		for i, child := range val {
+			val[i] = camelCaseKeys(child)
+		}
+		return val
+	default:
+		return v
+	}
+}
+
+func camelCase(s string) string {
+	parts := strings.Split(s, "_")
+	for i := 1; i < len(parts); i++ {
+		r := []rune(parts[i])
+		if len(r) > 0 {
+			r[0] = unicode.ToUpper(r[0])
+		}
+		parts[i] = string(r)
+	}
+	return strings.Join(parts, "")
+}
+
+func lastPathElement(name string) string {
+	parts := strings.Split(name, "/")
+	return parts[len(parts)-1]
+}
+
+func (b *gcloudBackend) listNames(ctx context.Context, args []string, field string) ([]string, error) {
+	items := []map[string]interface{}{}
+	if err := b.performRequest(ctx, args, &items); err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, i := range items {
+		if name, ok := i[field].(string); ok {
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
+
+func (b *gcloudBackend) EnabledServices(ctx context.Context) ([]string, error) {
+	names, err := b.listNames(ctx, []string{
+		"services",
+		"list",
+		"--enabled",
+	}, "name")
+	if err != nil {
+		return nil, err
+	}
+
+	apiNames := []string{}
+	for _, n := range names {
+		apiNames = append(apiNames, lastPathElement(n))
+	}
+
+	return apiNames, nil
+}
+
+func (b *gcloudBackend) EnableService(ctx context.Context, service string) error {
+	return b.performRequest(ctx, []string{
+		"services",
+		"enable",
+		service,
+	}, nil)
+}
+
+func (b *gcloudBackend) DisableService(ctx context.Context, service string) error {
+	return b.performRequest(ctx, []string{
+		"services",
+		"disable",
+		service,
+		"--force",
+	}, nil)
+}
+
+func (b *gcloudBackend) Networks(ctx context.Context) ([]string, error) {
+	return b.listNames(ctx, []string{
+		"compute",
+		"networks",
+		"list",
+	}, "name")
+}
+
+func (b *gcloudBackend) CreateNetwork(ctx context.Context, network string) error {
+	return b.performRequest(ctx, []string{
+		"compute",
+		"networks",
+		"create",
+		network,
+	}, nil)
+}
+
+func (b *gcloudBackend) DeleteNetwork(ctx context.Context, network string) error {
+	return b.performRequest(ctx, []string{
+		"compute",
+		"networks",
+		"delete",
+		network,
+		"--quiet",
+	}, nil)
+}
+
+func (b *gcloudBackend) FirewallRules(ctx context.Context) ([]string, error) {
+	return b.listNames(ctx, []string{
+		"compute",
+		"firewall-rules",
+		"list",
+	}, "name")
+}
+
+func (b *gcloudBackend) CreateFirewallRule(ctx context.Context, rule FirewallRule) error {
+	return b.performRequest(ctx, []string{
+		"compute",
+		"firewall-rules",
+		"create",
+		rule.Name,
+		fmt.Sprintf("--source-ranges=%v", rule.SourceRange),
+		fmt.Sprintf("--network=%v", rule.Network),
+		fmt.Sprintf("--allow=%v:%v", rule.Protocol, rule.Port),
+		"--direction=INGRESS",
+	}, nil)
+}
+
+func (b *gcloudBackend) DeleteFirewallRule(ctx context.Context, rule string) error {
+	return b.performRequest(ctx, []string{
+		"compute",
+		"firewall-rules",
+		"delete",
+		rule,
+		"--quiet",
+	}, nil)
+}
+
+func (b *gcloudBackend) ServiceAccounts(ctx context.Context) ([]string, error) {
+	return b.listNames(ctx, []string{
+		"iam",
+		"service-accounts",
+		"list",
+	}, "email")
+}
+
+func (b *gcloudBackend) CreateServiceAccount(ctx context.Context, accountID, displayName, description string) error {
+	return b.performRequest(ctx, []string{
+		"iam",
+		"service-accounts",
+		"create",
+		accountID,
+		fmt.Sprintf("--description=%v", description),
+		fmt.Sprintf("--display-name=%v", displayName),
+	}, map[string]string{})
+}
+
+func (b *gcloudBackend) DeleteServiceAccount(ctx context.Context, email string) error {
+	return b.performRequest(ctx, []string{
+		"iam",
+		"service-accounts",
+		"delete",
+		email,
+	}, nil)
+}
+
+func (b *gcloudBackend) MemberRoles(ctx context.Context, member string) ([]string, error) {
+	type iamPolicy struct {
+		Bindings struct {
+			Role string `json:"role"`
+		} `json:"bindings"`
+	}
+	iamPolicies := []*iamPolicy{}
+
+	err := b.performRequest(ctx, []string{
+		"projects",
+		"get-iam-policy",
+		b.project,
+		"--flatten=bindings[].members",
+		fmt.Sprintf("--filter=bindings.members=%v", member),
+	}, &iamPolicies)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := []string{}
+	for _, p := range iamPolicies {
+		roles = append(roles, p.Bindings.Role)
+	}
+
+	return roles, nil
+}
+
+func (b *gcloudBackend) AddRoleBinding(ctx context.Context, member, role string) error {
+	return b.performRequest(ctx, []string{
+		"projects",
+		"add-iam-policy-binding",
+		b.project,
+		fmt.Sprintf("--member=%v", member),
+		fmt.Sprintf("--role=%v", role),
+		"--condition=None",
+	}, nil)
+}
+
+func (b *gcloudBackend) RemoveRoleBinding(ctx context.Context, member, role string) error {
+	return b.performRequest(ctx, []string{
+		"projects",
+		"remove-iam-policy-binding",
+		b.project,
+		fmt.Sprintf("--member=%v", member),
+		fmt.Sprintf("--role=%v", role),
+		"--condition=None",
+	}, nil)
+}
+
+func (b *gcloudBackend) Instances(ctx context.Context) ([]string, error) {
+	return b.listNames(ctx, []string{
+		"compute",
+		"instances",
+		"list",
+	}, "name")
+}
+
+func (b *gcloudBackend) CreateProxyInstance(ctx context.Context, instance ProxyInstance) error {
+	args := []string{
+		"compute",
+		"instances",
+		"create-with-container",
+		instance.Name,
+		fmt.Sprintf("--machine-type=%v", instance.MachineType),
+		fmt.Sprintf("--zone=%v", instance.Zone),
+		fmt.Sprintf("--service-account=%v", instance.ServiceAccount),
+		fmt.Sprintf("--create-disk=image-project=%v,image-family=%v", instance.DiskImageProject, instance.DiskImageFamily),
+		"--scopes=cloud-platform",
+		fmt.Sprintf("--network-interface=network=%v,subnet=%v", instance.Network, instance.Subnet),
+		fmt.Sprintf("--container-image=%v", instance.ContainerImage),
+	}
+	if len(instance.Labels) > 0 {
+		args = append(args, fmt.Sprintf("--labels=%v", formatLabels(instance.Labels)))
+	}
+	for _, a := range instance.ContainerArgs {
+		args = append(args, fmt.Sprintf("--container-arg=%v", a))
+	}
+
+	return b.performRequest(ctx, args, nil)
+}
+
+func (b *gcloudBackend) InstanceNetworkIPs(ctx context.Context, zone, instance string) (map[string]string, error) {
+	type computeInstance struct {
+		NetworkInterfaces []struct {
+			Network   string `json:"network"`
+			NetworkIP string `json:"networkIP"`
+		} `json:"networkInterfaces"`
+	}
+	vm := computeInstance{}
+
+	err := b.performRequest(ctx, []string{
+		"compute",
+		"instances",
+		"describe",
+		instance,
+		fmt.Sprintf("--zone=%v", zone),
+	}, &vm)
+	if err != nil {
+		return nil, err
+	}
+
+	ips := map[string]string{}
+	for _, n := range vm.NetworkInterfaces {
+		ips[lastPathElement(n.Network)] = n.NetworkIP
+	}
+
+	return ips, nil
+}
+
+func (b *gcloudBackend) InstanceStatus(ctx context.Context, zone, instance string) (string, error) {
+	vm := struct {
+		Status string `json:"status"`
+	}{}
+
+	err := b.performRequest(ctx, []string{
+		"compute",
+		"instances",
+		"describe",
+		instance,
+		fmt.Sprintf("--zone=%v", zone),
+	}, &vm)
+	if err != nil {
+		return "", err
+	}
+
+	return vm.Status, nil
+}
+
+func (b *gcloudBackend) DeleteInstance(ctx context.Context, zone, instance string) error {
+	return b.performRequest(ctx, []string{
+		"compute",
+		"instances",
+		"delete",
+		instance,
+		fmt.Sprintf("--zone=%v", zone),
+		"--quiet",
+	}, nil)
+}
+
+func (b *gcloudBackend) PrivateConnections(ctx context.Context, region string) ([]*datastream.PrivateConnection, error) {
+	privateConns := []*datastream.PrivateConnection{}
+	err := b.performDatastreamRequest(ctx, []string{
+		"datastream",
+		"private-connections",
+		"list",
+		fmt.Sprintf("--location=%v", region),
+	}, &privateConns)
+	if err != nil {
+		return nil, err
+	}
+
+	return privateConns, nil
+}
+
+func (b *gcloudBackend) CreatePrivateConnection(ctx context.Context, region, id string, connection *datastream.PrivateConnection) error {
+	args := []string{
+		"datastream",
+		"private-connections",
+		"create",
+		id,
+		fmt.Sprintf("--display-name=%v", connection.DisplayName),
+		fmt.Sprintf("--vpc=%v", connection.VpcPeeringConfig.Vpc),
+		fmt.Sprintf("--subnet=%v", connection.VpcPeeringConfig.Subnet),
+		fmt.Sprintf("--location=%v", region),
+	}
+	if len(connection.Labels) > 0 {
+		args = append(args, fmt.Sprintf("--labels=%v", formatLabels(connection.Labels)))
+	}
+
+	return b.performRequest(ctx, args, nil)
+}
+
+func (b *gcloudBackend) DeletePrivateConnection(ctx context.Context, region, id string) error {
+	return b.performRequest(ctx, []string{
+		"datastream",
+		"private-connections",
+		"delete",
+		id,
+		fmt.Sprintf("--location=%v", region),
+		"--quiet",
+		"--force",
+	}, nil)
+}
+
+func (b *gcloudBackend) ConnectionProfiles(ctx context.Context, region string) ([]*datastream.ConnectionProfile, error) {
+	profiles := []*datastream.ConnectionProfile{}
+	err := b.performDatastreamRequest(ctx, []string{
+		"datastream",
+		"connection-profiles",
+		"list",
+		fmt.Sprintf("--location=%v", region),
+	}, &profiles)
+	if err != nil {
+		return nil, err
+	}
+
+	return profiles, nil
+}
+
+func (b *gcloudBackend) CreateConnectionProfile(ctx context.Context, region, id string, profile *datastream.ConnectionProfile) error {
+	args := []string{
+		"datastream",
+		"connection-profiles",
+		"create",
+		id,
+		fmt.Sprintf("--display-name=%v", profile.DisplayName),
+	}
+
+	switch {
+	case profile.PostgresqlProfile != nil:
+		pg := profile.PostgresqlProfile
+		args = append(args,
+			"--type=postgresql",
+			fmt.Sprintf("--location=%v", region),
+			fmt.Sprintf("--private-connection=%v", lastPathElement(profile.PrivateConnectivity.PrivateConnection)),
+			fmt.Sprintf("--postgresql-database=%v", pg.Database),
+			fmt.Sprintf("--postgresql-hostname=%v", pg.Hostname),
+			fmt.Sprintf("--postgresql-username=%v", pg.Username),
+			fmt.Sprintf("--postgresql-password=%v", pg.Password),
+			fmt.Sprintf("--postgresql-port=%v", pg.Port),
+		)
+	case profile.BigqueryProfile != nil:
+		args = append(args,
+			"--type=bigquery",
+			fmt.Sprintf("--location=%v", region),
+		)
+	default:
+		return fmt.Errorf("unsupported connection profile type for %v", id)
+	}
+	if len(profile.Labels) > 0 {
+		args = append(args, fmt.Sprintf("--labels=%v", formatLabels(profile.Labels)))
+	}
+
+	return b.performRequest(ctx, args, nil)
+}
+
+func (b *gcloudBackend) DeleteConnectionProfile(ctx context.Context, region, id string) error {
+	return b.performRequest(ctx, []string{
+		"datastream",
+		"connection-profiles",
+		"delete",
+		id,
+		fmt.Sprintf("--location=%v", region),
+		"--quiet",
+	}, nil)
+}
+
+func (b *gcloudBackend) DiscoverPostgres(ctx context.Context, region, profile string) (*datastream.PostgresqlRdbms, error) {
+	resp := &datastream.DiscoverConnectionProfileResponse{}
+	err := b.performDatastreamRequest(ctx, []string{
+		"datastream",
+		"connection-profiles",
+		"discover",
+		fmt.Sprintf("--connection-profile-name=%v", profile),
+		fmt.Sprintf("--location=%v", region),
+		"--full-hierarchy",
+	}, resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.PostgresqlRdbms == nil {
+		return &datastream.PostgresqlRdbms{}, nil
+	}
+
+	return resp.PostgresqlRdbms, nil
+}
+
+func (b *gcloudBackend) Regions(ctx context.Context) ([]string, error) {
+	return b.listNames(ctx, []string{
+		"datastream",
+		"locations",
+		"list",
+	}, "locationId")
+}
+
+func (b *gcloudBackend) Streams(ctx context.Context, region string) ([]*datastream.Stream, error) {
+	streams := []*datastream.Stream{}
+	err := b.performDatastreamRequest(ctx, []string{
+		"datastream",
+		"streams",
+		"list",
+		fmt.Sprintf("--location=%v", region),
+	}, &streams)
+	if err != nil {
+		return nil, err
+	}
+
+	return streams, nil
+}
+
+func (b *gcloudBackend) GetStream(ctx context.Context, region, id string) (*datastream.Stream, error) {
+	stream := &datastream.Stream{}
+	err := b.performDatastreamRequest(ctx, []string{
+		"datastream",
+		"streams",
+		"describe",
+		id,
+		fmt.Sprintf("--location=%v", region),
+	}, stream)
+	if err != nil {
+		return nil, err
+	}
+
+	return stream, nil
+}
+
+func (b *gcloudBackend) CreateStream(ctx context.Context, region, id string, stream *datastream.Stream) error {
+	pgConfig, err := writeTempJSON("ds-pg-config", stream.SourceConfig.PostgresqlSourceConfig)
+	if err != nil {
+		return err
+	}
+	defer deleteTempFile(pgConfig)
+
+	bqConfig, err := writeTempJSON("ds-bq-config", stream.DestinationConfig.BigqueryDestinationConfig)
+	if err != nil {
+		return err
+	}
+	defer deleteTempFile(bqConfig)
+
+	args := []string{
+		"datastream",
+		"streams",
+		"create",
+		id,
+		fmt.Sprintf("--display-name=%v", stream.DisplayName),
+		fmt.Sprintf("--location=%v", region),
+		fmt.Sprintf("--source=%v", stream.SourceConfig.SourceConnectionProfile),
+		fmt.Sprintf("--postgresql-source-config=%v", pgConfig),
+		fmt.Sprintf("--destination=%v", stream.DestinationConfig.DestinationConnectionProfile),
+		fmt.Sprintf("--bigquery-destination-config=%v", bqConfig),
+	}
+	if stream.BackfillAll != nil {
+		args = append(args, "--backfill-all")
+	} else {
+		args = append(args, "--backfill-none")
+	}
+	if len(stream.Labels) > 0 {
+		args = append(args, fmt.Sprintf("--labels=%v", formatLabels(stream.Labels)))
+	}
+
+	return b.performRequest(ctx, args, nil)
+}
+
+func (b *gcloudBackend) UpdateStream(ctx context.Context, region, id string, stream *datastream.Stream, updateMask []string) error {
+	args := []string{
+		"datastream",
+		"streams",
+		"update",
+		id,
+		fmt.Sprintf("--location=%v", region),
+		fmt.Sprintf("--update-mask=%v", strings.Join(updateMask, ",")),
+	}
+
+	pgConfigSet, bqConfigSet := false, false
+	for _, field := range updateMask {
+		switch {
+		case field == "state":
+			args = append(args, fmt.Sprintf("--state=%v", stream.State))
+		case strings.HasPrefix(field, "sourceConfig.postgresqlSourceConfig") && !pgConfigSet:
+			pgConfig, err := writeTempJSON("ds-pg-config", stream.SourceConfig.PostgresqlSourceConfig)
+			if err != nil {
+				return err
+			}
+			defer deleteTempFile(pgConfig)
+			args = append(args, fmt.Sprintf("--postgresql-source-config=%v", pgConfig))
+			pgConfigSet = true
+		case strings.HasPrefix(field, "destinationConfig.bigqueryDestinationConfig") && !bqConfigSet:
+			bqConfig, err := writeTempJSON("ds-bq-config", stream.DestinationConfig.BigqueryDestinationConfig)
+			if err != nil {
+				return err
+			}
+			defer deleteTempFile(bqConfig)
+			args = append(args, fmt.Sprintf("--bigquery-destination-config=%v", bqConfig))
+			bqConfigSet = true
+		case strings.HasPrefix(field, "sourceConfig.postgresqlSourceConfig"), strings.HasPrefix(field, "destinationConfig.bigqueryDestinationConfig"):
+		default:
+			return fmt.Errorf("updating field %v of stream %v is not supported with gcloud", field, id)
+		}
+	}
+
+	return b.performRequest(ctx, args, nil)
+}
+
+func (b *gcloudBackend) DeleteStream(ctx context.Context, region, id string) error {
+	return b.performRequest(ctx, []string{
+		"datastream",
+		"streams",
+		"delete",
+		id,
+		fmt.Sprintf("--location=%v", region),
+		"--quiet",
+	}, nil)
+}
+
+func (b *gcloudBackend) StartBackfill(ctx context.Context, region, streamID, schema, table string) error {
+	object := &datastream.StreamObject{}
+	err := b.performDatastreamRequest(ctx, []string{
+		"datastream",
+		"objects",
+		"lookup",
+		fmt.Sprintf("--stream=%v", streamID),
+		fmt.Sprintf("--location=%v", region),
+		fmt.Sprintf("--postgresql-schema=%v", schema),
+		fmt.Sprintf("--postgresql-table=%v", table),
+	}, object)
+	if err != nil {
+		return err
+	}
+
+	return b.performRequest(ctx, []string{
+		"datastream",
+		"objects",
+		"start-backfill",
+		lastPathElement(object.Name),
+		fmt.Sprintf("--stream=%v", streamID),
+		fmt.Sprintf("--location=%v", region),
+	}, map[string]interface{}{})
+}
+
+func (b *gcloudBackend) SQLInstance(ctx context.Context, instance string) (*sqlInstance, error) {
+	sqlInst := &sqlInstance{}
+	err := b.performRequest(ctx, []string{
+		"sql",
+		"instances",
+		"describe",
+		instance,
+	}, sqlInst)
+	if err != nil {
+		return nil, err
+	}
+
+	return sqlInst, nil
+}
+
+func (b *gcloudBackend) DatasetExists(ctx context.Context, datasetID string) (bool, error) {
+	return datasetExists(ctx, b.project, datasetID)
+}
+
+func (b *gcloudBackend) CreateDataset(ctx context.Context, datasetID, location string) error {
+	return createDataset(ctx, b.project, datasetID, location)
+}
+
+func writeTempJSON(pattern string, v interface{}) (string, error) {
+	file, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	cfgBytes, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	_, err = file.Write(cfgBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return file.Name(), nil
+}
+
+func deleteTempFile(file string) {
+	if err := os.RemoveAll(file); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,164 @@
+package google
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// resourceDependencies lists, for every managed resource, the resources that
+// have to exist before it can be created. Resources are created in dependency
+// order and deleted in the reverse order.
+var resourceDependencies map[string][]string = map[string][]string{
+	DATASTREAM_API:      {},
+	VPC:                 {},
+	SERVICE_ACCOUNT:     {},
+	SQL_PROXY:           {VPC, SERVICE_ACCOUNT},
+	PRIVATE_CONN:        {VPC, DATASTREAM_API},
+	FIREWALLRULE:        {VPC},
+	SOURCE_PROFILE:      {PRIVATE_CONN, FIREWALLRULE, SQL_PROXY},
+	DESTINATION_PROFILE: {DATASTREAM_API},
+	DATASTREAM:          {SOURCE_PROFILE, DESTINATION_PROFILE},
+}
+
+// topologicalOrder returns every resource after the resources it depends on.
+// Resources at the same depth in the graph are ordered by name, so the order
+// is stable between runs.
+func topologicalOrder() []string {
+	depth := map[string]int{}
+	var visit func(r string) int
+	visit = func(r string) int {
+		if d, ok := depth[r]; ok {
+			return d
+		}
+		d := 0
+		for _, dep := range resourceDependencies[r] {
+			if dd := visit(dep) + 1; dd > d {
+				d = dd
+			}
+		}
+		depth[r] = d
+		return d
+	}
+
+	resources := []string{}
+	for r := range resourceDependencies {
+		visit(r)
+		resources = append(resources, r)
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		if depth[resources[i]] != depth[resources[j]] {
+			return depth[resources[i]] < depth[resources[j]]
+		}
+		return resources[i] < resources[j]
+	})
+
+	return resources
+}
+
+// createOrder returns the resources that are created by CreateResources, in the
+// order they are created when run one at a time.
+func createOrder() []string {
+	resources := []string{}
+	for _, r := range topologicalOrder() {
+		if _, ok := createResourceFunc[r]; ok {
+			resources = append(resources, r)
+		}
+	}
+	return resources
+}
+
+// deleteOrder returns the resources that are deleted by DeleteResources, in the
+// order they are deleted when run one at a time.
+func deleteOrder() []string {
+	order := topologicalOrder()
+	resources := make([]string, 0, len(order))
+	for i := len(order) - 1; i >= 0; i-- {
+		resources = append(resources, order[i])
+	}
+	return resources
+}
+
+// dependents returns the inverse of resourceDependencies, the resources that
+// have to be deleted before each resource can be deleted.
+func dependents() map[string][]string {
+	deps := map[string][]string{}
+	for r, rDeps := range resourceDependencies {
+		for _, d := range rDeps {
+			deps[d] = append(deps[d], r)
+		}
+	}
+	return deps
+}
+
+// walkGraph calls f for each of resources once f has returned successfully for
+// every resource it depends on according to deps. Dependencies outside of
+// resources are ignored. Resources that don't depend on each other are handled
+// concurrently. After f fails no more resources are started, and walkGraph
+// returns once the ones in progress are done, along with the resources f
+// succeeded for.
+func walkGraph(ctx context.Context, resources []string, deps map[string][]string, f func(context.Context, string) error) ([]string, error) {
+	type result struct {
+		resource string
+		err      error
+	}
+
+	results := make(chan result)
+	started := map[string]bool{}
+	done := []string{}
+	errs := []error{}
+	running := 0
+
+	ready := func(r string) bool {
+		for _, d := range deps[r] {
+			if contains(resources, d) && !contains(done, d) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for {
+		if len(errs) == 0 {
+			for _, r := range resources {
+				if started[r] || !ready(r) {
+					continue
+				}
+				started[r] = true
+				running++
+				go func(r string) {
+					results <- result{resource: r, err: f(ctx, r)}
+				}(r)
+			}
+		}
+		if running == 0 {
+			break
+		}
+
+		res := <-results
+		running--
+		if res.err != nil {
+			errs = append(errs, res.err)
+			continue
+		}
+		done = append(done, res.resource)
+	}
+
+	if len(errs) == 0 && len(done) < len(resources) {
+		return done, fmt.Errorf("dependency cycle between resources: %v", resourceListToString(notIn(resources, done)))
+	}
+
+	return done, errors.Join(errs...)
+}
+
+// notIn returns the values of vals that are not in exclude.
+func notIn(vals, exclude []string) []string {
+	rest := []string{}
+	for _, v := range vals {
+		if !contains(exclude, v) {
+			rest = append(rest, v)
+		}
+	}
+	return rest
+}
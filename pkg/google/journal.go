@@ -0,0 +1,162 @@
+package google
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// journalDir returns the directory journals of create runs are stored in.
+var journalDir = func() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "nada-datastream", "runs"), nil
+}
+
+// journal records the progress of a create run, so that a run that was
+// interrupted can be resumed or rolled back. A journal is removed when the run
+// it belongs to succeeds or has been rolled back.
+type journal struct {
+	mu   sync.Mutex
+	path string
+
+	Project string    `json:"project"`
+	Region  string    `json:"region"`
+	Stream  string    `json:"stream"`
+	Started time.Time `json:"started"`
+	// Created are the resources the run has created.
+	Created []string `json:"created"`
+	// InProgress are the resources the run has started but not finished creating.
+	InProgress []string `json:"inProgress"`
+}
+
+func (g *Google) journalPath() (string, error) {
+	dir, err := journalDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, fmt.Sprintf("%v_%v.json", g.Project, generateNameFunc[DATASTREAM](g))), nil
+}
+
+// loadJournal returns the journal of an unfinished run for the stream, or nil
+// if there is none.
+func (g *Google) loadJournal() (*journal, error) {
+	path, err := g.journalPath()
+	if err != nil {
+		return nil, err
+	}
+
+	bytes, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	j := &journal{path: path}
+	if err := json.Unmarshal(bytes, j); err != nil {
+		return nil, fmt.Errorf("reading journal %v: %w", path, err)
+	}
+	return j, nil
+}
+
+// newJournal starts a journal for a new run for the stream.
+func (g *Google) newJournal() (*journal, error) {
+	path, err := g.journalPath()
+	if err != nil {
+		return nil, err
+	}
+
+	j := &journal{
+		path:       path,
+		Project:    g.Project,
+		Region:     g.Region,
+		Stream:     generateNameFunc[DATASTREAM](g),
+		Started:    time.Now(),
+		Created:    []string{},
+		InProgress: []string{},
+	}
+	return j, j.save()
+}
+
+// started records that the run has started creating resource.
+func (j *journal) started(resource string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if !contains(j.InProgress, resource) {
+		j.InProgress = append(j.InProgress, resource)
+	}
+	return j.save()
+}
+
+// created records that the run has created resource.
+func (j *journal) created(resource string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.InProgress = notIn(j.InProgress, []string{resource})
+	if !contains(j.Created, resource) {
+		j.Created = append(j.Created, resource)
+	}
+	return j.save()
+}
+
+// deleted records that resource created by the run has been deleted again.
+func (j *journal) deleted(resource string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.InProgress = notIn(j.InProgress, []string{resource})
+	j.Created = notIn(j.Created, []string{resource})
+	return j.save()
+}
+
+// inProgress reports whether the run had started but not finished creating resource.
+func (j *journal) inProgress(resource string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return contains(j.InProgress, resource)
+}
+
+// owned returns the resources the run has created or started creating.
+func (j *journal) owned() []string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return append(append([]string{}, j.Created...), j.InProgress...)
+}
+
+func (j *journal) save() error {
+	if err := os.MkdirAll(filepath.Dir(j.path), 0o700); err != nil {
+		return err
+	}
+
+	bytes, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so an interrupted write leaves the previous journal intact
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, bytes, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.path)
+}
+
+// remove deletes the journal, once the run is finished.
+func (j *journal) remove() error {
+	if err := os.Remove(j.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package google
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/api/datastream/v1"
+)
+
+const (
+	StreamNotStarted        = "NOT_STARTED"
+	StreamRunning           = "RUNNING"
+	StreamPaused            = "PAUSED"
+	StreamFailed            = "FAILED"
+	StreamFailedPermanently = "FAILED_PERMANENTLY"
+
+	streamStateTimeout = 20 * time.Minute
+)
+
+// failedStateGracePeriod is how long a stream may still be in the failed state
+// it is changed from before it counts as failing again. Datastream can report
+// the old state for a while after the change is accepted.
+var failedStateGracePeriod = 2 * time.Minute
+
+// StartStream starts a stream that has not been started yet and waits for it to run.
+func (g *Google) StartStream(ctx context.Context) error {
+	return g.setStreamState(ctx, []string{StreamNotStarted}, StreamRunning)
+}
+
+// PauseStream pauses a running stream.
+func (g *Google) PauseStream(ctx context.Context) error {
+	return g.setStreamState(ctx, []string{StreamRunning}, StreamPaused)
+}
+
+// ResumeStream resumes a paused or failed stream and waits for it to run.
+func (g *Google) ResumeStream(ctx context.Context) error {
+	return g.setStreamState(ctx, []string{StreamPaused, StreamFailed}, StreamRunning)
+}
+
+func (g *Google) setStreamState(ctx context.Context, from []string, to string) error {
+	streamName := generateNameFunc[DATASTREAM](g)
+	stream, err := g.backend.GetStream(ctx, g.Region, streamName)
+	if err != nil {
+		return err
+	}
+
+	if stream.State == to {
+		g.log.Infof("Datastream %v is already %v", streamName, to)
+		return nil
+	}
+	if !contains(from, stream.State) {
+		return fmt.Errorf("datastream %v is %v, but must be %v to become %v", streamName, stream.State, strings.Join(from, " or "), to)
+	}
+
+	g.log.Infof("Changing state of datastream %v from %v to %v...", streamName, stream.State, to)
+	err = g.backend.UpdateStream(ctx, g.Region, streamName, &datastream.Stream{State: to}, []string{"state"})
+	if err != nil {
+		return err
+	}
+
+	return g.waitForStreamState(ctx, streamName, stream.State, to)
+}
+
+// waitForStreamState waits for the stream to change from the state from to
+// want. A failed state is only reported as a failure once the stream has left
+// from, or after failedStateGracePeriod, so that resuming a failed stream
+// doesn't fail on the state it had before.
+func (g *Google) waitForStreamState(ctx context.Context, streamName, from, want string) error {
+	ctx, cancel := context.WithTimeout(ctx, streamStateTimeout)
+	defer cancel()
+
+	started := time.Now()
+	left := false
+	for {
+		stream, err := g.backend.GetStream(ctx, g.Region, streamName)
+		if err != nil {
+			return err
+		}
+		if stream.State != from {
+			left = true
+		}
+
+		failed := stream.State == StreamFailed || stream.State == StreamFailedPermanently
+		switch {
+		case stream.State == want:
+			g.log.Infof("Datastream %v is %v", streamName, want)
+			return nil
+		case failed && (left || time.Since(started) >= failedStateGracePeriod):
+			return fmt.Errorf("datastream %v is %v: %v", streamName, stream.State, streamErrors(stream))
+		default:
+			g.log.Infof("Waiting for datastream %v to become %v (currently %v)", streamName, want, stream.State)
+			if err := sleep(ctx, pollInterval); err != nil {
+				return fmt.Errorf("datastream %v did not become %v: %w", streamName, want, err)
+			}
+		}
+	}
+}
+
+func streamErrors(stream *datastream.Stream) string {
+	if len(stream.Errors) == 0 {
+		return "no error reported"
+	}
+
+	messages := []string{}
+	for _, e := range stream.Errors {
+		messages = append(messages, e.Message)
+	}
+	return strings.Join(messages, "; ")
+}
@@ -0,0 +1,67 @@
+package google
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// respondStates makes the stream report states, one for each time it is
+// described, and the last one from then on.
+func respondStates(project *fakeProject, states ...string) {
+	var mu sync.Mutex
+	project.handle(func([]string) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		state := states[0]
+		if len(states) > 1 {
+			states = states[1:]
+		}
+		return fmt.Sprintf(`{"state": %q}`, state), nil
+	}, "datastream", "streams", "describe")
+}
+
+func setStreamPolling(t *testing.T, poll, grace time.Duration) {
+	originalPoll, originalGrace := pollInterval, failedStateGracePeriod
+	pollInterval, failedStateGracePeriod = poll, grace
+	t.Cleanup(func() { pollInterval, failedStateGracePeriod = originalPoll, originalGrace })
+}
+
+func TestResumeFailedStream(t *testing.T) {
+	setStreamPolling(t, 0, time.Hour)
+	g, project := newTestGoogle(t)
+	respondStates(project, StreamFailed, StreamFailed, StreamFailed, StreamRunning)
+
+	if err := g.ResumeStream(context.Background()); err != nil {
+		t.Fatalf("ResumeStream: %v", err)
+	}
+	if updates := project.calledWith("datastream", "streams", "update"); len(updates) != 1 || !contains(updates[0], "--state=RUNNING") {
+		t.Errorf("got updates %v, want one to RUNNING", updates)
+	}
+}
+
+func TestResumeFailedStreamThatStaysFailed(t *testing.T) {
+	setStreamPolling(t, time.Millisecond, 20*time.Millisecond)
+	g, project := newTestGoogle(t)
+	respondStates(project, StreamFailed)
+
+	err := g.ResumeStream(context.Background())
+	if err == nil || !strings.Contains(err.Error(), StreamFailed) {
+		t.Fatalf("ResumeStream returned %v, want the stream to be failed", err)
+	}
+}
+
+func TestResumeStreamThatFails(t *testing.T) {
+	setStreamPolling(t, 0, time.Hour)
+	g, project := newTestGoogle(t)
+	respondStates(project, StreamPaused, StreamPaused, StreamFailed)
+
+	err := g.ResumeStream(context.Background())
+	if err == nil || !strings.Contains(err.Error(), StreamFailed) {
+		t.Fatalf("ResumeStream returned %v, want the stream to be failed", err)
+	}
+}
@@ -0,0 +1,154 @@
+package google
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/api/datastream/v1"
+)
+
+const (
+	labelCreatedBy = "created-by"
+	labelApp       = "app"
+	labelNamespace = "namespace"
+	labelDB        = "db"
+	createdByNada  = "nada"
+)
+
+// labels returns the labels put on the resources created for the app. VPCs,
+// firewall rules and service accounts can't be labelled, so they are owned
+// through the streams using them instead.
+func (g *Google) labels() map[string]string {
+	return map[string]string{
+		labelCreatedBy: createdByNada,
+		labelApp:       labelValue(g.App),
+		labelNamespace: labelValue(g.Namespace),
+		labelDB:        labelValue(g.DB),
+	}
+}
+
+// labelValue makes s a valid label value, which may only contain lowercase
+// letters, digits, dashes and underscores, and be at most 63 characters.
+func labelValue(s string) string {
+	value := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		default:
+			return '-'
+		}
+	}, s)
+
+	if len(value) > 63 {
+		value = value[:63]
+	}
+	return value
+}
+
+func isNadaOwned(labels map[string]string) bool {
+	return labels[labelCreatedBy] == createdByNada
+}
+
+// sharedResourceUsers returns, for each shared resource, the names of the
+// streams other than the app's own that depend on it, in every region.
+//
+// Every nada-owned stream depends on the VPC, the service account and the
+// firewall rule, and the private connection in its region. Streams created by
+// other tools depend on them only if their source profile uses the private
+// connection. Any stream at all depends on the Datastream API.
+func (g *Google) sharedResourceUsers(ctx context.Context) (map[string][]string, error) {
+	streams, err := g.allStreams(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles, err := g.backend.ConnectionProfiles(ctx, g.Region)
+	if err != nil {
+		return nil, err
+	}
+	viaPrivateConn := map[string]bool{}
+	for _, p := range profiles {
+		if p.PrivateConnectivity != nil && lastPathElement(p.PrivateConnectivity.PrivateConnection) == privateConnectionName {
+			viaPrivateConn[p.Name] = true
+		}
+	}
+
+	ownStream := fmt.Sprintf("projects/%v/locations/%v/streams/%v", g.Project, g.Region, generateNameFunc[DATASTREAM](g))
+	users := map[string][]string{}
+	for region, regionStreams := range streams {
+		for _, s := range regionStreams {
+			if s.Name == ownStream {
+				continue
+			}
+			name := lastPathElement(s.Name)
+			if region != g.Region {
+				name = fmt.Sprintf("%v (%v)", name, region)
+			}
+
+			usesPrivateConn := false
+			if region == g.Region {
+				usesPrivateConn = isNadaOwned(s.Labels) ||
+					(s.SourceConfig != nil && viaPrivateConn[g.connectionProfileName(lastPathElement(s.SourceConfig.SourceConnectionProfile))])
+			}
+
+			if isNadaOwned(s.Labels) || usesPrivateConn {
+				users[VPC] = append(users[VPC], name)
+				users[SERVICE_ACCOUNT] = append(users[SERVICE_ACCOUNT], name)
+				users[FIREWALLRULE] = append(users[FIREWALLRULE], name)
+			}
+			if usesPrivateConn {
+				users[PRIVATE_CONN] = append(users[PRIVATE_CONN], name)
+			}
+			users[DATASTREAM_API] = append(users[DATASTREAM_API], name)
+		}
+	}
+
+	for _, u := range users {
+		sort.Strings(u)
+	}
+	return users, nil
+}
+
+// allStreams returns the streams in every region Datastream is available in,
+// by region.
+func (g *Google) allStreams(ctx context.Context) (map[string][]*datastream.Stream, error) {
+	regions, err := g.backend.Regions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !contains(regions, g.Region) {
+		regions = append(regions, g.Region)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	streams := map[string][]*datastream.Stream{}
+	errs := []error{}
+	for _, r := range regions {
+		wg.Add(1)
+		go func(region string) {
+			defer wg.Done()
+			regionStreams, err := g.backend.Streams(ctx, region)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			streams[region] = regionStreams
+		}(r)
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return streams, nil
+}
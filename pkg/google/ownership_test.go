@@ -0,0 +1,136 @@
+package google
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestLabelValue(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		want  string
+	}{
+		{value: "app", want: "app"},
+		{value: "My_App-2", want: "my_app-2"},
+		{value: "team.app", want: "team-app"},
+		{value: "æøå", want: "---"},
+		{value: strings.Repeat("a", 70), want: strings.Repeat("a", 63)},
+	} {
+		if got := labelValue(tc.value); got != tc.want {
+			t.Errorf("labelValue(%q) = %q, want %q", tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestLabels(t *testing.T) {
+	g, _ := newTestGoogle(t)
+	g.App = "My.App"
+
+	labels := g.labels()
+	if !isNadaOwned(labels) {
+		t.Errorf("labels %v are not nada-owned", labels)
+	}
+	for k, want := range map[string]string{labelApp: "my-app", labelNamespace: "team", labelDB: "mydb"} {
+		if labels[k] != want {
+			t.Errorf("label %v is %q, want %q", k, labels[k], want)
+		}
+	}
+	if isNadaOwned(map[string]string{labelApp: "my-app"}) {
+		t.Error("resource without the created-by label is nada-owned")
+	}
+}
+
+func TestSharedResourceUsers(t *testing.T) {
+	const (
+		ownStream   = `{"name": "projects/test-project/locations/europe-north1/streams/postgres-mydb-bigquery", "labels": {"created-by": "nada"}}`
+		otherRegion = "europe-west1"
+	)
+
+	for _, tc := range []struct {
+		name string
+		// streams are the streams listed in each region
+		streams map[string]string
+		// profiles are the connection profiles listed in the region of g
+		profiles string
+		want     map[string][]string
+	}{
+		{
+			name:    "only stream",
+			streams: map[string]string{testRegion: "[" + ownStream + "]"},
+			want:    map[string][]string{},
+		},
+		{
+			name: "nada-owned stream",
+			streams: map[string]string{testRegion: `[` + ownStream + `,
+				{"name": "projects/test-project/locations/europe-north1/streams/postgres-other-bigquery", "labels": {"created-by": "nada"}}
+			]`},
+			want: map[string][]string{
+				VPC:             {"postgres-other-bigquery"},
+				SERVICE_ACCOUNT: {"postgres-other-bigquery"},
+				FIREWALLRULE:    {"postgres-other-bigquery"},
+				PRIVATE_CONN:    {"postgres-other-bigquery"},
+				DATASTREAM_API:  {"postgres-other-bigquery"},
+			},
+		},
+		{
+			name: "nada-owned stream in another region",
+			streams: map[string]string{
+				testRegion:  "[" + ownStream + "]",
+				otherRegion: `[{"name": "projects/test-project/locations/europe-west1/streams/postgres-other-bigquery", "labels": {"created-by": "nada"}}]`,
+			},
+			want: map[string][]string{
+				VPC:             {"postgres-other-bigquery (europe-west1)"},
+				SERVICE_ACCOUNT: {"postgres-other-bigquery (europe-west1)"},
+				FIREWALLRULE:    {"postgres-other-bigquery (europe-west1)"},
+				DATASTREAM_API:  {"postgres-other-bigquery (europe-west1)"},
+			},
+		},
+		{
+			name: "other stream through the private connection",
+			streams: map[string]string{testRegion: `[` + ownStream + `,
+				{"name": "projects/test-project/locations/europe-north1/streams/manual", "sourceConfig": {"sourceConnectionProfile": "projects/test-project/locations/europe-north1/connectionProfiles/manual-source"}}
+			]`},
+			profiles: `[{"name": "projects/test-project/locations/europe-north1/connectionProfiles/manual-source", "privateConnectivity": {"privateConnection": "projects/test-project/locations/europe-north1/privateConnections/` + privateConnectionName + `"}}]`,
+			want: map[string][]string{
+				VPC:             {"manual"},
+				SERVICE_ACCOUNT: {"manual"},
+				FIREWALLRULE:    {"manual"},
+				PRIVATE_CONN:    {"manual"},
+				DATASTREAM_API:  {"manual"},
+			},
+		},
+		{
+			name: "other stream",
+			streams: map[string]string{testRegion: `[` + ownStream + `,
+				{"name": "projects/test-project/locations/europe-north1/streams/manual", "sourceConfig": {"sourceConnectionProfile": "projects/test-project/locations/europe-north1/connectionProfiles/manual-source"}}
+			]`},
+			profiles: `[{"name": "projects/test-project/locations/europe-north1/connectionProfiles/manual-source"}]`,
+			want: map[string][]string{
+				DATASTREAM_API: {"manual"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g, project := newTestGoogle(t)
+			project.respond(`[{"locationId": "europe-north1"}, {"locationId": "europe-west1"}]`, "datastream", "locations", "list")
+			for region, streams := range tc.streams {
+				project.respond(streams, "datastream", "streams", "list", "--location="+region)
+			}
+			if tc.profiles != "" {
+				project.respond(tc.profiles, "datastream", "connection-profiles", "list")
+			}
+
+			users, err := g.sharedResourceUsers(context.Background())
+			if err != nil {
+				t.Fatalf("sharedResourceUsers: %v", err)
+			}
+
+			for _, k := range deleteOrder() {
+				if got, want := strings.Join(users[k], ","), strings.Join(tc.want[k], ","); got != want {
+					t.Errorf("%v: got users %q, want %q", k, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"google.golang.org/api/datastream/v1"
+)
+
+const (
+	ActionCreate = "create"
+	ActionSkip   = "skip"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// PlannedChange is what a create or delete run would do with a single resource.
+type PlannedChange struct {
+	Resource string `json:"resource"`
+	Name     string `json:"name"`
+	Action   string `json:"action"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Plan describes the changes a create or delete run would make, without making them.
+type Plan struct {
+	Changes []PlannedChange `json:"changes"`
+	// Stream is the stream that would be sent to Datastream, if the stream would be created.
+	Stream *datastream.Stream `json:"stream,omitempty"`
+	// Update is how an existing stream would be updated.
+	Update *StreamUpdate `json:"update,omitempty"`
+}
+
+func (p *Plan) add(resource, name, action, reason string) {
+	p.Changes = append(p.Changes, PlannedChange{
+		Resource: resource,
+		Name:     name,
+		Action:   action,
+		Reason:   reason,
+	})
+}
+
+// Write prints the plan in a human readable form.
+func (p *Plan) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ACTION\tRESOURCE\tNAME\tREASON")
+	for _, c := range p.Changes {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\n", c.Action, c.Resource, c.Name, c.Reason)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if p.Stream != nil {
+		streamJSON, err := json.MarshalIndent(p.Stream, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "\nStream config:\n%s\n", streamJSON)
+	}
+
+	if p.Update != nil {
+		fmt.Fprintln(w)
+		return p.Update.Write(w)
+	}
+
+	return nil
+}
+
+// PlanCreate returns what CreateResources would do, looking up existing resources only.
+func (g *Google) PlanCreate(ctx context.Context) (*Plan, error) {
+	plan := &Plan{}
+
+	enabled, err := g.backend.EnabledServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range requiredAPIs {
+		if contains(enabled, a) {
+			plan.add("API", a, ActionSkip, "already enabled")
+		} else {
+			plan.add("API", a, ActionCreate, "")
+		}
+	}
+
+	for _, k := range createOrder() {
+		name := generateNameFunc[k](g)
+		exist, err := checkExistenceFunc[k](*g, ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if exist {
+			plan.add(k, name, ActionSkip, "already exists")
+			continue
+		}
+
+		if k == DATASTREAM {
+			if err := g.planStream(ctx, plan, name); err != nil {
+				return nil, err
+			}
+		}
+		plan.add(k, name, ActionCreate, "")
+	}
+
+	return plan, nil
+}
+
+func (g *Google) planStream(ctx context.Context, plan *Plan, streamName string) error {
+	pgConfig, err := g.createPostgresStreamConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	if g.DatasetPerSchema {
+		schemas := objectSchemas(pgConfig.IncludeObjects)
+		if len(schemas) == 0 {
+			schemas = []string{"<schema>"}
+		}
+		for _, s := range schemas {
+			plan.add("BigQuery dataset", g.datasetID()+"_"+s, ActionCreate, "created by datastream when the stream runs")
+		}
+	} else {
+		exists, err := g.backend.DatasetExists(ctx, g.datasetID())
+		if err != nil {
+			return err
+		}
+		if exists {
+			plan.add("BigQuery dataset", g.datasetID(), ActionSkip, "already exists")
+		} else {
+			plan.add("BigQuery dataset", g.datasetID(), ActionCreate, "")
+		}
+	}
+	plan.Stream = g.streamSpec(streamName, pgConfig, g.bigQueryStreamConfig())
+
+	return nil
+}
+
+// PlanDelete returns what DeleteResources would do, looking up existing resources only.
+func (g *Google) PlanDelete(ctx context.Context) (*Plan, error) {
+	plan := &Plan{}
+
+	users, err := g.sharedResourceUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, k := range deleteOrder() {
+		name := generateNameFunc[k](g)
+		if isSharedGlobalResource[k] && len(users[k]) > 0 {
+			plan.add(k, name, ActionSkip, "used by datastream(s) "+strings.Join(users[k], ", "))
+			continue
+		}
+
+		exist, err := checkExistenceFunc[k](*g, ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if exist {
+			plan.add(k, name, ActionDelete, "")
+		} else {
+			plan.add(k, name, ActionSkip, "does not exist")
+		}
+	}
+
+	return plan, nil
+}
@@ -0,0 +1,157 @@
+package google
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// planned returns the change planned for the resource with name, or the zero
+// change if it is not in the plan.
+func planned(plan *Plan, resource, name string) PlannedChange {
+	for _, c := range plan.Changes {
+		if c.Resource == resource && c.Name == name {
+			return c
+		}
+	}
+	return PlannedChange{}
+}
+
+func TestPlanCreate(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		created bool
+		want    string
+	}{
+		{name: "empty project", want: ActionCreate},
+		{name: "resources exist", created: true, want: ActionSkip},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			g, project := newTestGoogle(t)
+			if tc.created {
+				if err := g.CreateResources(ctx); err != nil {
+					t.Fatalf("CreateResources: %v", err)
+				}
+			}
+			before := len(project.calledWith())
+
+			plan, err := g.PlanCreate(ctx)
+			if err != nil {
+				t.Fatalf("PlanCreate: %v", err)
+			}
+
+			for _, a := range requiredAPIs {
+				if c := planned(plan, "API", a); c.Action != tc.want {
+					t.Errorf("API %v: got action %q, want %q", a, c.Action, tc.want)
+				}
+			}
+			for _, k := range createOrder() {
+				if c := planned(plan, k, generateNameFunc[k](g)); c.Action != tc.want {
+					t.Errorf("%v: got action %q, want %q", k, c.Action, tc.want)
+				}
+			}
+			if (plan.Stream != nil) != !tc.created {
+				t.Errorf("got stream config %v, want it only for a stream that would be created", plan.Stream)
+			}
+			for _, c := range project.calledWith()[before:] {
+				if verb := c[len(c)-2]; verb == "create" || verb == "create-with-container" || verb == "enable" {
+					t.Errorf("planning ran %v", c)
+				}
+			}
+		})
+	}
+}
+
+func TestPlanDelete(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		// otherStream is a nada-owned stream of another app in the project
+		otherStream bool
+		want        map[string]string
+	}{
+		{
+			name: "only stream",
+			want: map[string]string{
+				DATASTREAM:      ActionDelete,
+				SQL_PROXY:       ActionDelete,
+				VPC:             ActionDelete,
+				SERVICE_ACCOUNT: ActionDelete,
+				// the API is not reported as enabled
+				DATASTREAM_API: ActionSkip,
+			},
+		},
+		{
+			name:        "shared with another stream",
+			otherStream: true,
+			want: map[string]string{
+				DATASTREAM:      ActionDelete,
+				SQL_PROXY:       ActionDelete,
+				VPC:             ActionSkip,
+				SERVICE_ACCOUNT: ActionSkip,
+				PRIVATE_CONN:    ActionSkip,
+				DATASTREAM_API:  ActionSkip,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			g, project := newTestGoogle(t)
+			if err := g.CreateResources(ctx); err != nil {
+				t.Fatalf("CreateResources: %v", err)
+			}
+			if tc.otherStream {
+				project.respond(`[
+					{"name": "projects/test-project/locations/europe-north1/streams/postgres-mydb-bigquery", "labels": {"created-by": "nada"}},
+					{"name": "projects/test-project/locations/europe-north1/streams/postgres-other-bigquery", "labels": {"created-by": "nada"}}
+				]`, "datastream", "streams", "list")
+			}
+
+			plan, err := g.PlanDelete(ctx)
+			if err != nil {
+				t.Fatalf("PlanDelete: %v", err)
+			}
+
+			for k, want := range tc.want {
+				c := planned(plan, k, generateNameFunc[k](g))
+				if c.Action != want {
+					t.Errorf("%v: got action %q, want %q", k, c.Action, want)
+				}
+				if tc.otherStream && isSharedGlobalResource[k] && !strings.Contains(c.Reason, "postgres-other-bigquery") {
+					t.Errorf("%v: reason %q does not name the stream using it", k, c.Reason)
+				}
+			}
+			if left := project.managed(g); len(left) != len(createOrder()) {
+				t.Errorf("planning deleted resources, left %v", left)
+			}
+		})
+	}
+}
+
+func TestPlanWrite(t *testing.T) {
+	plan := &Plan{}
+	plan.add(VPC, vpcName, ActionSkip, "already exists")
+	plan.add(DATASTREAM, "postgres-mydb-bigquery", ActionCreate, "")
+
+	out := &strings.Builder{}
+	if err := plan.Write(out); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %v lines, want a header and one per change:\n%v", len(lines), out)
+	}
+	for i, want := range [][]string{
+		{"ACTION", "RESOURCE", "NAME", "REASON"},
+		{ActionSkip, VPC, vpcName, "already", "exists"},
+		{ActionCreate, DATASTREAM, "postgres-mydb-bigquery"},
+	} {
+		if got := strings.Fields(lines[i]); strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("line %v: got %q, want %q", i, got, want)
+		}
+	}
+	if strings.Contains(out.String(), "Stream config") {
+		t.Errorf("plan without a stream writes a stream config:\n%v", out)
+	}
+}
@@ -3,6 +3,8 @@ package google
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 )
 
 const (
@@ -40,6 +42,13 @@ var createResourceFunc map[string]func(Google, context.Context, string) error =
 	VPC:                 Google.createVPC,
 }
 
+// resumeResourceFunc finishes creating resources that were being created when a
+// run was interrupted, for the resources that are not ready as soon as they exist.
+var resumeResourceFunc map[string]func(Google, context.Context, string) error = map[string]func(Google, context.Context, string) error{
+	SERVICE_ACCOUNT: func(g Google, ctx context.Context, s string) error { return g.grantSARoles(ctx, s) },
+	PRIVATE_CONN:    func(g Google, ctx context.Context, s string) error { return g.waitForPrivateConnectionUp(ctx) },
+}
+
 var isSharedGlobalResource map[string]bool = map[string]bool{
 	DATASTREAM:          false,
 	SOURCE_PROFILE:      false,
@@ -103,100 +112,162 @@ func resourceListToString(resources []string) string {
 }
 
 func (g *Google) DeleteResources(ctx context.Context) error {
-	otherStream, err := g.anyOtherStreamExistis(ctx)
+	users, err := g.sharedResourceUsers(ctx)
 	if err != nil {
 		return err
 	}
 
-	resources := []string{
-		DATASTREAM,
-		SOURCE_PROFILE,
-		DESTINATION_PROFILE,
-		SERVICE_ACCOUNT,
-		FIREWALLRULE,
-		PRIVATE_CONN,
-		VPC,
-		SQL_PROXY,
-		DATASTREAM_API,
-	}
-
-	for i, k := range resources {
+	resources := deleteOrder()
 
-		if isSharedGlobalResource[k] && otherStream {
-			g.log.Infof("Other datastream(s) depends on resource [%v], skip deletion", k)
-			continue
+	deleted, err := walkGraph(ctx, resources, dependents(), func(ctx context.Context, k string) error {
+		if isSharedGlobalResource[k] && len(users[k]) > 0 {
+			g.log.Infof("Datastream(s) %v depends on resource [%v], skip deletion", strings.Join(users[k], ", "), k)
+			return nil
 		}
 
 		exist, err := checkExistenceFunc[k](*g, ctx, generateNameFunc[k](g))
 		if err != nil {
-			g.log.Infof("Terminated on error, following resource(s) has not been cleaned up: %v",
-				resourceListToString(resources[i:]))
 			return err
 		}
 
-		if exist {
-			err = deleteResourceFunc[k](*g, ctx, generateNameFunc[k](g))
-			if err != nil {
-				g.log.Infof("Terminated on error, following resource(s) has not been cleaned up: %v",
-					resourceListToString(resources[i:]))
-				return err
-			}
-		} else {
+		if !exist {
 			g.log.Infof("Resource [%v] does not exist, skip deletion", k)
+			return nil
 		}
+		return deleteResourceFunc[k](*g, ctx, generateNameFunc[k](g))
+	})
+	if err != nil {
+		g.log.Infof("Terminated on error, following resource(s) has not been cleaned up: %v",
+			resourceListToString(notIn(resources, deleted)))
+		return err
 	}
-	return nil
+
+	// what an unfinished create run created is gone now
+	run, err := g.loadJournal()
+	if err != nil || run == nil {
+		return err
+	}
+	return run.remove()
 }
 
 func (g *Google) CreateResources(ctx context.Context) error {
-	err := g.EnableAPIs(ctx)
+	run, err := g.loadJournal()
 	if err != nil {
 		return err
 	}
 
-	resources := []string{
-		VPC,
-		SERVICE_ACCOUNT,
-		SQL_PROXY,
-		PRIVATE_CONN,
-		FIREWALLRULE,
-		SOURCE_PROFILE,
-		DESTINATION_PROFILE,
-		DATASTREAM,
+	streamName := generateNameFunc[DATASTREAM](g)
+	switch {
+	case run != nil && !g.Resume:
+		return fmt.Errorf("an unfinished run for datastream %v was started %v, continue it with --resume or delete what it created with rollback",
+			streamName, run.Started.Format(time.RFC3339))
+	case run == nil && g.Resume:
+		return fmt.Errorf("found no unfinished run for datastream %v to resume", streamName)
+	case run == nil:
+		run, err = g.newJournal()
+		if err != nil {
+			return err
+		}
+	default:
+		g.log.Infof("Resuming run started %v, already created: %v", run.Started.Format(time.RFC3339), resourceListToString(run.Created))
+	}
+
+	err = g.EnableAPIs(ctx)
+	if err != nil {
+		return err
 	}
 
-	createdResources := []string{}
-	exist := false
-	for _, k := range resources {
-		exist, err = checkExistenceFunc[k](*g, ctx, generateNameFunc[k](g))
+	_, err = walkGraph(ctx, createOrder(), resourceDependencies, func(ctx context.Context, k string) error {
+		exist, err := checkExistenceFunc[k](*g, ctx, generateNameFunc[k](g))
 		if err != nil {
-			goto __error
+			return err
+		}
+		if exist && run.inProgress(k) {
+			g.log.Infof("Resource [%v] was being created when the run was interrupted, resuming", k)
+			if resume, ok := resumeResourceFunc[k]; ok {
+				if err := resume(*g, ctx, generateNameFunc[k](g)); err != nil {
+					return err
+				}
+			}
+			return run.created(k)
 		}
 		if exist {
 			g.log.Info(fmt.Sprintf("Resource [%v] exists, skip creation", k))
-			continue
+			return nil
 		}
-		err = createResourceFunc[k](*g, ctx, generateNameFunc[k](g))
-		if err != nil {
-			goto __error
+
+		if err := run.started(k); err != nil {
+			return err
+		}
+		if err := createResourceFunc[k](*g, ctx, generateNameFunc[k](g)); err != nil {
+			return err
 		}
-		createdResources = append([]string{k}, createdResources...)
+		return run.created(k)
+	})
+	if err != nil {
+		g.log.Errorf("Failed to create datastream: %v", err)
+		if rbErr := g.rollback(ctx, run); rbErr != nil {
+			g.log.Error(rbErr)
+		}
+		return err
+	}
+
+	if err := run.remove(); err != nil {
+		return err
+	}
+
+	if g.Start {
+		return g.StartStream(ctx)
+	}
+	return nil
+}
+
+// Rollback deletes the resources created by an unfinished or failed create run.
+func (g *Google) Rollback(ctx context.Context) error {
+	run, err := g.loadJournal()
+	if err != nil {
+		return err
+	}
+	if run == nil {
+		return fmt.Errorf("found no unfinished run for datastream %v to roll back", generateNameFunc[DATASTREAM](g))
 	}
-	return err
 
-__error:
-	g.log.Errorf("Failed to create datastream: %v", err)
-	if len(createdResources) > 0 {
+	return g.rollback(ctx, run)
+}
+
+// rollback deletes the resources created by run, in reverse dependency order.
+// The journal of the run is removed once everything it created is deleted.
+func (g *Google) rollback(ctx context.Context, run *journal) error {
+	owned := run.owned()
+	if len(owned) > 0 {
 		g.log.Infof("Cleaning up...")
-		for _, k := range createdResources {
+	}
+
+	failed := []string{}
+	for _, k := range deleteOrder() {
+		if !contains(owned, k) {
+			continue
+		}
+
+		exist, err := checkExistenceFunc[k](*g, ctx, generateNameFunc[k](g))
+		if err == nil && exist {
 			err = deleteResourceFunc[k](*g, ctx, generateNameFunc[k](g))
-			if err != nil {
-				g.log.Error(err)
-				g.log.Infof("Failed to delete [%v], and it has to be manually cleaned up.", k)
-			} else {
-				g.log.Infof("[%v] deleted", k)
-			}
 		}
+		if err != nil {
+			g.log.Error(err)
+			g.log.Infof("Failed to delete [%v], and it has to be manually cleaned up.", k)
+			failed = append(failed, k)
+			continue
+		}
+
+		g.log.Infof("[%v] deleted", k)
+		if err := run.deleted(k); err != nil {
+			return err
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to delete %v, run rollback again to retry", resourceListToString(failed))
 	}
-	return err
+	return run.remove()
 }
@@ -0,0 +1,373 @@
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/navikt/nada-datastream/cmd"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	testProject = "test-project"
+	testRegion  = "europe-north1"
+)
+
+// fakeProject answers the gcloud commands for the managed resources from an
+// in-memory project, so that what is created and deleted can be inspected.
+type fakeProject struct {
+	*fakeExecutor
+
+	mu        sync.Mutex
+	resources map[string][]string
+}
+
+// fakeCollection is a kind of resource, managed with the gcloud commands
+// starting with prefix.
+type fakeCollection struct {
+	prefix []string
+	// item returns what list and describe return for the resource with id.
+	item func(id string) map[string]any
+}
+
+func nameItem(id string) map[string]any {
+	return map[string]any{"name": id}
+}
+
+func datastreamItem(collection string) func(string) map[string]any {
+	return func(id string) map[string]any {
+		return map[string]any{
+			"name":         fmt.Sprintf("projects/%v/locations/%v/%v/%v", testProject, testRegion, collection, id),
+			"display_name": id,
+			"state":        "CREATED",
+		}
+	}
+}
+
+var fakeCollections = []fakeCollection{
+	{prefix: []string{"services"}, item: func(id string) map[string]any {
+		return nameItem(fmt.Sprintf("projects/%v/services/%v", testProject, id))
+	}},
+	{prefix: []string{"compute", "networks"}, item: nameItem},
+	{prefix: []string{"compute", "firewall-rules"}, item: nameItem},
+	{prefix: []string{"compute", "instances"}, item: func(id string) map[string]any {
+		return map[string]any{
+			"name": id,
+			"networkInterfaces": []map[string]string{
+				{"network": fmt.Sprintf("projects/%v/global/networks/%v", testProject, vpcName), "networkIP": "10.0.0.2"},
+			},
+		}
+	}},
+	{prefix: []string{"iam", "service-accounts"}, item: func(id string) map[string]any {
+		return map[string]any{"email": fmt.Sprintf("%v@%v.iam.gserviceaccount.com", id, testProject)}
+	}},
+	{prefix: []string{"datastream", "private-connections"}, item: datastreamItem("privateConnections")},
+	{prefix: []string{"datastream", "connection-profiles"}, item: datastreamItem("connectionProfiles")},
+	{prefix: []string{"datastream", "streams"}, item: datastreamItem("streams")},
+}
+
+func newFakeProject() *fakeProject {
+	p := &fakeProject{
+		fakeExecutor: newFakeExecutor(),
+		resources:    map[string][]string{},
+	}
+	p.register()
+	return p
+}
+
+// register makes the executor answer from the project.
+func (p *fakeProject) register() {
+	p.respond(fmt.Sprintf(`[{"locationId": %q}]`, testRegion), "datastream", "locations", "list")
+	for _, c := range fakeCollections {
+		p.handle(p.handler(c), c.prefix...)
+	}
+}
+
+func (p *fakeProject) handler(c fakeCollection) func([]string) (string, error) {
+	key := strings.Join(c.prefix, " ")
+
+	return func(args []string) (string, error) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		verb := args[len(c.prefix)]
+		id := ""
+		if len(args) > len(c.prefix)+1 {
+			// service accounts are deleted by email
+			id, _, _ = strings.Cut(args[len(c.prefix)+1], "@")
+		}
+
+		var out any = []any{}
+		switch verb {
+		case "list":
+			items := []map[string]any{}
+			for _, r := range p.resources[key] {
+				items = append(items, c.item(r))
+			}
+			out = items
+		case "describe":
+			if !contains(p.resources[key], id) {
+				return "", fmt.Errorf("%v %v not found", key, id)
+			}
+			out = c.item(id)
+		case "create", "create-with-container", "enable":
+			if contains(p.resources[key], id) {
+				return "", fmt.Errorf("%v %v already exists", key, id)
+			}
+			p.resources[key] = append(p.resources[key], id)
+		case "delete", "disable":
+			if !contains(p.resources[key], id) {
+				return "", fmt.Errorf("%v %v not found", key, id)
+			}
+			p.resources[key] = notIn(p.resources[key], []string{id})
+		}
+
+		bytes, err := json.Marshal(out)
+		return string(bytes), err
+	}
+}
+
+// command returns the prefix of the gcloud command creating or deleting the
+// managed resource k of g.
+func (p *fakeProject) command(g *Google, k, verb string) []string {
+	name := generateNameFunc[k](g)
+	switch k {
+	case DATASTREAM_API:
+		return []string{"services", "disable", name}
+	case SQL_PROXY:
+		if verb == "create" {
+			verb = "create-with-container"
+		}
+		return []string{"compute", "instances", verb, name}
+	case SERVICE_ACCOUNT:
+		if verb == "delete" {
+			name = g.SAID(name)
+		}
+		return []string{"iam", "service-accounts", verb, name}
+	case VPC:
+		return []string{"compute", "networks", verb, name}
+	case FIREWALLRULE:
+		return []string{"compute", "firewall-rules", verb, name}
+	case PRIVATE_CONN:
+		return []string{"datastream", "private-connections", verb, name}
+	case SOURCE_PROFILE, DESTINATION_PROFILE:
+		return []string{"datastream", "connection-profiles", verb, name}
+	case DATASTREAM:
+		return []string{"datastream", "streams", verb, name}
+	}
+	panic("unknown resource " + k)
+}
+
+// exists reports whether the managed resource k of g is in the project.
+func (p *fakeProject) exists(g *Google, k string) bool {
+	cmd := p.command(g, k, "create")
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	id, _, _ := strings.Cut(cmd[len(cmd)-1], "@")
+	return contains(p.resources[strings.Join(cmd[:len(cmd)-2], " ")], id)
+}
+
+// managed returns the managed resources of g in the project, besides the
+// datastream API.
+func (p *fakeProject) managed(g *Google) []string {
+	managed := []string{}
+	for _, k := range createOrder() {
+		if p.exists(g, k) {
+			managed = append(managed, k)
+		}
+	}
+	return managed
+}
+
+func newTestGoogle(t *testing.T) (*Google, *fakeProject) {
+	t.Helper()
+
+	dir := t.TempDir()
+	original := journalDir
+	journalDir = func() (string, error) { return dir, nil }
+	t.Cleanup(func() { journalDir = original })
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	project := newFakeProject()
+	g := NewWithExecutor(logrus.NewEntry(log), &cmd.Config{
+		DBConfig: &cmd.DBConfig{
+			App:       "app",
+			Namespace: "team",
+			Project:   testProject,
+			Region:    testRegion,
+			Instance:  "app-instance",
+			DB:        "mydb",
+			User:      "datastream",
+			Password:  "secret",
+		},
+		ReplicationSlot: cmd.DefaultReplicationSlot,
+		Publication:     cmd.DefaultPublication,
+		DataFreshness:   cmd.DefaultDataFreshness,
+		// datastream creates the datasets, so no bigquery client is needed
+		DatasetPerSchema: true,
+	}, project)
+
+	return g, project
+}
+
+func TestCreateResources(t *testing.T) {
+	ctx := context.Background()
+	g, project := newTestGoogle(t)
+
+	if err := g.CreateResources(ctx); err != nil {
+		t.Fatalf("CreateResources: %v", err)
+	}
+
+	if got, want := project.managed(g), createOrder(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("created %v, want %v", got, want)
+	}
+	run, err := g.loadJournal()
+	if err != nil || run != nil {
+		t.Errorf("journal of finished run is not removed: %v, %v", run, err)
+	}
+}
+
+func TestCreateResourcesRollsBackOnFailure(t *testing.T) {
+	for _, failing := range createOrder() {
+		t.Run(failing, func(t *testing.T) {
+			ctx := context.Background()
+			g, project := newTestGoogle(t)
+			failure := errors.New("injected failure")
+			project.fail(failure, project.command(g, failing, "create")...)
+
+			err := g.CreateResources(ctx)
+			if !errors.Is(err, failure) {
+				t.Fatalf("CreateResources returned %v, want the injected failure", err)
+			}
+
+			if left := project.managed(g); len(left) > 0 {
+				t.Errorf("resources left after rollback: %v", left)
+			}
+			for _, dep := range resourceDependencies[failing] {
+				if _, ok := createResourceFunc[dep]; !ok {
+					continue
+				}
+				if len(project.calledWith(project.command(g, dep, "create")...)) != 1 {
+					t.Errorf("dependency %v was not created before %v", dep, failing)
+				}
+				if len(project.calledWith(project.command(g, dep, "delete")...)) != 1 {
+					t.Errorf("dependency %v was not rolled back", dep)
+				}
+			}
+			for _, k := range createOrder() {
+				if dependsOn(k, failing) && len(project.calledWith(project.command(g, k, "create")...)) > 0 {
+					t.Errorf("%v was created after %v failed", k, failing)
+				}
+			}
+
+			run, err := g.loadJournal()
+			if err != nil || run != nil {
+				t.Errorf("journal of rolled back run is not removed: %v, %v", run, err)
+			}
+		})
+	}
+}
+
+func TestRollbackAfterFailedCleanup(t *testing.T) {
+	ctx := context.Background()
+	g, project := newTestGoogle(t)
+	project.fail(errors.New("injected failure"), project.command(g, DATASTREAM, "create")...)
+	project.fail(errors.New("injected failure"), project.command(g, VPC, "delete")...)
+
+	if err := g.CreateResources(ctx); err == nil {
+		t.Fatal("CreateResources succeeded, want the injected failure")
+	}
+	if left := project.managed(g); len(left) != 1 || left[0] != VPC {
+		t.Fatalf("resources left after failed rollback: %v, want only %v", left, VPC)
+	}
+
+	run, err := g.loadJournal()
+	if err != nil || run == nil {
+		t.Fatalf("journal of the run is not kept after failed rollback: %v", err)
+	}
+	if owned := run.owned(); len(owned) != 1 || owned[0] != VPC {
+		t.Errorf("journal owns %v, want only %v", owned, VPC)
+	}
+	if err := g.CreateResources(ctx); err == nil || !strings.Contains(err.Error(), "rollback") {
+		t.Errorf("CreateResources with unfinished run returned %v, want hint about rollback", err)
+	}
+
+	project.reset()
+	project.register()
+	if err := g.Rollback(ctx); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	if left := project.managed(g); len(left) > 0 {
+		t.Errorf("resources left after rollback: %v", left)
+	}
+	if run, err := g.loadJournal(); err != nil || run != nil {
+		t.Errorf("journal is not removed after rollback: %v, %v", run, err)
+	}
+}
+
+func TestDeleteResources(t *testing.T) {
+	ctx := context.Background()
+	g, project := newTestGoogle(t)
+	if err := g.CreateResources(ctx); err != nil {
+		t.Fatalf("CreateResources: %v", err)
+	}
+
+	if err := g.DeleteResources(ctx); err != nil {
+		t.Fatalf("DeleteResources: %v", err)
+	}
+
+	if left := project.managed(g); len(left) > 0 {
+		t.Errorf("resources left after delete: %v", left)
+	}
+}
+
+func TestDeleteResourcesStopsOnFailure(t *testing.T) {
+	// the datastream API is never reported as existing, so deleting it can't fail
+	for _, failing := range notIn(deleteOrder(), []string{DATASTREAM_API}) {
+		t.Run(failing, func(t *testing.T) {
+			ctx := context.Background()
+			g, project := newTestGoogle(t)
+			if err := g.CreateResources(ctx); err != nil {
+				t.Fatalf("CreateResources: %v", err)
+			}
+			failure := errors.New("injected failure")
+			project.fail(failure, project.command(g, failing, "delete")...)
+
+			err := g.DeleteResources(ctx)
+			if !errors.Is(err, failure) {
+				t.Fatalf("DeleteResources returned %v, want the injected failure", err)
+			}
+
+			if !project.exists(g, failing) {
+				t.Errorf("%v was deleted despite the failure", failing)
+			}
+			for _, k := range createOrder() {
+				if dependsOn(failing, k) && !project.exists(g, k) {
+					t.Errorf("%v was deleted before %v, which depends on it", k, failing)
+				}
+				if dependsOn(k, failing) && project.exists(g, k) {
+					t.Errorf("%v, which depends on %v, was not deleted", k, failing)
+				}
+			}
+		})
+	}
+}
+
+// dependsOn reports whether resource depends on dependency, directly or through other resources.
+func dependsOn(resource, dependency string) bool {
+	for _, d := range resourceDependencies[resource] {
+		if d == dependency || dependsOn(d, dependency) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package google
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// ResourceStatus is the current state of a single managed resource.
+type ResourceStatus struct {
+	Resource string `json:"resource"`
+	Name     string `json:"name"`
+	Exists   bool   `json:"exists"`
+	State    string `json:"state,omitempty"`
+	Details  string `json:"details,omitempty"`
+}
+
+type Status struct {
+	Resources []ResourceStatus `json:"resources"`
+}
+
+// resourceStateFunc returns the state of the resources that have one, along
+// with any details explaining it.
+var resourceStateFunc map[string]func(Google, context.Context, string) (string, string, error) = map[string]func(Google, context.Context, string) (string, string, error){
+	SQL_PROXY:    Google.cloudSQLProxyState,
+	PRIVATE_CONN: Google.privateConnectionState,
+	DATASTREAM:   Google.streamState,
+}
+
+// Status reports whether each resource managed for the app exists, and the
+// state of the resources that have one.
+func (g *Google) Status(ctx context.Context) (*Status, error) {
+	status := &Status{}
+	for _, k := range createOrder() {
+		name := generateNameFunc[k](g)
+		exist, err := checkExistenceFunc[k](*g, ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		rs := ResourceStatus{
+			Resource: k,
+			Name:     name,
+			Exists:   exist,
+		}
+		if stateFunc, ok := resourceStateFunc[k]; ok && exist {
+			rs.State, rs.Details, err = stateFunc(*g, ctx, name)
+			if err != nil {
+				return nil, err
+			}
+		}
+		status.Resources = append(status.Resources, rs)
+	}
+
+	return status, nil
+}
+
+// Write prints the status as a table.
+func (s *Status) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESOURCE\tNAME\tEXISTS\tSTATE\tDETAILS")
+	for _, r := range s.Resources {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\n", r.Resource, r.Name, r.Exists, r.State, r.Details)
+	}
+
+	return tw.Flush()
+}
+
+func (g Google) cloudSQLProxyState(ctx context.Context, proxyVMName string) (string, string, error) {
+	status, err := g.backend.InstanceStatus(ctx, proxyZone, proxyVMName)
+	if err != nil {
+		return "", "", err
+	}
+
+	return status, "", nil
+}
+
+func (g Google) privateConnectionState(ctx context.Context, privateConnection string) (string, string, error) {
+	privateCons, err := g.backend.PrivateConnections(ctx, g.Region)
+	if err != nil {
+		return "", "", err
+	}
+
+	for _, c := range privateCons {
+		if c.Name == fmt.Sprintf("projects/%v/locations/%v/privateConnections/%v", g.Project, g.Region, privateConnection) {
+			details := ""
+			if c.Error != nil {
+				details = c.Error.Message
+			}
+			return c.State, details, nil
+		}
+	}
+
+	return "", "", nil
+}
+
+func (g Google) streamState(ctx context.Context, streamName string) (string, string, error) {
+	datastreams, err := g.backend.Streams(ctx, g.Region)
+	if err != nil {
+		return "", "", err
+	}
+
+	for _, s := range datastreams {
+		if s.Name == fmt.Sprintf("projects/%v/locations/%v/streams/%v", g.Project, g.Region, streamName) {
+			if len(s.Errors) == 0 {
+				return s.State, "", nil
+			}
+			return s.State, streamErrors(s), nil
+		}
+	}
+
+	return "", "", nil
+}
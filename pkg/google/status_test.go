@@ -0,0 +1,104 @@
+package google
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestStatus(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		created bool
+		// streams is what listing the streams returns
+		streams string
+		want    map[string]ResourceStatus
+	}{
+		{
+			name: "empty project",
+			want: map[string]ResourceStatus{
+				DATASTREAM: {},
+				SQL_PROXY:  {},
+				VPC:        {},
+			},
+		},
+		{
+			name:    "running stream",
+			created: true,
+			streams: `[{"name": "projects/test-project/locations/europe-north1/streams/postgres-mydb-bigquery", "state": "RUNNING"}]`,
+			want: map[string]ResourceStatus{
+				DATASTREAM:   {Exists: true, State: "RUNNING"},
+				SQL_PROXY:    {Exists: true, State: "RUNNING"},
+				PRIVATE_CONN: {Exists: true, State: "CREATED"},
+				VPC:          {Exists: true},
+			},
+		},
+		{
+			name:    "failed stream",
+			created: true,
+			streams: `[{"name": "projects/test-project/locations/europe-north1/streams/postgres-mydb-bigquery", "state": "FAILED", "errors": [{"message": "replication slot is missing"}, {"message": "permission denied"}]}]`,
+			want: map[string]ResourceStatus{
+				DATASTREAM: {Exists: true, State: "FAILED", Details: "replication slot is missing; permission denied"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			g, project := newTestGoogle(t)
+			if tc.created {
+				if err := g.CreateResources(ctx); err != nil {
+					t.Fatalf("CreateResources: %v", err)
+				}
+				project.respond(`{"status": "RUNNING"}`, "compute", "instances", "describe")
+				project.respond(tc.streams, "datastream", "streams", "list")
+			}
+
+			status, err := g.Status(ctx)
+			if err != nil {
+				t.Fatalf("Status: %v", err)
+			}
+
+			if len(status.Resources) != len(createOrder()) {
+				t.Errorf("got status of %v resources, want %v", len(status.Resources), len(createOrder()))
+			}
+			for _, r := range status.Resources {
+				want, ok := tc.want[r.Resource]
+				if !ok {
+					continue
+				}
+				if r.Name != generateNameFunc[r.Resource](g) {
+					t.Errorf("%v: got name %q, want %q", r.Resource, r.Name, generateNameFunc[r.Resource](g))
+				}
+				if r.Exists != want.Exists || r.State != want.State || r.Details != want.Details {
+					t.Errorf("%v: got %+v, want %+v", r.Resource, r, want)
+				}
+			}
+		})
+	}
+}
+
+func TestStatusWrite(t *testing.T) {
+	status := &Status{Resources: []ResourceStatus{
+		{Resource: VPC, Name: vpcName, Exists: true},
+		{Resource: DATASTREAM, Name: "postgres-mydb-bigquery", Exists: true, State: "FAILED", Details: "permission denied"},
+	}}
+
+	out := &strings.Builder{}
+	if err := status.Write(out); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %v lines, want a header and one per resource:\n%v", len(lines), out)
+	}
+	for i, want := range [][]string{
+		{"RESOURCE", "NAME", "EXISTS", "STATE", "DETAILS"},
+		{VPC, vpcName, "true"},
+		{DATASTREAM, "postgres-mydb-bigquery", "true", "FAILED", "permission", "denied"},
+	} {
+		if got := strings.Fields(lines[i]); strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("line %v: got %q, want %q", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package google
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/datastream/v1"
+)
+
+const (
+	defaultSchema = "public"
+	// AllTables in place of a table name means every table in the schema.
+	AllTables = "*"
+)
+
+// SplitTableName splits a table name given as schema.table, defaulting to the
+// public schema when the name has no schema.
+func SplitTableName(name string) (string, string) {
+	schema, table, found := strings.Cut(name, ".")
+	if !found {
+		return defaultSchema, name
+	}
+	return schema, table
+}
+
+// postgresqlObjects groups table names by schema, with one entry per schema in
+// the order they first appear. Names are either table, for a table in the
+// public schema, schema.table, or schema.* for every table in the schema.
+func postgresqlObjects(names []string) *datastream.PostgresqlRdbms {
+	if len(names) == 0 {
+		return nil
+	}
+
+	objects := &datastream.PostgresqlRdbms{}
+	schemas := map[string]*datastream.PostgresqlSchema{}
+	wholeSchema := map[string]bool{}
+	for _, n := range names {
+		schemaName, table := SplitTableName(strings.TrimSpace(n))
+
+		schema, ok := schemas[schemaName]
+		if !ok {
+			schema = &datastream.PostgresqlSchema{Schema: schemaName}
+			schemas[schemaName] = schema
+			objects.PostgresqlSchemas = append(objects.PostgresqlSchemas, schema)
+		}
+
+		switch {
+		case table == AllTables:
+			// a schema without tables means every table in it
+			wholeSchema[schemaName] = true
+			schema.PostgresqlTables = nil
+		case wholeSchema[schemaName]:
+		default:
+			schema.PostgresqlTables = append(schema.PostgresqlTables, &datastream.PostgresqlTable{Table: table})
+		}
+	}
+
+	return objects
+}
+
+// objectSchemas returns the schemas in objects.
+func objectSchemas(objects *datastream.PostgresqlRdbms) []string {
+	schemas := []string{}
+	if objects == nil {
+		return schemas
+	}
+
+	for _, s := range objects.PostgresqlSchemas {
+		schemas = append(schemas, s.Schema)
+	}
+	return schemas
+}
+
+// tableKey returns the name of a table as schema.table.
+func tableKey(name string) string {
+	schema, table := SplitTableName(name)
+	return schema + "." + table
+}
+
+// findTable returns the table in objects, or nil if it is not listed.
+func findTable(objects *datastream.PostgresqlRdbms, schema, table string) *datastream.PostgresqlTable {
+	if objects == nil {
+		return nil
+	}
+	for _, s := range objects.PostgresqlSchemas {
+		if s.Schema != schema {
+			continue
+		}
+		for _, t := range s.PostgresqlTables {
+			if t.Table == table {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+// postgresqlColumns returns the columns of a column selection, or nil when
+// the selection is all columns.
+func postgresqlColumns(columns []string) []*datastream.PostgresqlColumn {
+	if len(columns) == 0 || (len(columns) == 1 && columns[0] == AllTables) {
+		return nil
+	}
+
+	pgColumns := []*datastream.PostgresqlColumn{}
+	for _, c := range columns {
+		pgColumns = append(pgColumns, &datastream.PostgresqlColumn{Column: strings.TrimSpace(c)})
+	}
+	return pgColumns
+}
+
+// includeColumns limits the tables in objects to the given columns, by table.
+// Every table has to be listed in objects.
+func includeColumns(objects *datastream.PostgresqlRdbms, columns map[string][]string) error {
+	for name, cols := range columns {
+		schema, table := SplitTableName(name)
+		t := findTable(objects, schema, table)
+		if t == nil {
+			return fmt.Errorf("columns are selected for %v.%v, but the table is not in the included tables", schema, table)
+		}
+		t.PostgresqlColumns = postgresqlColumns(cols)
+	}
+
+	return nil
+}
+
+// excludeColumns adds the given columns, by table, to objects, so that they are
+// left out while the rest of the table is streamed.
+func excludeColumns(objects *datastream.PostgresqlRdbms, columns map[string][]string) (*datastream.PostgresqlRdbms, error) {
+	if len(columns) == 0 {
+		return objects, nil
+	}
+	if objects == nil {
+		objects = &datastream.PostgresqlRdbms{}
+	}
+
+	for _, name := range sortedKeys(columns) {
+		pgColumns := postgresqlColumns(columns[name])
+		if pgColumns == nil {
+			continue
+		}
+
+		schemaName, table := SplitTableName(name)
+		if t := findTable(objects, schemaName, table); t != nil {
+			return nil, fmt.Errorf("columns are excluded for %v.%v, but the whole table is excluded", schemaName, table)
+		}
+
+		var schema *datastream.PostgresqlSchema
+		for _, s := range objects.PostgresqlSchemas {
+			if s.Schema == schemaName {
+				schema = s
+			}
+		}
+		if schema == nil {
+			schema = &datastream.PostgresqlSchema{Schema: schemaName}
+			objects.PostgresqlSchemas = append(objects.PostgresqlSchemas, schema)
+		} else if len(schema.PostgresqlTables) == 0 {
+			return nil, fmt.Errorf("columns are excluded for %v.%v, but the whole schema %v is excluded", schemaName, table, schemaName)
+		}
+		schema.PostgresqlTables = append(schema.PostgresqlTables, &datastream.PostgresqlTable{
+			Table:             table,
+			PostgresqlColumns: pgColumns,
+		})
+	}
+
+	return objects, nil
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// contradictions returns warnings about exclusions that contradict the
+// inclusions, where the same table or schema is both included and excluded,
+// or that have no effect since what they exclude is not included to begin with.
+func contradictions(include, exclude *datastream.PostgresqlRdbms) []string {
+	warnings := []string{}
+	if exclude == nil {
+		return warnings
+	}
+
+	includedSchema := func(schema string) *datastream.PostgresqlSchema {
+		if include == nil {
+			return nil
+		}
+		for _, s := range include.PostgresqlSchemas {
+			if s.Schema == schema {
+				return s
+			}
+		}
+		return nil
+	}
+
+	for _, s := range exclude.PostgresqlSchemas {
+		is := includedSchema(s.Schema)
+		if len(s.PostgresqlTables) == 0 {
+			switch {
+			case is != nil:
+				warnings = append(warnings, fmt.Sprintf("schema %v is both included and excluded, and will be excluded", s.Schema))
+			case include != nil:
+				warnings = append(warnings, fmt.Sprintf("excluding schema %v has no effect, as it is not included", s.Schema))
+			}
+			continue
+		}
+
+		for _, t := range s.PostgresqlTables {
+			switch {
+			case include == nil:
+			case is == nil || (len(is.PostgresqlTables) > 0 && findTable(include, s.Schema, t.Table) == nil):
+				warnings = append(warnings, fmt.Sprintf("excluding %v.%v has no effect, as it is not included", s.Schema, t.Table))
+			case len(is.PostgresqlTables) > 0 && len(t.PostgresqlColumns) == 0:
+				warnings = append(warnings, fmt.Sprintf("table %v.%v is both included and excluded, and will be excluded", s.Schema, t.Table))
+			}
+		}
+	}
+
+	return warnings
+}
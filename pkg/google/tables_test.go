@@ -0,0 +1,190 @@
+package google
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/datastream/v1"
+)
+
+// objectsString writes objects compactly, as schema[table(column ...) ...]
+// for each schema, with * for a schema without tables.
+func objectsString(objects *datastream.PostgresqlRdbms) string {
+	if objects == nil {
+		return "nil"
+	}
+
+	schemas := []string{}
+	for _, s := range objects.PostgresqlSchemas {
+		tables := []string{}
+		for _, t := range s.PostgresqlTables {
+			table := t.Table
+			if len(t.PostgresqlColumns) > 0 {
+				columns := []string{}
+				for _, c := range t.PostgresqlColumns {
+					columns = append(columns, c.Column)
+				}
+				table = fmt.Sprintf("%v(%v)", table, strings.Join(columns, " "))
+			}
+			tables = append(tables, table)
+		}
+		if len(tables) == 0 {
+			tables = []string{AllTables}
+		}
+		schemas = append(schemas, fmt.Sprintf("%v[%v]", s.Schema, strings.Join(tables, " ")))
+	}
+	return strings.Join(schemas, " ")
+}
+
+func TestPostgresqlObjects(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		tables []string
+		want   string
+	}{
+		{name: "no tables", want: "nil"},
+		{name: "public schema", tables: []string{"users", "events"}, want: "public[users events]"},
+		{name: "schemas in order", tables: []string{"audit.log", "users", " audit.changes "}, want: "audit[log changes] public[users]"},
+		{name: "whole schema", tables: []string{"audit.*"}, want: "audit[*]"},
+		{name: "whole schema after table", tables: []string{"audit.log", "audit.*", "users"}, want: "audit[*] public[users]"},
+		{name: "table after whole schema", tables: []string{"audit.*", "audit.log"}, want: "audit[*]"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := objectsString(postgresqlObjects(tc.tables)); got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestIncludeColumns(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		tables  []string
+		columns map[string][]string
+		want    string
+		err     string
+	}{
+		{name: "columns of table", tables: []string{"users", "events"}, columns: map[string][]string{"users": {"id", " name"}}, want: "public[users(id name) events]"},
+		{name: "all columns", tables: []string{"users"}, columns: map[string][]string{"public.users": {"*"}}, want: "public[users]"},
+		{name: "table not included", tables: []string{"users"}, columns: map[string][]string{"audit.log": {"id"}}, err: "audit.log"},
+		{name: "table in included schema", tables: []string{"audit.*"}, columns: map[string][]string{"audit.log": {"id"}}, err: "audit.log"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			objects := postgresqlObjects(tc.tables)
+
+			err := includeColumns(objects, tc.columns)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("got error %v, want it to name %v", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("includeColumns: %v", err)
+			}
+			if got := objectsString(objects); got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestExcludeColumns(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		tables  []string
+		columns map[string][]string
+		want    string
+		err     string
+	}{
+		{name: "no columns", tables: []string{"events"}, want: "public[events]"},
+		{name: "no excluded tables", columns: map[string][]string{"users": {"password"}}, want: "public[users(password)]"},
+		{name: "next to excluded table", tables: []string{"events"}, columns: map[string][]string{"users": {"password"}, "audit.log": {"ip"}}, want: "public[events users(password)] audit[log(ip)]"},
+		{name: "all columns", tables: []string{"events"}, columns: map[string][]string{"users": {"*"}}, want: "public[events]"},
+		{name: "excluded table", tables: []string{"users"}, columns: map[string][]string{"users": {"password"}}, err: "the whole table is excluded"},
+		{name: "excluded schema", tables: []string{"audit.*"}, columns: map[string][]string{"audit.log": {"ip"}}, err: "the whole schema audit is excluded"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			objects, err := excludeColumns(postgresqlObjects(tc.tables), tc.columns)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("got error %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("excludeColumns: %v", err)
+			}
+			if got := objectsString(objects); got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestContradictions(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		include, exclude []string
+		excludeColumns   map[string][]string
+		want             []string
+	}{
+		{name: "nothing excluded", include: []string{"users"}},
+		{name: "everything included", exclude: []string{"events", "audit.*"}},
+		{name: "table of included schema", include: []string{"audit.*"}, exclude: []string{"audit.log"}},
+		{name: "columns of included table", include: []string{"users"}, excludeColumns: map[string][]string{"users": {"password"}}},
+		{
+			name:    "table both included and excluded",
+			include: []string{"users", "events"},
+			exclude: []string{"events"},
+			want:    []string{"table public.events is both included and excluded, and will be excluded"},
+		},
+		{
+			name:    "schema both included and excluded",
+			include: []string{"audit.*"},
+			exclude: []string{"audit.*"},
+			want:    []string{"schema audit is both included and excluded, and will be excluded"},
+		},
+		{
+			name:    "schema with included table excluded",
+			include: []string{"audit.log"},
+			exclude: []string{"audit.*"},
+			want:    []string{"schema audit is both included and excluded, and will be excluded"},
+		},
+		{
+			name:    "table not included",
+			include: []string{"users"},
+			exclude: []string{"events", "audit.log"},
+			want: []string{
+				"excluding public.events has no effect, as it is not included",
+				"excluding audit.log has no effect, as it is not included",
+			},
+		},
+		{
+			name:    "schema not included",
+			include: []string{"users"},
+			exclude: []string{"audit.*"},
+			want:    []string{"excluding schema audit has no effect, as it is not included"},
+		},
+		{
+			name:           "columns of table not included",
+			include:        []string{"users"},
+			excludeColumns: map[string][]string{"events": {"payload"}},
+			want:           []string{"excluding public.events has no effect, as it is not included"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			exclude, err := excludeColumns(postgresqlObjects(tc.exclude), tc.excludeColumns)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := contradictions(postgresqlObjects(tc.include), exclude)
+			if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+				t.Errorf("got warnings %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,318 @@
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/navikt/nada-datastream/cmd"
+	"google.golang.org/api/datastream/v1"
+)
+
+const (
+	includeObjectsField  = "sourceConfig.postgresqlSourceConfig.includeObjects"
+	excludeObjectsField  = "sourceConfig.postgresqlSourceConfig.excludeObjects"
+	publicationField     = "sourceConfig.postgresqlSourceConfig.publication"
+	replicationSlotField = "sourceConfig.postgresqlSourceConfig.replicationSlot"
+	dataFreshnessField   = "destinationConfig.bigqueryDestinationConfig.dataFreshness"
+)
+
+// StreamUpdate is the difference between the live stream and the stream described by the config.
+type StreamUpdate struct {
+	// Fields are the fields of the stream that differ, as an update mask.
+	Fields []string `json:"fields"`
+	// AddedTables are the tables that are streamed after the update but not before, as schema.table.
+	AddedTables []string `json:"addedTables"`
+
+	stream *datastream.Stream
+}
+
+// Write prints the update in a human readable form.
+func (u *StreamUpdate) Write(w io.Writer) error {
+	if len(u.Fields) == 0 {
+		_, err := fmt.Fprintln(w, "Datastream is up to date")
+		return err
+	}
+
+	fmt.Fprintln(w, "Fields to update:")
+	for _, f := range u.Fields {
+		fmt.Fprintf(w, "  %v\n", f)
+	}
+	if len(u.AddedTables) > 0 {
+		fmt.Fprintln(w, "Tables to backfill:")
+		for _, t := range u.AddedTables {
+			fmt.Fprintf(w, "  %v\n", t)
+		}
+	}
+
+	return nil
+}
+
+// PlanStreamUpdate compares the live stream with the stream described by the config.
+func (g *Google) PlanStreamUpdate(ctx context.Context) (*StreamUpdate, error) {
+	streamName := generateNameFunc[DATASTREAM](g)
+	live, err := g.backend.GetStream(ctx, g.Region, streamName)
+	if err != nil {
+		return nil, err
+	}
+
+	livePg := &datastream.PostgresqlSourceConfig{}
+	if live.SourceConfig != nil && live.SourceConfig.PostgresqlSourceConfig != nil {
+		livePg = live.SourceConfig.PostgresqlSourceConfig
+	}
+
+	pgConfig, err := g.createPostgresStreamConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pgConfig.ExcludeObjects = g.keepLiveColumns(livePg, pgConfig)
+	liveBq := &datastream.BigQueryDestinationConfig{}
+	if live.DestinationConfig != nil && live.DestinationConfig.BigqueryDestinationConfig != nil {
+		liveBq = live.DestinationConfig.BigqueryDestinationConfig
+	}
+
+	if (liveBq.SourceHierarchyDatasets != nil) != g.DatasetPerSchema {
+		return nil, fmt.Errorf("datastream %v can't be changed between a single dataset and a dataset per schema, delete and create it instead", streamName)
+	}
+	bqConfig := g.bigQueryStreamConfig()
+	// an append-only datastream is kept append-only, even when none of the
+	// selected tables lack a primary key anymore, unless merging is asked for
+	// by excluding the tables without one
+	if liveBq.AppendOnly != nil && bqConfig.AppendOnly == nil {
+		if g.TablesWithoutPrimaryKey == cmd.WithoutPrimaryKeyExclude {
+			return nil, fmt.Errorf("datastream %v is append-only and can't be changed to merge changes, keep it append-only with --%v=%v or delete and create it instead",
+				streamName, cmd.TablesWithoutPrimaryKey, cmd.WithoutPrimaryKeyAppendOnly)
+		}
+		bqConfig.AppendOnly = liveBq.AppendOnly
+	}
+	if liveBq.AppendOnly == nil && bqConfig.AppendOnly != nil {
+		return nil, fmt.Errorf("datastream %v merges changes and can't be changed to append-only, delete and create it instead", streamName)
+	}
+	desired := g.streamSpec(streamName, pgConfig, bqConfig)
+
+	update := &StreamUpdate{
+		Fields:      []string{},
+		AddedTables: []string{},
+		stream:      desired,
+	}
+	for _, objects := range []struct {
+		field         string
+		live, desired *datastream.PostgresqlRdbms
+	}{
+		{field: includeObjectsField, live: livePg.IncludeObjects, desired: pgConfig.IncludeObjects},
+		{field: excludeObjectsField, live: livePg.ExcludeObjects, desired: pgConfig.ExcludeObjects},
+	} {
+		liveObjects, err := normalizedObjects(objects.live)
+		if err != nil {
+			return nil, err
+		}
+		desiredObjects, err := normalizedObjects(objects.desired)
+		if err != nil {
+			return nil, err
+		}
+		if liveObjects != desiredObjects {
+			update.Fields = append(update.Fields, objects.field)
+		}
+	}
+	if livePg.Publication != pgConfig.Publication {
+		update.Fields = append(update.Fields, publicationField)
+	}
+	if livePg.ReplicationSlot != pgConfig.ReplicationSlot {
+		update.Fields = append(update.Fields, replicationSlotField)
+	}
+	if liveBq.DataFreshness != desired.DestinationConfig.BigqueryDestinationConfig.DataFreshness {
+		update.Fields = append(update.Fields, dataFreshnessField)
+	}
+
+	update.AddedTables = addedTables(livePg, pgConfig)
+
+	return update, nil
+}
+
+// UpdateStream changes the live stream to match the config, updating only the
+// fields that differ, and starts backfill of tables that were not streamed before.
+func (g *Google) UpdateStream(ctx context.Context) error {
+	update, err := g.PlanStreamUpdate(ctx)
+	if err != nil {
+		return err
+	}
+
+	streamName := generateNameFunc[DATASTREAM](g)
+	if len(update.Fields) == 0 {
+		g.log.Infof("Datastream %v is up to date", streamName)
+		return nil
+	}
+
+	if err := g.ensureDataset(ctx); err != nil {
+		return err
+	}
+
+	g.log.Infof("Updating datastream %v: %v", streamName, resourceListToString(update.Fields))
+	if err := g.backend.UpdateStream(ctx, g.Region, streamName, update.stream, update.Fields); err != nil {
+		return err
+	}
+
+	for _, t := range update.AddedTables {
+		schema, table := SplitTableName(t)
+		if err := g.startBackfill(ctx, streamName, schema, table); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *Google) startBackfill(ctx context.Context, streamName, schema, table string) error {
+	numRetries := 5
+
+	var err error
+	for i := 0; i < numRetries; i++ {
+		// the stream does not necessarily know about the table right after the update
+		err = g.backend.StartBackfill(ctx, g.Region, streamName, schema, table)
+		if err == nil {
+			g.log.Infof("Started backfill of %v.%v", schema, table)
+			return nil
+		}
+		g.log.Infof("Waiting for datastream to discover %v.%v", schema, table)
+		if err := sleep(ctx, pollInterval); err != nil {
+			return err
+		}
+	}
+
+	return fmt.Errorf("starting backfill of %v.%v: %w", schema, table, err)
+}
+
+// keepLiveColumns copies the column selections of the live stream to the
+// desired config for the tables the config doesn't select columns for, so that
+// columns selected earlier, or in the console, survive updates. A selection is
+// dropped by selecting * for the table. It returns the desired exclude objects,
+// which may have to be created.
+func (g *Google) keepLiveColumns(live, desired *datastream.PostgresqlSourceConfig) *datastream.PostgresqlRdbms {
+	declared := map[string]bool{}
+	for t := range g.IncludeColumns {
+		declared[tableKey(t)] = true
+	}
+	for t := range g.ExcludeColumns {
+		declared[tableKey(t)] = true
+	}
+
+	if live.IncludeObjects != nil {
+		for _, s := range live.IncludeObjects.PostgresqlSchemas {
+			for _, t := range s.PostgresqlTables {
+				if len(t.PostgresqlColumns) == 0 || declared[s.Schema+"."+t.Table] {
+					continue
+				}
+				if dt := findTable(desired.IncludeObjects, s.Schema, t.Table); dt != nil && len(dt.PostgresqlColumns) == 0 {
+					g.log.Infof("Keeping the column selection of %v.%v", s.Schema, t.Table)
+					dt.PostgresqlColumns = t.PostgresqlColumns
+				}
+			}
+		}
+	}
+
+	excluded := desired.ExcludeObjects
+	if live.ExcludeObjects != nil {
+		for _, s := range live.ExcludeObjects.PostgresqlSchemas {
+			for _, t := range s.PostgresqlTables {
+				if len(t.PostgresqlColumns) == 0 || declared[s.Schema+"."+t.Table] || findTable(excluded, s.Schema, t.Table) != nil {
+					continue
+				}
+				columns := []string{}
+				for _, c := range t.PostgresqlColumns {
+					columns = append(columns, c.Column)
+				}
+				kept, err := excludeColumns(excluded, map[string][]string{s.Schema + "." + t.Table: columns})
+				if err != nil {
+					// the table or schema is excluded as a whole now, so the columns don't matter
+					continue
+				}
+				g.log.Infof("Keeping the excluded columns of %v.%v", s.Schema, t.Table)
+				excluded = kept
+			}
+		}
+	}
+
+	return excluded
+}
+
+// normalizedObjects returns a representation of the objects that does not
+// depend on the order of schemas, tables and columns.
+func normalizedObjects(objects *datastream.PostgresqlRdbms) (string, error) {
+	if objects == nil || len(objects.PostgresqlSchemas) == 0 {
+		return "", nil
+	}
+
+	type table struct {
+		Name    string   `json:"name"`
+		Columns []string `json:"columns"`
+	}
+	normalized := map[string][]table{}
+	for _, s := range objects.PostgresqlSchemas {
+		tables := normalized[s.Schema]
+		for _, t := range s.PostgresqlTables {
+			columns := []string{}
+			for _, c := range t.PostgresqlColumns {
+				columns = append(columns, c.Column)
+			}
+			sort.Strings(columns)
+			tables = append(tables, table{Name: t.Table, Columns: columns})
+		}
+		sort.Slice(tables, func(i, j int) bool { return tables[i].Name < tables[j].Name })
+		normalized[s.Schema] = tables
+	}
+
+	// maps are marshalled with sorted keys
+	bytes, err := json.Marshal(normalized)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+}
+
+// addedTables returns the tables, as schema.table, that are streamed with
+// desired but not with live. Only tables listed explicitly are considered.
+func addedTables(live, desired *datastream.PostgresqlSourceConfig) []string {
+	liveIncluded := objectTables(live.IncludeObjects)
+	desiredIncluded := objectTables(desired.IncludeObjects)
+	desiredExcluded := objectTables(desired.ExcludeObjects)
+
+	added := []string{}
+	if len(liveIncluded) > 0 {
+		for _, t := range desiredIncluded {
+			if !contains(liveIncluded, t) {
+				added = append(added, t)
+			}
+		}
+	}
+	for _, t := range objectTables(live.ExcludeObjects) {
+		if contains(desiredExcluded, t) {
+			continue
+		}
+		if len(desiredIncluded) > 0 && !contains(desiredIncluded, t) {
+			continue
+		}
+		if !contains(added, t) {
+			added = append(added, t)
+		}
+	}
+
+	sort.Strings(added)
+	return added
+}
+
+// objectTables returns the tables of objects as schema.table.
+func objectTables(objects *datastream.PostgresqlRdbms) []string {
+	tables := []string{}
+	if objects == nil {
+		return tables
+	}
+
+	for _, s := range objects.PostgresqlSchemas {
+		for _, t := range s.PostgresqlTables {
+			tables = append(tables, s.Schema+"."+t.Table)
+		}
+	}
+	return tables
+}
@@ -0,0 +1,194 @@
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/navikt/nada-datastream/cmd"
+	"google.golang.org/api/datastream/v1"
+)
+
+// respondStream makes the project describe the stream of g as the stream
+// created from the config of g, changed by change.
+func respondStream(t *testing.T, g *Google, project *fakeProject, change func(*datastream.Stream)) {
+	t.Helper()
+
+	pgConfig, err := g.createPostgresStreamConfig(context.Background())
+	if err != nil {
+		t.Fatalf("createPostgresStreamConfig: %v", err)
+	}
+	stream := g.streamSpec(generateNameFunc[DATASTREAM](g), pgConfig, g.bigQueryStreamConfig())
+	change(stream)
+
+	bytes, err := json.Marshal(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	project.respond(string(bytes), "datastream", "streams", "describe")
+}
+
+func TestPlanStreamUpdateWriteMode(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		liveAppendOnly bool
+		appendOnly     bool
+		mode           string
+		wantErr        bool
+	}{
+		{name: "append-only stream in warn mode", liveAppendOnly: true, mode: cmd.WithoutPrimaryKeyWarn},
+		{name: "append-only stream without mode", liveAppendOnly: true},
+		{name: "append-only stream in append-only mode", liveAppendOnly: true, mode: cmd.WithoutPrimaryKeyAppendOnly},
+		{name: "append-only stream in exclude mode", liveAppendOnly: true, mode: cmd.WithoutPrimaryKeyExclude, wantErr: true},
+		{name: "merging stream made append-only", appendOnly: true, mode: cmd.WithoutPrimaryKeyAppendOnly, wantErr: true},
+		{name: "merging stream", mode: cmd.WithoutPrimaryKeyExclude},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g, project := newTestGoogle(t)
+			respondStream(t, g, project, func(s *datastream.Stream) {
+				if tc.liveAppendOnly {
+					s.DestinationConfig.BigqueryDestinationConfig.AppendOnly = &datastream.AppendOnly{}
+				}
+			})
+			g.AppendOnly = tc.appendOnly
+			g.TablesWithoutPrimaryKey = tc.mode
+
+			update, err := g.PlanStreamUpdate(context.Background())
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("PlanStreamUpdate succeeded, want the write mode change to be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PlanStreamUpdate: %v", err)
+			}
+			if len(update.Fields) > 0 {
+				t.Errorf("got fields %v to update, want the stream to be up to date", update.Fields)
+			}
+			if appendOnly := update.stream.DestinationConfig.BigqueryDestinationConfig.AppendOnly != nil; appendOnly != tc.liveAppendOnly {
+				t.Errorf("updated stream append-only %v, want %v", appendOnly, tc.liveAppendOnly)
+			}
+		})
+	}
+}
+
+func TestAddedTables(t *testing.T) {
+	for _, tc := range []struct {
+		name                           string
+		liveInclude, liveExclude       []string
+		desiredInclude, desiredExclude []string
+		want                           []string
+	}{
+		{name: "unchanged", liveInclude: []string{"users"}, desiredInclude: []string{"users"}},
+		{name: "table included", liveInclude: []string{"users"}, desiredInclude: []string{"users", "events", "audit.log"}, want: []string{"audit.log", "public.events"}},
+		{name: "table removed", liveInclude: []string{"users", "events"}, desiredInclude: []string{"users"}},
+		{name: "all tables streamed before", desiredInclude: []string{"users"}},
+		{name: "exclusion dropped", liveExclude: []string{"events", "secrets"}, desiredExclude: []string{"secrets"}, want: []string{"public.events"}},
+		{name: "exclusion kept", liveExclude: []string{"events"}, desiredExclude: []string{"events"}},
+		{name: "excluded table not included", liveExclude: []string{"events"}, desiredInclude: []string{"users"}},
+		{name: "excluded table included", liveInclude: []string{"users"}, liveExclude: []string{"events"}, desiredInclude: []string{"users", "events"}, want: []string{"public.events"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			live := &datastream.PostgresqlSourceConfig{IncludeObjects: postgresqlObjects(tc.liveInclude), ExcludeObjects: postgresqlObjects(tc.liveExclude)}
+			desired := &datastream.PostgresqlSourceConfig{IncludeObjects: postgresqlObjects(tc.desiredInclude), ExcludeObjects: postgresqlObjects(tc.desiredExclude)}
+
+			if got := addedTables(live, desired); strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("got added tables %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestKeepLiveColumns(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		// the selections are given as tables and columns by table
+		liveInclude, liveExclude       []string
+		liveIncludeColumns             map[string][]string
+		liveExcludeColumns             map[string][]string
+		desiredInclude, desiredExclude []string
+		includeColumns                 map[string][]string
+		excludeColumns                 map[string][]string
+		wantInclude, wantExclude       string
+	}{
+		{
+			name:               "included columns kept",
+			liveInclude:        []string{"users", "events"},
+			liveIncludeColumns: map[string][]string{"users": {"id", "name"}},
+			desiredInclude:     []string{"users", "events"},
+			wantInclude:        "public[users(id name) events]",
+			wantExclude:        "nil",
+		},
+		{
+			name:               "included columns dropped with *",
+			liveInclude:        []string{"users"},
+			liveIncludeColumns: map[string][]string{"users": {"id", "name"}},
+			desiredInclude:     []string{"users"},
+			includeColumns:     map[string][]string{"users": {"*"}},
+			wantInclude:        "public[users]",
+			wantExclude:        "nil",
+		},
+		{
+			name:               "included columns replaced",
+			liveInclude:        []string{"users"},
+			liveIncludeColumns: map[string][]string{"users": {"id", "name"}},
+			desiredInclude:     []string{"users"},
+			includeColumns:     map[string][]string{"public.users": {"id"}},
+			wantInclude:        "public[users(id)]",
+			wantExclude:        "nil",
+		},
+		{
+			name:               "excluded columns kept",
+			liveExcludeColumns: map[string][]string{"users": {"password"}},
+			desiredExclude:     []string{"events"},
+			wantInclude:        "nil",
+			wantExclude:        "public[events users(password)]",
+		},
+		{
+			name:               "table with excluded columns excluded",
+			liveExcludeColumns: map[string][]string{"users": {"password"}},
+			desiredExclude:     []string{"users"},
+			wantInclude:        "nil",
+			wantExclude:        "public[users]",
+		},
+		{
+			name:               "schema with excluded columns excluded",
+			liveExcludeColumns: map[string][]string{"audit.log": {"ip"}},
+			desiredExclude:     []string{"audit.*"},
+			wantInclude:        "nil",
+			wantExclude:        "audit[*]",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g, _ := newTestGoogle(t)
+			g.IncludeColumns = tc.includeColumns
+			g.ExcludeColumns = tc.excludeColumns
+			live := &datastream.PostgresqlSourceConfig{IncludeObjects: postgresqlObjects(tc.liveInclude)}
+			desired := &datastream.PostgresqlSourceConfig{IncludeObjects: postgresqlObjects(tc.desiredInclude)}
+			var err error
+			if err = includeColumns(live.IncludeObjects, tc.liveIncludeColumns); err != nil {
+				t.Fatal(err)
+			}
+			if live.ExcludeObjects, err = excludeColumns(postgresqlObjects(tc.liveExclude), tc.liveExcludeColumns); err != nil {
+				t.Fatal(err)
+			}
+			if err = includeColumns(desired.IncludeObjects, tc.includeColumns); err != nil {
+				t.Fatal(err)
+			}
+			if desired.ExcludeObjects, err = excludeColumns(postgresqlObjects(tc.desiredExclude), tc.excludeColumns); err != nil {
+				t.Fatal(err)
+			}
+
+			excluded := g.keepLiveColumns(live, desired)
+
+			if got := objectsString(desired.IncludeObjects); got != tc.wantInclude {
+				t.Errorf("got included %v, want %v", got, tc.wantInclude)
+			}
+			if got := objectsString(excluded); got != tc.wantExclude {
+				t.Errorf("got excluded %v, want %v", got, tc.wantExclude)
+			}
+		})
+	}
+}
@@ -10,38 +10,18 @@ const (
 )
 
 func (g Google) vpcExists(ctx context.Context, vpc string) (bool, error) {
-	type vpcType struct {
-		Name string `json:"name"`
-	}
-	vpcs := []*vpcType{}
-
-	err := g.performRequest(ctx, []string{
-		"compute",
-		"networks",
-		"list",
-	}, &vpcs)
+	vpcs, err := g.backend.Networks(ctx)
 	if err != nil {
 		g.log.WithError(err).Errorf("listing VPCs in project %v", g.Project)
 		return false, err
 	}
 
-	for _, existing := range vpcs {
-		if existing.Name == vpc {
-			return true, nil
-		}
-	}
-
-	return false, nil
+	return contains(vpcs, vpc), nil
 }
 
 func (g Google) createVPC(ctx context.Context, vpc string) error {
 	g.log.Info("Creating VPC...")
-	err := g.performRequest(ctx, []string{
-		"compute",
-		"networks",
-		"create",
-		vpc,
-	}, nil)
+	err := g.backend.CreateNetwork(ctx, vpc)
 	if err != nil {
 		g.log.WithError(err).Errorf("creating vpc %v", vpc)
 		return err
@@ -62,11 +42,5 @@ func contains(vals []string, val string) bool {
 
 func (g Google) deleteVPC(ctx context.Context, vpc string) error {
 	g.log.Info("Deleting VPC...")
-	return g.performRequest(ctx, []string{
-		"compute",
-		"networks",
-		"delete",
-		vpc,
-		"--quiet",
-	}, nil)
+	return g.backend.DeleteNetwork(ctx, vpc)
 }
@@ -0,0 +1,233 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/navikt/nada-datastream/cmd"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// application is the part of a nais Application describing its databases.
+type application struct {
+	Spec struct {
+		GCP struct {
+			SQLInstances []struct {
+				// Name defaults to the name of the app.
+				Name      string `json:"name"`
+				Databases []struct {
+					Name  string `json:"name"`
+					Users []struct {
+						Name string `json:"name"`
+					} `json:"users"`
+				} `json:"databases"`
+			} `json:"sqlInstances"`
+		} `json:"gcp"`
+	} `json:"spec"`
+}
+
+// sqlUser is the part of a Config Connector SQLUser needed to find the
+// database user and its secret.
+type sqlUser struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Spec struct {
+		// ResourceID is the name of the user in the database, defaulting to the name of the SQLUser.
+		ResourceID  string `json:"resourceID"`
+		InstanceRef struct {
+			Name string `json:"name"`
+		} `json:"instanceRef"`
+		Password struct {
+			ValueFrom struct {
+				SecretKeyRef struct {
+					Key  string `json:"key"`
+					Name string `json:"name"`
+				} `json:"secretKeyRef"`
+			} `json:"valueFrom"`
+		} `json:"password"`
+	} `json:"spec"`
+}
+
+func (u sqlUser) userName() string {
+	if u.Spec.ResourceID != "" {
+		return u.Spec.ResourceID
+	}
+	return u.Metadata.Name
+}
+
+// applicationDBConfig sets the instance, database and credentials of dbUser
+// from the databases in the nais Application of the app. It returns false
+// when the app has no Application, or it can't be read, so that the database
+// has to be found by the labels of the app instead.
+func (c *Client) applicationDBConfig(ctx context.Context, appName, dbUser string, sel Selection, dbConf *cmd.DBConfig) (bool, error) {
+	obj, err := c.dynamicClient.Resource(schema.GroupVersionResource{
+		Group:    "nais.io",
+		Version:  "v1alpha1",
+		Resource: "applications",
+	}).Namespace(c.namespace).Get(ctx, appName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) || apierrors.IsForbidden(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	app := application{}
+	if err := fromUnstructured(obj.Object, &app); err != nil {
+		return false, err
+	}
+	instances := app.Spec.GCP.SQLInstances
+	if len(instances) == 0 {
+		return false, fmt.Errorf("application %v in %v has no sqlInstances", appName, c.namespace)
+	}
+
+	names := []string{}
+	for i := range instances {
+		if instances[i].Name == "" {
+			instances[i].Name = appName
+		}
+		names = append(names, instances[i].Name)
+	}
+	name, err := sel.pick(CandidateInstance, sel.Instance, names)
+	if err != nil {
+		return false, fmt.Errorf("application %v: %w", appName, err)
+	}
+	instance := instances[0]
+	for _, i := range instances {
+		if i.Name == name {
+			instance = i
+		}
+	}
+
+	names = []string{}
+	for _, d := range instance.Databases {
+		names = append(names, d.Name)
+	}
+	name, err = sel.pick(CandidateDatabase, sel.Database, names)
+	if err != nil {
+		return false, fmt.Errorf("application %v, sqlinstance %v: %w", appName, instance.Name, err)
+	}
+	database := instance.Databases[0]
+	for _, d := range instance.Databases {
+		if d.Name == name {
+			database = d
+		}
+	}
+
+	// the app's own user is always created, the others are listed
+	users := []string{appName}
+	for _, u := range database.Users {
+		users = append(users, u.Name)
+	}
+	if !contains(users, dbUser) {
+		return false, fmt.Errorf("user %v is not a user of database %v in application %v, should be one of %v", dbUser, database.Name, appName, strings.Join(users, ", "))
+	}
+
+	if err := c.setInstanceByName(ctx, instance.Name, dbConf); err != nil {
+		return false, err
+	}
+
+	user, err := c.findSQLUser(ctx, appName, instance.Name, dbUser)
+	if err != nil {
+		return false, err
+	}
+	if user == nil {
+		return false, fmt.Errorf("no sqluser found for user %v on sqlinstance %v of application %v, the users of database %v are %v\ncheck that the application is deployed with the user",
+			dbUser, instance.Name, appName, database.Name, strings.Join(users, ", "))
+	}
+	dbConf.DB = database.Name
+	dbConf.User = dbUser
+
+	secretRef := user.Spec.Password.ValueFrom.SecretKeyRef
+	secret, err := c.clientSet.CoreV1().Secrets(c.namespace).Get(ctx, secretRef.Name, metav1.GetOptions{})
+	if err != nil {
+		return false, fmt.Errorf("getting secret %v of user %v: %w", secretRef.Name, dbUser, err)
+	}
+	if _, ok := secret.Data[secretRef.Key]; !ok {
+		return false, fmt.Errorf("secret %v has no key %v", secretRef.Name, secretRef.Key)
+	}
+	// the keys of the secret share the prefix of the password key, which
+	// is envVarPrefix when the app sets it
+	setCredentials(secret.Data, strings.TrimSuffix(secretRef.Key, "PASSWORD"), dbConf)
+
+	return true, nil
+}
+
+// setInstanceByName sets the project, region and name of the SQLInstance.
+func (c *Client) setInstanceByName(ctx context.Context, instance string, dbConf *cmd.DBConfig) error {
+	sqlInstance, err := c.dynamicClient.Resource(schema.GroupVersionResource{
+		Group:    "sql.cnrm.cloud.google.com",
+		Version:  "v1beta1",
+		Resource: "sqlinstances",
+	}).Namespace(c.namespace).Get(ctx, instance, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("getting sqlinstance %v: %w", instance, err)
+	}
+
+	return setConnectionName(sqlInstance.Object, sqlInstance.GetName(), dbConf)
+}
+
+// setCredentials sets the user and password from the keys of a database
+// secret that start with prefix.
+func setCredentials(data map[string][]byte, prefix string, dbConf *cmd.DBConfig) {
+	for k, v := range data {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		switch {
+		case strings.HasSuffix(k, "USERNAME"):
+			dbConf.User = string(v)
+		case strings.HasSuffix(k, "PASSWORD"):
+			dbConf.Password = string(v)
+		}
+	}
+}
+
+// findSQLUser returns the SQLUser of the app for the database user on the
+// instance, or nil when there is none.
+func (c *Client) findSQLUser(ctx context.Context, appName, instance, dbUser string) (*sqlUser, error) {
+	sqlUsers, err := c.dynamicClient.Resource(schema.GroupVersionResource{
+		Group:    "sql.cnrm.cloud.google.com",
+		Version:  "v1beta1",
+		Resource: "sqlusers",
+	}).Namespace(c.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "app=" + appName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing sqlusers of app %v: %w", appName, err)
+	}
+
+	for _, item := range sqlUsers.Items {
+		user := sqlUser{}
+		if err := fromUnstructured(item.Object, &user); err != nil {
+			return nil, err
+		}
+		if user.Spec.InstanceRef.Name == instance && user.userName() == dbUser {
+			return &user, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func fromUnstructured(obj map[string]interface{}, out interface{}) error {
+	bytes, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bytes, out)
+}
+
+func contains(vals []string, val string) bool {
+	for _, v := range vals {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
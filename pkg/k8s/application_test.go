@@ -0,0 +1,256 @@
+package k8s
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/navikt/nada-datastream/cmd"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testNamespace = "team"
+
+var (
+	applicationsResource = schema.GroupVersionResource{Group: "nais.io", Version: "v1alpha1", Resource: "applications"}
+	sqlInstancesResource = schema.GroupVersionResource{Group: "sql.cnrm.cloud.google.com", Version: "v1beta1", Resource: "sqlinstances"}
+	sqlUsersResource     = schema.GroupVersionResource{Group: "sql.cnrm.cloud.google.com", Version: "v1beta1", Resource: "sqlusers"}
+)
+
+func object(apiVersion, kind, name string, labels map[string]any, fields map[string]any) *unstructured.Unstructured {
+	metadata := map[string]any{"name": name, "namespace": testNamespace}
+	if labels != nil {
+		metadata["labels"] = labels
+	}
+	obj := map[string]any{"apiVersion": apiVersion, "kind": kind, "metadata": metadata}
+	for k, v := range fields {
+		obj[k] = v
+	}
+	return &unstructured.Unstructured{Object: obj}
+}
+
+// testApplication returns a nais Application with the databases of each
+// sqlinstance, given as database name to its extra users.
+func testApplication(name string, instances map[string]map[string][]string) *unstructured.Unstructured {
+	sqlInstances := []any{}
+	for instance, databases := range instances {
+		dbs := []any{}
+		for db, users := range databases {
+			us := []any{}
+			for _, u := range users {
+				us = append(us, map[string]any{"name": u})
+			}
+			dbs = append(dbs, map[string]any{"name": db, "users": us})
+		}
+		sqlInstances = append(sqlInstances, map[string]any{"name": instance, "databases": dbs})
+	}
+	return object("nais.io/v1alpha1", "Application", name, nil, map[string]any{
+		"spec": map[string]any{"gcp": map[string]any{"sqlInstances": sqlInstances}},
+	})
+}
+
+func testSQLInstance(name string) *unstructured.Unstructured {
+	return object("sql.cnrm.cloud.google.com/v1beta1", "SQLInstance", name, map[string]any{"app": "myapp"}, map[string]any{
+		"status": map[string]any{"connectionName": "test-project:europe-north1:" + name},
+	})
+}
+
+// testSQLUser returns the SQLUser of user on instance, with its password in
+// the secret key NAIS_DATABASE_<prefix>_PASSWORD of secret.
+func testSQLUser(instance, user, secret, prefix string) *unstructured.Unstructured {
+	return object("sql.cnrm.cloud.google.com/v1beta1", "SQLUser", instance+"-"+user, map[string]any{"app": "myapp"}, map[string]any{
+		"spec": map[string]any{
+			"resourceID":  user,
+			"instanceRef": map[string]any{"name": instance},
+			"password": map[string]any{"valueFrom": map[string]any{"secretKeyRef": map[string]any{
+				"name": secret,
+				"key":  "NAIS_DATABASE_" + prefix + "_PASSWORD",
+			}}},
+		},
+	})
+}
+
+func testSecret(name, prefix, user, password string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Data: map[string][]byte{
+			"NAIS_DATABASE_" + prefix + "_USERNAME": []byte(user),
+			"NAIS_DATABASE_" + prefix + "_PASSWORD": []byte(password),
+		},
+	}
+}
+
+func newTestClient(objects []runtime.Object, secrets ...runtime.Object) (*Client, *dynamicfake.FakeDynamicClient) {
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		applicationsResource: "ApplicationList",
+		sqlInstancesResource: "SQLInstanceList",
+		sqlUsersResource:     "SQLUserList",
+	}, objects...)
+
+	return &Client{
+		clientSet:     fake.NewSimpleClientset(secrets...),
+		dynamicClient: dynamicClient,
+		namespace:     testNamespace,
+	}, dynamicClient
+}
+
+func TestApplicationDBConfig(t *testing.T) {
+	instances := map[string]map[string][]string{
+		"myapp-db": {"mydb": {"datastream"}},
+	}
+	objects := []runtime.Object{
+		testApplication("myapp", instances),
+		testSQLInstance("myapp-db"),
+		testSQLUser("myapp-db", "datastream", "google-sql-myapp-mydb-datastream", "MYAPP_MYDB_DATASTREAM"),
+	}
+	secret := testSecret("google-sql-myapp-mydb-datastream", "MYAPP_MYDB_DATASTREAM", "datastream", "secret")
+
+	for _, tc := range []struct {
+		name    string
+		user    string
+		objects []runtime.Object
+		found   bool
+		want    cmd.DBConfig
+		wantErr []string
+	}{
+		{
+			name:    "listed user",
+			user:    "datastream",
+			objects: objects,
+			found:   true,
+			want:    cmd.DBConfig{Project: "test-project", Region: "europe-north1", Instance: "myapp-db", DB: "mydb", User: "datastream", Password: "secret"},
+		},
+		{
+			name:    "user not in the application",
+			user:    "someone",
+			objects: objects,
+			wantErr: []string{"someone", "myapp, datastream"},
+		},
+		{
+			name:    "listed user without sqluser",
+			user:    "datastream",
+			objects: objects[:2],
+			wantErr: []string{"no sqluser", "datastream", "myapp-db", "myapp, datastream"},
+		},
+		{
+			name:    "application without sqlinstances",
+			user:    "datastream",
+			objects: []runtime.Object{testApplication("myapp", nil)},
+			wantErr: []string{"no sqlInstances"},
+		},
+		{
+			name: "no application",
+			user: "datastream",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client, _ := newTestClient(tc.objects, secret)
+			dbConf := cmd.DBConfig{}
+
+			found, err := client.applicationDBConfig(context.Background(), "myapp", tc.user, Selection{}, &dbConf)
+			if len(tc.wantErr) > 0 {
+				if err == nil {
+					t.Fatalf("applicationDBConfig succeeded with %+v, want an error", dbConf)
+				}
+				for _, s := range tc.wantErr {
+					if !strings.Contains(err.Error(), s) {
+						t.Errorf("error does not mention %q: %v", s, err)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applicationDBConfig: %v", err)
+			}
+			if found != tc.found {
+				t.Fatalf("got found %v, want %v", found, tc.found)
+			}
+			if dbConf != tc.want {
+				t.Errorf("got config %+v, want %+v", dbConf, tc.want)
+			}
+		})
+	}
+}
+
+func TestApplicationDBConfigForbidden(t *testing.T) {
+	client, dynamicClient := newTestClient([]runtime.Object{testApplication("myapp", map[string]map[string][]string{"myapp-db": {"mydb": nil}})})
+	dynamicClient.PrependReactor("get", "applications", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(applicationsResource.GroupResource(), "myapp", nil)
+	})
+
+	found, err := client.applicationDBConfig(context.Background(), "myapp", "myapp", Selection{}, &cmd.DBConfig{})
+	if err != nil || found {
+		t.Errorf("got found %v and error %v, want the application to be skipped", found, err)
+	}
+}
+
+func TestApplicationDBConfigSelection(t *testing.T) {
+	instances := map[string]map[string][]string{
+		"myapp-db":    {"mydb": nil, "otherdb": nil},
+		"myapp-extra": {"extradb": nil},
+	}
+	objects := []runtime.Object{
+		testApplication("myapp", instances),
+		testSQLInstance("myapp-db"),
+		testSQLInstance("myapp-extra"),
+		testSQLUser("myapp-db", "myapp", "google-sql-myapp", "MYAPP"),
+		testSQLUser("myapp-extra", "myapp", "google-sql-myapp-extra", "MYAPP_EXTRA"),
+	}
+	secrets := []runtime.Object{
+		testSecret("google-sql-myapp", "MYAPP", "myapp", "secret"),
+		testSecret("google-sql-myapp-extra", "MYAPP_EXTRA", "myapp", "extra"),
+	}
+
+	for _, tc := range []struct {
+		name string
+		sel  Selection
+		// chosen are the answers to Choose, by what is chosen
+		chosen   map[string]string
+		instance string
+		db       string
+		password string
+		wantErr  string
+	}{
+		{name: "given", sel: Selection{Instance: "myapp-db", Database: "otherdb"}, instance: "myapp-db", db: "otherdb", password: "secret"},
+		{name: "only database of given instance", sel: Selection{Instance: "myapp-extra"}, instance: "myapp-extra", db: "extradb", password: "extra"},
+		{name: "chosen", chosen: map[string]string{CandidateInstance: "myapp-db", CandidateDatabase: "mydb"}, instance: "myapp-db", db: "mydb", password: "secret"},
+		{name: "unknown instance", sel: Selection{Instance: "myapp"}, wantErr: "myapp-db, myapp-extra"},
+		{name: "several without choice", sel: Selection{Instance: "myapp-db"}, wantErr: "found several databases: mydb, otherdb"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client, _ := newTestClient(objects, secrets...)
+			sel := tc.sel
+			if tc.chosen != nil {
+				sel.Choose = func(what string, candidates []string) (string, error) {
+					return tc.chosen[what], nil
+				}
+			}
+			dbConf := cmd.DBConfig{}
+
+			_, err := client.applicationDBConfig(context.Background(), "myapp", "myapp", sel, &dbConf)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("got error %v, want it to mention %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applicationDBConfig: %v", err)
+			}
+			if dbConf.Instance != tc.instance || dbConf.DB != tc.db {
+				t.Errorf("got sqlinstance %v and database %v, want %v and %v", dbConf.Instance, dbConf.DB, tc.instance, tc.db)
+			}
+			if dbConf.Password != tc.password {
+				t.Errorf("got password %q, want the one of the sqluser on %v", dbConf.Password, tc.instance)
+			}
+		})
+	}
+}
@@ -2,12 +2,10 @@ package k8s
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"strings"
 
 	"github.com/navikt/nada-datastream/cmd"
-	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
@@ -17,8 +15,8 @@ import (
 )
 
 type Client struct {
-	clientSet     *kubernetes.Clientset
-	dynamicClient *dynamic.DynamicClient
+	clientSet     kubernetes.Interface
+	dynamicClient dynamic.Interface
 	namespace     string
 }
 
@@ -54,36 +52,52 @@ func New(context, namespace string) (*Client, error) {
 	}, nil
 }
 
-func (c *Client) DBConfig(ctx context.Context, appName, dbUser string) (cmd.DBConfig, error) {
+// DBConfig returns the database config of dbUser. The sel selects the
+// sqlinstance and database when the app has several.
+func (c *Client) DBConfig(ctx context.Context, appName, dbUser string, sel Selection) (cmd.DBConfig, error) {
 	dbConf := cmd.DBConfig{
-		Port: "5432",
+		App:       appName,
+		Namespace: c.namespace,
+		Port:      "5432",
 	}
 
-	err := c.setDBInstanceInfo(ctx, appName, &dbConf)
+	found, err := c.applicationDBConfig(ctx, appName, dbUser, sel, &dbConf)
 	if err != nil {
 		return cmd.DBConfig{}, err
 	}
+	if found {
+		return dbConf, nil
+	}
 
-	dbSecret, err := c.getDBSecret(ctx, appName, dbUser)
+	// apps without a nais Application are found by their labels
+	instance, err := c.setDBInstanceInfo(ctx, appName, sel, &dbConf)
 	if err != nil {
 		return cmd.DBConfig{}, err
 	}
 
-	for k, v := range dbSecret.Data {
-		switch {
-		case strings.HasSuffix(k, "USERNAME"):
-			dbConf.User = string(v)
-		case strings.HasSuffix(k, "PASSWORD"):
-			dbConf.Password = string(v)
-		case strings.HasSuffix(k, "DATABASE"):
-			dbConf.DB = string(v)
-		}
+	credentials, err := c.findCredentials(ctx, appName, dbUser, instance)
+	if err != nil {
+		return cmd.DBConfig{}, err
+	}
+	databases := []string{}
+	for db := range credentials {
+		databases = append(databases, db)
+	}
+	db, err := sel.pick(CandidateDatabase, sel.Database, databases)
+	if err != nil {
+		return cmd.DBConfig{}, fmt.Errorf("user %v on sqlinstance %v: %w", dbUser, instance, err)
 	}
 
+	dbConf.DB = db
+	dbConf.User = credentials[db].user
+	dbConf.Password = credentials[db].password
+
 	return dbConf, nil
 }
 
-func (c *Client) setDBInstanceInfo(ctx context.Context, appName string, dbConf *cmd.DBConfig) error {
+// setDBInstanceInfo sets the project, region and name of the sqlinstance of
+// the app, and returns the name of the sqlinstance resource.
+func (c *Client) setDBInstanceInfo(ctx context.Context, appName string, sel Selection, dbConf *cmd.DBConfig) (string, error) {
 	sqlInstances, err := c.dynamicClient.Resource(schema.GroupVersionResource{
 		Group:    "sql.cnrm.cloud.google.com",
 		Version:  "v1beta1",
@@ -92,20 +106,37 @@ func (c *Client) setDBInstanceInfo(ctx context.Context, appName string, dbConf *
 		LabelSelector: "app=" + appName,
 	})
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	if len(sqlInstances.Items) == 0 {
-		return fmt.Errorf("findDBInstance: no sqlinstance found for app %q in %q", appName, c.namespace)
-	} else if len(sqlInstances.Items) > 1 {
-		return fmt.Errorf("findDBInstance: multiple sqlinstances found for app %q in %q", appName, c.namespace)
+		return "", fmt.Errorf("findDBInstance: no sqlinstance found for app %q in %q", appName, c.namespace)
+	}
+
+	names := []string{}
+	for _, i := range sqlInstances.Items {
+		names = append(names, i.GetName())
+	}
+	name, err := sel.pick(CandidateInstance, sel.Instance, names)
+	if err != nil {
+		return "", fmt.Errorf("findDBInstance: app %q in %q: %w", appName, c.namespace, err)
 	}
 
-	sqlInstance := sqlInstances.Items[0]
+	for _, i := range sqlInstances.Items {
+		if i.GetName() == name {
+			return name, setConnectionName(i.Object, name, dbConf)
+		}
+	}
+	return "", fmt.Errorf("findDBInstance: no sqlinstance %v found for app %q in %q", name, appName, c.namespace)
+}
 
-	connectionName, ok := sqlInstance.Object["status"].(map[string]interface{})["connectionName"]
+// setConnectionName sets the project, region and instance from the connection
+// name in the status of a SQLInstance.
+func setConnectionName(sqlInstance map[string]interface{}, name string, dbConf *cmd.DBConfig) error {
+	status, _ := sqlInstance["status"].(map[string]interface{})
+	connectionName, ok := status["connectionName"]
 	if !ok {
-		return fmt.Errorf("missing 'connectionName' status field; run 'kubectl describe sqlinstance %s' and check for status failures", sqlInstance.GetName())
+		return fmt.Errorf("missing 'connectionName' status field; run 'kubectl describe sqlinstance %s' and check for status failures", name)
 	}
 
 	parts := strings.Split(connectionName.(string), ":")
@@ -120,7 +151,15 @@ func (c *Client) setDBInstanceInfo(ctx context.Context, appName string, dbConf *
 	return nil
 }
 
-func (c *Client) getDBSecret(ctx context.Context, appName, dbUser string) (*v1.Secret, error) {
+type dbCredentials struct {
+	user     string
+	password string
+}
+
+// findCredentials returns the credentials of dbUser on the sqlinstance, by
+// database. The secrets are found by looking for the name of the user in the
+// keys the SQLUsers of the app refer to.
+func (c *Client) findCredentials(ctx context.Context, appName, dbUser, instance string) (map[string]dbCredentials, error) {
 	sqlUsers, err := c.dynamicClient.Resource(schema.GroupVersionResource{
 		Group:    "sql.cnrm.cloud.google.com",
 		Version:  "v1beta1",
@@ -132,36 +171,39 @@ func (c *Client) getDBSecret(ctx context.Context, appName, dbUser string) (*v1.S
 		return nil, fmt.Errorf("unable to find secrets for app %v", appName)
 	}
 
-	type object struct {
-		Spec struct {
-			Password struct {
-				ValueFrom struct {
-					SecretKeyRef struct {
-						Key  string `json:"key"`
-						Name string `json:"name"`
-					} `json:"secretKeyRef"`
-				} `json:"valueFrom"`
-			} `json:"password"`
-		} `json:"spec"`
-	}
-
+	credentials := map[string]dbCredentials{}
 	for _, u := range sqlUsers.Items {
-		obj := object{}
-		dataBytes, err := u.MarshalJSON()
-		if err != nil {
+		obj := sqlUser{}
+		if err := fromUnstructured(u.Object, &obj); err != nil {
 			return nil, err
 		}
 
-		if err := json.Unmarshal(dataBytes, &obj); err != nil {
-			return nil, err
+		secretRef := obj.Spec.Password.ValueFrom.SecretKeyRef
+		if obj.Spec.InstanceRef.Name != "" && obj.Spec.InstanceRef.Name != instance {
+			continue
+		}
+		if !strings.Contains(secretRef.Key, strings.ToUpper("_"+strings.ReplaceAll(dbUser, "-", "_"))+"_") {
+			continue
 		}
 
-		if strings.Contains(obj.Spec.Password.ValueFrom.SecretKeyRef.Key, strings.ToUpper("_"+strings.ReplaceAll(dbUser, "-", "_"))+"_") {
-			return c.clientSet.CoreV1().Secrets(c.namespace).Get(ctx, obj.Spec.Password.ValueFrom.SecretKeyRef.Name, metav1.GetOptions{})
+		secret, err := c.clientSet.CoreV1().Secrets(c.namespace).Get(ctx, secretRef.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range secret.Data {
+			if prefix, found := strings.CutSuffix(k, "DATABASE"); found {
+				credentials[string(v)] = dbCredentials{
+					user:     string(secret.Data[prefix+"USERNAME"]),
+					password: string(secret.Data[prefix+"PASSWORD"]),
+				}
+			}
 		}
 	}
 
-	return nil, fmt.Errorf("unable to find db secret for user %v", dbUser)
+	if len(credentials) == 0 {
+		return nil, fmt.Errorf("unable to find db secret for user %v", dbUser)
+	}
+	return credentials, nil
 }
 
 func getKubeConfig(context, namespace string) (clientcmd.ClientConfig, error) {
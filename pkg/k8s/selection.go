@@ -0,0 +1,44 @@
+package k8s
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// What is chosen when an app has several candidates.
+const (
+	CandidateInstance = "sqlinstance"
+	CandidateDatabase = "database"
+)
+
+// Selection selects the sqlinstance and database when an app has several.
+type Selection struct {
+	Instance string
+	Database string
+	// Choose picks one of the candidates when the app has several and the
+	// selection doesn't say which, e.g. by asking the user.
+	Choose func(what string, candidates []string) (string, error)
+}
+
+// pick returns the candidate given, or the only candidate, or asks Choose.
+func (s Selection) pick(what, given string, candidates []string) (string, error) {
+	sort.Strings(candidates)
+	if given != "" {
+		if !contains(candidates, given) {
+			return "", fmt.Errorf("%v %v not found, should be one of %v", what, given, strings.Join(candidates, ", "))
+		}
+		return given, nil
+	}
+
+	switch {
+	case len(candidates) == 0:
+		return "", fmt.Errorf("no %v found", what)
+	case len(candidates) == 1:
+		return candidates[0], nil
+	case s.Choose == nil:
+		return "", fmt.Errorf("found several %vs: %v", what, strings.Join(candidates, ", "))
+	default:
+		return s.Choose(what, candidates)
+	}
+}
@@ -0,0 +1,53 @@
+package k8s
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPick(t *testing.T) {
+	chooseLast := func(what string, candidates []string) (string, error) {
+		return candidates[len(candidates)-1], nil
+	}
+	failChoosing := func(what string, candidates []string) (string, error) {
+		return "", errors.New("no terminal")
+	}
+
+	for _, tc := range []struct {
+		name       string
+		given      string
+		candidates []string
+		choose     func(string, []string) (string, error)
+		want       string
+		// err is part of the error, if picking fails
+		err string
+	}{
+		{name: "given", given: "b", candidates: []string{"a", "b"}, want: "b"},
+		{name: "given not found", given: "c", candidates: []string{"b", "a"}, err: "sqlinstance c not found, should be one of a, b"},
+		{name: "only candidate", candidates: []string{"a"}, want: "a"},
+		{name: "no candidates", err: "no sqlinstance found"},
+		{name: "several without choosing", candidates: []string{"b", "a"}, err: "found several sqlinstances: a, b"},
+		{name: "several chosen", candidates: []string{"b", "c", "a"}, choose: chooseLast, want: "c"},
+		{name: "choosing fails", candidates: []string{"a", "b"}, choose: failChoosing, err: "no terminal"},
+		{name: "given is not chosen", given: "a", candidates: []string{"a", "b"}, choose: chooseLast, want: "a"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sel := Selection{Choose: tc.choose}
+
+			got, err := sel.pick(CandidateInstance, tc.given, tc.candidates)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("got %q and error %v, want error %q", got, err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("pick: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
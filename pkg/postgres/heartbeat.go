@@ -0,0 +1,88 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// heartbeatSchema is the schema of the heartbeat tables.
+const heartbeatSchema = "public"
+
+// HeartbeatTable returns the name of the table that is updated to keep the
+// replication slot advancing when the tables streamed change rarely.
+func HeartbeatTable(slot string) string {
+	return slot + "_heartbeat"
+}
+
+// HeartbeatTableName returns the heartbeat table of the slot as schema.table.
+func HeartbeatTableName(slot string) string {
+	return heartbeatSchema + "." + HeartbeatTable(slot)
+}
+
+// CreateHeartbeat creates the heartbeat table of the slot, lets user update
+// it, and adds it to the publication unless the publication is for all tables.
+func (c *Client) CreateHeartbeat(ctx context.Context, slot, publication, user string) error {
+	table := quoteTable(Table{Schema: heartbeatSchema, Name: HeartbeatTable(slot)})
+	statements := []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v (id integer PRIMARY KEY, beat timestamptz NOT NULL)", table),
+		fmt.Sprintf("INSERT INTO %v (id, beat) VALUES (1, now()) ON CONFLICT (id) DO NOTHING", table),
+		fmt.Sprintf("GRANT SELECT, INSERT, UPDATE ON %v TO %v", table, quote(user)),
+	}
+	for _, s := range statements {
+		if _, err := c.conn.Exec(ctx, s); err != nil {
+			return fmt.Errorf("creating heartbeat table %v: %w", HeartbeatTableName(slot), err)
+		}
+	}
+
+	var allTables bool
+	err := c.conn.QueryRow(ctx, "SELECT puballtables FROM pg_publication WHERE pubname = $1", publication).Scan(&allTables)
+	if errors.Is(err, pgx.ErrNoRows) || allTables {
+		// a missing publication is reported by the preflight checks, which
+		// are run before the heartbeat table is created
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("checking publication %v: %w", publication, err)
+	}
+
+	published, err := c.PublicationTables(ctx, publication)
+	if err != nil {
+		return err
+	}
+	if contains(published, HeartbeatTableName(slot)) {
+		return nil
+	}
+	if _, err := c.conn.Exec(ctx, fmt.Sprintf("ALTER PUBLICATION %v ADD TABLE %v", quote(publication), table)); err != nil {
+		return fmt.Errorf("adding heartbeat table %v to publication %v: %w", HeartbeatTableName(slot), publication, err)
+	}
+	return nil
+}
+
+// Beat updates the heartbeat table of the slot, which writes to the WAL.
+func (c *Client) Beat(ctx context.Context, slot string) error {
+	table := quoteTable(Table{Schema: heartbeatSchema, Name: HeartbeatTable(slot)})
+	_, err := c.conn.Exec(ctx, fmt.Sprintf("INSERT INTO %v (id, beat) VALUES (1, now()) ON CONFLICT (id) DO UPDATE SET beat = excluded.beat", table))
+	if err != nil {
+		return fmt.Errorf("updating heartbeat table %v: %w", HeartbeatTableName(slot), err)
+	}
+	return nil
+}
+
+// DropHeartbeat drops the heartbeat table of the slot, which removes it from
+// publications too, and reports whether it existed.
+func (c *Client) DropHeartbeat(ctx context.Context, slot string) (bool, error) {
+	var exists bool
+	err := c.conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_tables WHERE schemaname = $1 AND tablename = $2)", heartbeatSchema, HeartbeatTable(slot)).Scan(&exists)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	table := quoteTable(Table{Schema: heartbeatSchema, Name: HeartbeatTable(slot)})
+	if _, err := c.conn.Exec(ctx, "DROP TABLE IF EXISTS "+table); err != nil {
+		return false, fmt.Errorf("dropping heartbeat table %v: %w", HeartbeatTableName(slot), err)
+	}
+	return true, nil
+}
@@ -0,0 +1,124 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/navikt/nada-datastream/cmd"
+)
+
+// Client runs queries against the database of an app, either through a local
+// proxy such as cloud-sql-proxy or directly against the host of the instance.
+type Client struct {
+	conn *pgx.Conn
+}
+
+// Table is a table in the database, with its columns in order.
+type Table struct {
+	Schema string
+	Name   string
+	// Selectable is whether the user is allowed to read the table.
+	Selectable bool
+	Columns    []Column
+	PrimaryKey []string
+}
+
+// FullName returns the name of the table as schema.table.
+func (t Table) FullName() string {
+	return t.Schema + "." + t.Name
+}
+
+type Column struct {
+	Name       string
+	DataType   string
+	Nullable   bool
+	PrimaryKey bool
+}
+
+func New(ctx context.Context, cfg *cmd.DBConfig) (*Client, error) {
+	conn, err := pgx.Connect(ctx, connectionString(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("connecting to database %v on %v:%v, is the database reachable (e.g. through cloud-sql-proxy or nais postgres proxy)? %w", cfg.DB, cfg.Host, cfg.Port, err)
+	}
+
+	return &Client{conn: conn}, nil
+}
+
+// IsPermanent reports whether err is an error from the database that retrying
+// won't fix: a missing table, missing privileges or failed authentication.
+func IsPermanent(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	switch pgErr.Code {
+	case "42P01", "42501": // undefined_table, insufficient_privilege
+		return true
+	}
+	// class 28 is invalid authorization specification
+	return strings.HasPrefix(pgErr.Code, "28")
+}
+
+func connectionString(cfg *cmd.DBConfig) string {
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.User, cfg.Password),
+		Host:     net.JoinHostPort(cfg.Host, cfg.Port),
+		Path:     cfg.DB,
+		RawQuery: "sslmode=prefer",
+	}
+	return u.String()
+}
+
+func (c *Client) Close(ctx context.Context) error {
+	return c.conn.Close(ctx)
+}
+
+// Tables returns the tables outside of the system schemas, including the ones
+// the user is not allowed to read.
+func (c *Client) Tables(ctx context.Context) ([]Table, error) {
+	rows, err := c.conn.Query(ctx, `
+SELECT n.nspname, c.relname, has_table_privilege(c.oid, 'SELECT'),
+       a.attname, format_type(a.atttypid, a.atttypmod), NOT a.attnotnull,
+       COALESCE(a.attnum = ANY(i.indkey), false)
+FROM pg_class c
+JOIN pg_namespace n ON n.oid = c.relnamespace
+JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped
+LEFT JOIN pg_index i ON i.indrelid = c.oid AND i.indisprimary
+WHERE c.relkind IN ('r', 'p')
+  AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+  AND n.nspname NOT LIKE 'pg_toast%'
+  AND n.nspname NOT LIKE 'pg_temp%'
+ORDER BY n.nspname, c.relname, a.attnum`)
+	if err != nil {
+		return nil, fmt.Errorf("listing tables: %w", err)
+	}
+	defer rows.Close()
+
+	tables := []Table{}
+	for rows.Next() {
+		var schema, table string
+		var selectable bool
+		column := Column{}
+		if err := rows.Scan(&schema, &table, &selectable, &column.Name, &column.DataType, &column.Nullable, &column.PrimaryKey); err != nil {
+			return nil, err
+		}
+
+		if len(tables) == 0 || tables[len(tables)-1].Schema != schema || tables[len(tables)-1].Name != table {
+			tables = append(tables, Table{Schema: schema, Name: table, Selectable: selectable, Columns: []Column{}, PrimaryKey: []string{}})
+		}
+		t := &tables[len(tables)-1]
+		t.Columns = append(t.Columns, column)
+		if column.PrimaryKey {
+			t.PrimaryKey = append(t.PrimaryKey, column.Name)
+		}
+	}
+
+	return tables, rows.Err()
+}
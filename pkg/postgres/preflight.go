@@ -0,0 +1,310 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/navikt/nada-datastream/cmd"
+)
+
+// Check is the result of checking a single prerequisite for streaming from the database.
+type Check struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	// Warning is set for checks that pass, but with something to look into.
+	Warning bool   `json:"warning,omitempty"`
+	Details string `json:"details,omitempty"`
+	// Fix is how to fix the prerequisite when the check fails.
+	Fix string `json:"fix,omitempty"`
+}
+
+// Report is the result of the preflight checks.
+type Report struct {
+	Checks []Check `json:"checks"`
+}
+
+// Passed reports whether every check passed.
+func (r *Report) Passed() bool {
+	for _, c := range r.Checks {
+		if !c.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Report) add(name string, passed bool, details, fix string) {
+	c := Check{Name: name, Passed: passed, Details: details}
+	if !passed {
+		c.Fix = fix
+	}
+	r.Checks = append(r.Checks, c)
+}
+
+func (r *Report) warn(name, details, fix string) {
+	r.Checks = append(r.Checks, Check{Name: name, Passed: true, Warning: true, Details: details, Fix: fix})
+}
+
+// Warnings returns the checks that passed with a warning.
+func (r *Report) Warnings() []Check {
+	warnings := []Check{}
+	for _, c := range r.Checks {
+		if c.Warning {
+			warnings = append(warnings, c)
+		}
+	}
+	return warnings
+}
+
+// Write prints the checks as a table, followed by how to fix the ones that failed.
+func (r *Report) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tSTATUS\tDETAILS")
+	for _, c := range r.Checks {
+		status := "ok"
+		switch {
+		case !c.Passed:
+			status = "FAILED"
+		case c.Warning:
+			status = "warning"
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\n", c.Name, status, c.Details)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, c := range r.Checks {
+		if c.Fix != "" {
+			fmt.Fprintf(w, "\nTo fix %v:\n%v\n", c.Name, c.Fix)
+		}
+	}
+	return nil
+}
+
+// Preflight checks that the database is ready for logical replication of
+// tables to the stream described by cfg.
+func (c *Client) Preflight(ctx context.Context, cfg *cmd.Config, tables []Table) (*Report, error) {
+	report := &Report{}
+
+	checks := []func(context.Context, *Report, *cmd.Config, []Table) error{
+		c.checkLogicalDecoding,
+		c.checkReplicationRoles,
+		c.checkSelectGrants,
+		c.checkPublication,
+		c.checkReplicationSlot,
+		c.checkPrimaryKeys,
+	}
+	for _, check := range checks {
+		if err := check(ctx, report, cfg, tables); err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+func (c *Client) checkLogicalDecoding(ctx context.Context, report *Report, cfg *cmd.Config, tables []Table) error {
+	var walLevel string
+	if err := c.conn.QueryRow(ctx, "SHOW wal_level").Scan(&walLevel); err != nil {
+		return fmt.Errorf("checking wal_level: %w", err)
+	}
+
+	report.add("logical decoding", walLevel == "logical", "wal_level is "+walLevel,
+		`Set the database flag cloudsql.logical_decoding in the nais manifest of the app, which restarts the database:
+  spec:
+    gcp:
+      sqlInstances:
+        - flags:
+            - name: cloudsql.logical_decoding
+              value: "on"`)
+	return nil
+}
+
+func (c *Client) checkReplicationRoles(ctx context.Context, report *Report, cfg *cmd.Config, tables []Table) error {
+	users := []string{cfg.User}
+	if cfg.App != "" && cfg.App != cfg.User {
+		users = append(users, cfg.App)
+	}
+
+	for _, u := range users {
+		var replication bool
+		err := c.conn.QueryRow(ctx, "SELECT rolreplication FROM pg_roles WHERE rolname = $1", u).Scan(&replication)
+		if errors.Is(err, pgx.ErrNoRows) {
+			if u == cfg.User {
+				return fmt.Errorf("user %v does not exist", u)
+			}
+			// the app does not necessarily use a user named after itself
+			report.add("replication role "+u, true, "no user named "+u+", skipped", "")
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("checking replication role of %v: %w", u, err)
+		}
+
+		report.add("replication role "+u, replication, "",
+			fmt.Sprintf("ALTER USER %v WITH REPLICATION;", quote(u)))
+	}
+
+	return nil
+}
+
+func (c *Client) checkSelectGrants(ctx context.Context, report *Report, cfg *cmd.Config, tables []Table) error {
+	missing := []string{}
+	schemas := []string{}
+	for _, t := range tables {
+		if t.Selectable {
+			continue
+		}
+		missing = append(missing, t.FullName())
+		if !contains(schemas, t.Schema) {
+			schemas = append(schemas, t.Schema)
+		}
+	}
+	sort.Strings(schemas)
+
+	fix := []string{}
+	for _, s := range schemas {
+		fix = append(fix,
+			fmt.Sprintf("ALTER DEFAULT PRIVILEGES IN SCHEMA %v GRANT SELECT ON TABLES TO %v;", quote(s), quote(cfg.User)),
+			fmt.Sprintf("GRANT SELECT ON ALL TABLES IN SCHEMA %v TO %v;", quote(s), quote(cfg.User)),
+		)
+	}
+
+	details := fmt.Sprintf("%v of %v tables readable", len(tables)-len(missing), len(tables))
+	if len(missing) > 0 {
+		details += ", not " + strings.Join(missing, ", ")
+	}
+	report.add("select grants", len(missing) == 0, details, strings.Join(fix, "\n"))
+	return nil
+}
+
+func (c *Client) checkPublication(ctx context.Context, report *Report, cfg *cmd.Config, tables []Table) error {
+	name := "publication " + cfg.Publication
+
+	var allTables bool
+	err := c.conn.QueryRow(ctx, "SELECT puballtables FROM pg_publication WHERE pubname = $1", cfg.Publication).Scan(&allTables)
+	if errors.Is(err, pgx.ErrNoRows) {
+		report.add(name, false, "does not exist",
+			fmt.Sprintf("CREATE PUBLICATION %v FOR ALL TABLES;", quote(cfg.Publication)))
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("checking publication %v: %w", cfg.Publication, err)
+	}
+	if allTables {
+		report.add(name, true, "for all tables", "")
+		return nil
+	}
+
+	published, err := c.PublicationTables(ctx, cfg.Publication)
+	if err != nil {
+		return err
+	}
+	missing := []string{}
+	for _, t := range tables {
+		if !contains(published, t.FullName()) {
+			missing = append(missing, t.FullName())
+		}
+	}
+
+	quoted := []string{}
+	for _, t := range tables {
+		if contains(missing, t.FullName()) {
+			quoted = append(quoted, quoteTable(t))
+		}
+	}
+	details := fmt.Sprintf("%v of %v tables published", len(tables)-len(missing), len(tables))
+	if len(missing) > 0 {
+		details += ", not " + strings.Join(missing, ", ")
+	}
+	report.add(name, len(missing) == 0, details,
+		fmt.Sprintf("ALTER PUBLICATION %v ADD TABLE %v;", quote(cfg.Publication), strings.Join(quoted, ", ")))
+	return nil
+}
+
+// PublicationTables returns the tables in the publication, as schema.table.
+func (c *Client) PublicationTables(ctx context.Context, publication string) ([]string, error) {
+	rows, err := c.conn.Query(ctx, "SELECT schemaname, tablename FROM pg_publication_tables WHERE pubname = $1", publication)
+	if err != nil {
+		return nil, fmt.Errorf("listing tables of publication %v: %w", publication, err)
+	}
+	defer rows.Close()
+
+	tables := []string{}
+	for rows.Next() {
+		var schema, table string
+		if err := rows.Scan(&schema, &table); err != nil {
+			return nil, err
+		}
+		tables = append(tables, schema+"."+table)
+	}
+	return tables, rows.Err()
+}
+
+func (c *Client) checkReplicationSlot(ctx context.Context, report *Report, cfg *cmd.Config, tables []Table) error {
+	name := "replication slot " + cfg.ReplicationSlot
+	fix := fmt.Sprintf("SELECT PG_CREATE_LOGICAL_REPLICATION_SLOT(%v, 'pgoutput');", literal(cfg.ReplicationSlot))
+
+	var plugin, slotType, database *string
+	err := c.conn.QueryRow(ctx, "SELECT plugin, slot_type, database FROM pg_replication_slots WHERE slot_name = $1", cfg.ReplicationSlot).Scan(&plugin, &slotType, &database)
+	if errors.Is(err, pgx.ErrNoRows) {
+		report.add(name, false, "does not exist", fix)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("checking replication slot %v: %w", cfg.ReplicationSlot, err)
+	}
+
+	switch {
+	case slotType == nil || *slotType != "logical" || plugin == nil || *plugin != "pgoutput":
+		report.add(name, false, "not a logical slot using pgoutput",
+			fmt.Sprintf("SELECT PG_DROP_REPLICATION_SLOT(%v);\n%v", literal(cfg.ReplicationSlot), fix))
+	case database == nil || *database != cfg.DB:
+		report.add(name, false, "belongs to another database",
+			"Create the slot while connected to database "+cfg.DB+", or use another name with --replication-slot:\n"+fix)
+	default:
+		report.add(name, true, "", "")
+	}
+	return nil
+}
+
+func (c *Client) checkPrimaryKeys(ctx context.Context, report *Report, cfg *cmd.Config, tables []Table) error {
+	missing := []string{}
+	for _, t := range tables {
+		if len(t.PrimaryKey) == 0 {
+			missing = append(missing, t.FullName())
+		}
+	}
+
+	switch {
+	case len(missing) == 0:
+		report.add("primary keys", true, fmt.Sprintf("all %v tables have a primary key", len(tables)), "")
+	case cfg.AppendOnly:
+		report.add("primary keys", true, "datastream is append-only, tables without a primary key: "+strings.Join(missing, ", "), "")
+	default:
+		report.warn("primary keys", "changes to tables without a primary key can't be merged in bigquery: "+strings.Join(missing, ", "),
+			fmt.Sprintf("Add a primary key to the tables, exclude them with --%v=%v, or write the datastream append-only with --%v=%v",
+				cmd.TablesWithoutPrimaryKey, cmd.WithoutPrimaryKeyExclude, cmd.TablesWithoutPrimaryKey, cmd.WithoutPrimaryKeyAppendOnly))
+	}
+	return nil
+}
+
+func quote(identifier string) string {
+	return pgx.Identifier{identifier}.Sanitize()
+}
+
+func contains(vals []string, val string) bool {
+	for _, v := range vals {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/navikt/nada-datastream/cmd"
+)
+
+// Migration is the SQL that prepares the database for datastream. Every
+// statement is idempotent, so the migration can be run again when the
+// selection of tables changes. The replication slot can't be created in a
+// transaction that has performed writes, so it is kept apart from the rest.
+type Migration struct {
+	// Setup are the statements granting access and creating the publication, as PL/pgSQL.
+	Setup []string
+	// Slot is the statement creating the replication slot, as PL/pgSQL.
+	Slot string
+
+	user string
+}
+
+// NewMigration returns the migration for the stream described by cfg. The
+// database user of cfg and owner are given the replication role, and the
+// database user of cfg is granted select on every table in schemas and on
+// tables. The publication is created for all tables unless cfg includes
+// tables, in which case it is created for tables only.
+func NewMigration(cfg *cmd.Config, owner string, schemas []string, tables []Table) (*Migration, error) {
+	if len(cfg.IncludeTables) > 0 && len(tables) == 0 {
+		return nil, fmt.Errorf("no tables selected for publication %v", cfg.Publication)
+	}
+
+	user := quote(cfg.User)
+	setup := []string{}
+	for _, u := range []string{owner, cfg.User} {
+		setup = append(setup, fmt.Sprintf("ALTER USER %v WITH REPLICATION;", quote(u)))
+	}
+
+	sort.Strings(schemas)
+	for _, s := range schemas {
+		setup = append(setup,
+			fmt.Sprintf("GRANT USAGE ON SCHEMA %v TO %v;", quote(s), user),
+			fmt.Sprintf("ALTER DEFAULT PRIVILEGES IN SCHEMA %v GRANT SELECT ON TABLES TO %v;", quote(s), user),
+			fmt.Sprintf("GRANT SELECT ON ALL TABLES IN SCHEMA %v TO %v;", quote(s), user),
+		)
+	}
+	granted := []string{}
+	grantedSchemas := []string{}
+	for _, t := range tables {
+		if contains(schemas, t.Schema) {
+			continue
+		}
+		if !contains(grantedSchemas, t.Schema) {
+			grantedSchemas = append(grantedSchemas, t.Schema)
+			setup = append(setup, fmt.Sprintf("GRANT USAGE ON SCHEMA %v TO %v;", quote(t.Schema), user))
+		}
+		granted = append(granted, quoteTable(t))
+	}
+	if len(granted) > 0 {
+		setup = append(setup, fmt.Sprintf("GRANT SELECT ON %v TO %v;", strings.Join(granted, ", "), user))
+	}
+
+	publication := quote(cfg.Publication)
+	existsPublication := fmt.Sprintf("SELECT 1 FROM pg_publication WHERE pubname = %v", literal(cfg.Publication))
+	if len(cfg.IncludeTables) == 0 {
+		setup = append(setup, fmt.Sprintf("IF NOT EXISTS (%v) THEN\n    CREATE PUBLICATION %v FOR ALL TABLES;\nEND IF;", existsPublication, publication))
+	} else {
+		published := []string{}
+		for _, t := range tables {
+			published = append(published, quoteTable(t))
+		}
+		setup = append(setup, fmt.Sprintf("IF NOT EXISTS (%v) THEN\n    CREATE PUBLICATION %v FOR TABLE %v;\nEND IF;", existsPublication, publication, strings.Join(published, ", ")))
+		// the publication may exist from before with other tables
+		for _, t := range tables {
+			setup = append(setup, fmt.Sprintf("IF NOT EXISTS (SELECT 1 FROM pg_publication_tables WHERE pubname = %v AND schemaname = %v AND tablename = %v) THEN\n    ALTER PUBLICATION %v ADD TABLE %v;\nEND IF;",
+				literal(cfg.Publication), literal(t.Schema), literal(t.Name), publication, quoteTable(t)))
+		}
+	}
+
+	slot := fmt.Sprintf("IF NOT EXISTS (SELECT 1 FROM pg_replication_slots WHERE slot_name = %v) THEN\n    PERFORM PG_CREATE_LOGICAL_REPLICATION_SLOT(%v, 'pgoutput');\nEND IF;",
+		literal(cfg.ReplicationSlot), literal(cfg.ReplicationSlot))
+
+	return &Migration{Setup: setup, Slot: slot, user: cfg.User}, nil
+}
+
+// WriteSQL prints the migration as a plain SQL script.
+func (m *Migration) WriteSQL(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "-- Grants access and creates the publication for datastream\n%v\n-- The replication slot must be created in a transaction of its own\n%v",
+		doBlock(m.Setup), doBlock([]string{m.Slot}))
+	return err
+}
+
+// WriteFlyway writes the migration to dir as two Flyway migrations, since
+// Flyway runs each migration in a transaction of its own. The statements only
+// run in databases where the database user exists, so the migrations can be
+// run in every environment. It returns the paths of the files written.
+func (m *Migration) WriteFlyway(dir, version string) ([]string, error) {
+	files := []struct {
+		name       string
+		statements []string
+	}{
+		{name: fmt.Sprintf("V%v__datastream.sql", version), statements: m.Setup},
+		{name: fmt.Sprintf("V%v.1__datastream_replication_slot.sql", version), statements: []string{m.Slot}},
+	}
+
+	for _, f := range files {
+		if _, err := os.Stat(filepath.Join(dir, f.name)); err == nil {
+			return nil, fmt.Errorf("migration %v already exists", filepath.Join(dir, f.name))
+		}
+	}
+
+	paths := []string{}
+	for _, f := range files {
+		guarded := fmt.Sprintf("IF EXISTS (SELECT * FROM pg_roles WHERE rolname = %v) THEN\n%v\nEND IF;", literal(m.user), indent(strings.Join(f.statements, "\n")))
+		path := filepath.Join(dir, f.name)
+		if err := os.WriteFile(path, []byte(doBlock([]string{guarded})), 0o644); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+// Migrate runs the migration against the database.
+func (c *Client) Migrate(ctx context.Context, m *Migration) error {
+	if _, err := c.conn.Exec(ctx, doBlock(m.Setup)); err != nil {
+		return fmt.Errorf("granting access and creating the publication: %w", err)
+	}
+	if _, err := c.conn.Exec(ctx, doBlock([]string{m.Slot})); err != nil {
+		return fmt.Errorf("creating the replication slot: %w", err)
+	}
+	return nil
+}
+
+// doBlock returns the PL/pgSQL statements as an anonymous code block.
+func doBlock(statements []string) string {
+	return fmt.Sprintf("DO\n$$\n    BEGIN\n%v\n    END\n$$ LANGUAGE 'plpgsql';\n", indent(indent(strings.Join(statements, "\n"))))
+}
+
+func indent(s string) string {
+	return "    " + strings.ReplaceAll(s, "\n", "\n    ")
+}
+
+func quoteTable(t Table) string {
+	return quote(t.Schema) + "." + quote(t.Name)
+}
+
+// literal returns s as a string literal.
+func literal(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,160 @@
+package postgres
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/navikt/nada-datastream/cmd"
+)
+
+func TestNewMigration(t *testing.T) {
+	users := Table{Schema: "public", Name: "users"}
+	auditLog := Table{Schema: "audit", Name: "log"}
+
+	for _, tc := range []struct {
+		name     string
+		included []string
+		schemas  []string
+		tables   []Table
+		// setup are statements, or the start of them, the setup has to
+		// contain, and notSetup the ones it must not contain
+		setup    []string
+		notSetup []string
+		err      string
+	}{
+		{
+			name:    "all tables",
+			schemas: []string{"public", "audit"},
+			setup: []string{
+				`ALTER USER "app" WITH REPLICATION;`,
+				`ALTER USER "datastream" WITH REPLICATION;`,
+				`GRANT USAGE ON SCHEMA "audit" TO "datastream";`,
+				`ALTER DEFAULT PRIVILEGES IN SCHEMA "public" GRANT SELECT ON TABLES TO "datastream";`,
+				`GRANT SELECT ON ALL TABLES IN SCHEMA "public" TO "datastream";`,
+				"IF NOT EXISTS (SELECT 1 FROM pg_publication WHERE pubname = 'ds_publication') THEN\n    CREATE PUBLICATION \"ds_publication\" FOR ALL TABLES;",
+			},
+			notSetup: []string{"GRANT SELECT ON \"", "ADD TABLE"},
+		},
+		{
+			name:     "included tables",
+			included: []string{"users", "audit.log"},
+			tables:   []Table{users, auditLog},
+			setup: []string{
+				`GRANT USAGE ON SCHEMA "public" TO "datastream";`,
+				`GRANT USAGE ON SCHEMA "audit" TO "datastream";`,
+				`GRANT SELECT ON "public"."users", "audit"."log" TO "datastream";`,
+				`CREATE PUBLICATION "ds_publication" FOR TABLE "public"."users", "audit"."log";`,
+				"tablename = 'log') THEN\n    ALTER PUBLICATION \"ds_publication\" ADD TABLE \"audit\".\"log\";",
+			},
+			notSetup: []string{"ALL TABLES", "DEFAULT PRIVILEGES"},
+		},
+		{
+			name:     "included tables in granted schema",
+			included: []string{"users", "audit.*"},
+			schemas:  []string{"audit"},
+			tables:   []Table{users, auditLog},
+			setup: []string{
+				`GRANT SELECT ON ALL TABLES IN SCHEMA "audit" TO "datastream";`,
+				`GRANT SELECT ON "public"."users" TO "datastream";`,
+				`CREATE PUBLICATION "ds_publication" FOR TABLE "public"."users", "audit"."log";`,
+			},
+			notSetup: []string{`"audit"."log" TO`},
+		},
+		{
+			name:     "no tables selected",
+			included: []string{"audit.*"},
+			err:      "no tables selected for publication ds_publication",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &cmd.Config{
+				DBConfig:        &cmd.DBConfig{User: "datastream"},
+				IncludeTables:   tc.included,
+				Publication:     cmd.DefaultPublication,
+				ReplicationSlot: "ds_replication",
+			}
+
+			m, err := NewMigration(cfg, "app", tc.schemas, tc.tables)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("got error %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewMigration: %v", err)
+			}
+
+			setup := strings.Join(m.Setup, "\n")
+			for _, s := range tc.setup {
+				if !strings.Contains(setup, s) {
+					t.Errorf("setup does not contain %q:\n%v", s, setup)
+				}
+			}
+			for _, s := range tc.notSetup {
+				if strings.Contains(setup, s) {
+					t.Errorf("setup contains %q:\n%v", s, setup)
+				}
+			}
+			if !strings.Contains(m.Slot, "PG_CREATE_LOGICAL_REPLICATION_SLOT('ds_replication', 'pgoutput')") {
+				t.Errorf("slot does not create ds_replication:\n%v", m.Slot)
+			}
+		})
+	}
+}
+
+func TestNewMigrationQuotes(t *testing.T) {
+	cfg := &cmd.Config{
+		DBConfig:        &cmd.DBConfig{User: `data"stream`},
+		Publication:     "it's",
+		ReplicationSlot: "ds_replication",
+	}
+
+	m, err := NewMigration(cfg, "app", []string{"public"}, nil)
+	if err != nil {
+		t.Fatalf("NewMigration: %v", err)
+	}
+
+	setup := strings.Join(m.Setup, "\n")
+	for _, s := range []string{`TO "data""stream";`, `pubname = 'it''s'`, `CREATE PUBLICATION "it's"`} {
+		if !strings.Contains(setup, s) {
+			t.Errorf("setup does not contain %q:\n%v", s, setup)
+		}
+	}
+}
+
+func TestWriteFlyway(t *testing.T) {
+	dir := t.TempDir()
+	m := &Migration{Setup: []string{"GRANT 1;", "GRANT 2;"}, Slot: "SLOT;", user: "datastream"}
+
+	paths, err := m.WriteFlyway(dir, "42")
+	if err != nil {
+		t.Fatalf("WriteFlyway: %v", err)
+	}
+
+	want := []string{filepath.Join(dir, "V42__datastream.sql"), filepath.Join(dir, "V42.1__datastream_replication_slot.sql")}
+	if strings.Join(paths, ",") != strings.Join(want, ",") {
+		t.Fatalf("got paths %v, want %v", paths, want)
+	}
+	for i, statements := range [][]string{m.Setup, {m.Slot}} {
+		bytes, err := os.ReadFile(paths[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		content := string(bytes)
+		if !strings.HasPrefix(content, "DO\n$$") || !strings.Contains(content, "IF EXISTS (SELECT * FROM pg_roles WHERE rolname = 'datastream') THEN") {
+			t.Errorf("%v is not a block guarded by the user:\n%v", paths[i], content)
+		}
+		for _, s := range statements {
+			if !strings.Contains(content, s) {
+				t.Errorf("%v does not contain %q:\n%v", paths[i], s, content)
+			}
+		}
+	}
+
+	if _, err := m.WriteFlyway(dir, "42"); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("writing existing migrations returned %v, want them to already exist", err)
+	}
+}
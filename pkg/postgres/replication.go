@@ -0,0 +1,56 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DropReplication drops the replication slot and the publication, and returns
+// what was dropped. It refuses to drop anything while the slot is in use.
+func (c *Client) DropReplication(ctx context.Context, publication, slot string) ([]string, error) {
+	dropped := []string{}
+
+	var active bool
+	var pid *int32
+	err := c.conn.QueryRow(ctx, "SELECT active, active_pid FROM pg_replication_slots WHERE slot_name = $1", slot).Scan(&active, &pid)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+	case err != nil:
+		return nil, fmt.Errorf("checking replication slot %v: %w", slot, err)
+	case active:
+		holder := ""
+		if pid != nil {
+			holder = fmt.Sprintf(" by process %v", *pid)
+		}
+		return nil, fmt.Errorf("replication slot %v is still in use%v, drop it and the publication when nothing reads from it:\nSELECT PG_DROP_REPLICATION_SLOT(%v);\nDROP PUBLICATION %v;",
+			slot, holder, literal(slot), quote(publication))
+	default:
+		if _, err := c.conn.Exec(ctx, "SELECT pg_drop_replication_slot($1)", slot); err != nil {
+			return nil, fmt.Errorf("dropping replication slot %v: %w", slot, err)
+		}
+		dropped = append(dropped, "replication slot "+slot)
+	}
+
+	var exists bool
+	if err := c.conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_publication WHERE pubname = $1)", publication).Scan(&exists); err != nil {
+		return dropped, fmt.Errorf("checking publication %v: %w", publication, err)
+	}
+	if exists {
+		if _, err := c.conn.Exec(ctx, "DROP PUBLICATION "+quote(publication)); err != nil {
+			return dropped, fmt.Errorf("dropping publication %v: %w", publication, err)
+		}
+		dropped = append(dropped, "publication "+publication)
+	}
+
+	return dropped, nil
+}
+
+// DropReplicationSQL returns the statements dropping the replication slot, the
+// publication and the heartbeat table of the slot, for running them manually.
+func DropReplicationSQL(publication, slot string) string {
+	return fmt.Sprintf("SELECT PG_DROP_REPLICATION_SLOT(%v);\nDROP PUBLICATION IF EXISTS %v;\nDROP TABLE IF EXISTS %v;",
+		literal(slot), quote(publication), quoteTable(Table{Schema: heartbeatSchema, Name: HeartbeatTable(slot)}))
+}
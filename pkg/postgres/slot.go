@@ -0,0 +1,67 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SlotStatus is how far a replication slot is behind the database.
+type SlotStatus struct {
+	Name   string `json:"name"`
+	Active bool   `json:"active"`
+	// ConfirmedFlushLSN is the position the consumer of the slot has confirmed it has received.
+	ConfirmedFlushLSN string `json:"confirmedFlushLsn"`
+	CurrentLSN        string `json:"currentLsn"`
+	// LagBytes is how far the confirmed position of the slot is behind the current position.
+	LagBytes int64 `json:"lagBytes"`
+	// RetainedWALBytes is how much WAL the database keeps for the slot.
+	RetainedWALBytes int64 `json:"retainedWalBytes"`
+}
+
+// Write prints the status as a table.
+func (s *SlotStatus) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SLOT\tACTIVE\tCONFIRMED FLUSH LSN\tCURRENT LSN\tLAG\tRETAINED WAL")
+	fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\n", s.Name, s.Active, s.ConfirmedFlushLSN, s.CurrentLSN, FormatBytes(s.LagBytes), FormatBytes(s.RetainedWALBytes))
+	return tw.Flush()
+}
+
+// SlotStatus returns the status of the replication slot.
+func (c *Client) SlotStatus(ctx context.Context, slot string) (*SlotStatus, error) {
+	status := &SlotStatus{Name: slot}
+	err := c.conn.QueryRow(ctx, `
+SELECT active,
+       COALESCE(confirmed_flush_lsn::text, ''),
+       pg_current_wal_lsn()::text,
+       COALESCE(pg_wal_lsn_diff(pg_current_wal_lsn(), confirmed_flush_lsn), 0)::bigint,
+       COALESCE(pg_wal_lsn_diff(pg_current_wal_lsn(), restart_lsn), 0)::bigint
+FROM pg_replication_slots
+WHERE slot_name = $1`, slot).Scan(&status.Active, &status.ConfirmedFlushLSN, &status.CurrentLSN, &status.LagBytes, &status.RetainedWALBytes)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("replication slot %v does not exist", slot)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting status of replication slot %v: %w", slot, err)
+	}
+
+	return status, nil
+}
+
+// FormatBytes returns the number of bytes in the largest unit it is at least one of.
+func FormatBytes(bytes int64) string {
+	units := []string{"B", "kB", "MB", "GB", "TB"}
+	value := float64(bytes)
+	i := 0
+	for ; value >= 1024 && i < len(units)-1; i++ {
+		value /= 1024
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d %v", bytes, units[i])
+	}
+	return fmt.Sprintf("%.1f %v", value, units[i])
+}
@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestFormatBytes(t *testing.T) {
+	for _, tc := range []struct {
+		bytes int64
+		want  string
+	}{
+		{bytes: 0, want: "0 B"},
+		{bytes: 1023, want: "1023 B"},
+		{bytes: 1024, want: "1.0 kB"},
+		{bytes: 1536, want: "1.5 kB"},
+		{bytes: 512 << 20, want: "512.0 MB"},
+		{bytes: 10 << 30, want: "10.0 GB"},
+		{bytes: 2048 << 40, want: "2048.0 TB"},
+	} {
+		if got := FormatBytes(tc.bytes); got != tc.want {
+			t.Errorf("FormatBytes(%v) = %q, want %q", tc.bytes, got, tc.want)
+		}
+	}
+}
+
+func TestSlotStatusWrite(t *testing.T) {
+	status := &SlotStatus{Name: "ds_replication", Active: true, ConfirmedFlushLSN: "0/16B3748", CurrentLSN: "0/16B3780", LagBytes: 56, RetainedWALBytes: 3 << 20}
+
+	out := &strings.Builder{}
+	if err := status.Write(out); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %v lines, want a header and the slot:\n%v", len(lines), out)
+	}
+	if got, want := strings.Join(strings.Fields(lines[1]), " "), "ds_replication true 0/16B3748 0/16B3780 56 B 3.0 MB"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSlotStatus(t *testing.T) {
+	conn, cfg := testDatabase(t)
+	if !logicalDecoding(t, conn) {
+		t.Skip("the database does not allow logical decoding, start it with wal_level=logical")
+	}
+	exec(t, conn, "SELECT pg_create_logical_replication_slot($1, 'pgoutput')", cfg.ReplicationSlot)
+
+	ctx := context.Background()
+	client := &Client{conn: conn}
+
+	status, err := client.SlotStatus(ctx, cfg.ReplicationSlot)
+	if err != nil {
+		t.Fatalf("SlotStatus: %v", err)
+	}
+	if status.Active || status.CurrentLSN == "" || status.LagBytes < 0 || status.RetainedWALBytes < 0 {
+		t.Errorf("got status %+v, want an inactive slot", status)
+	}
+
+	if _, err := client.SlotStatus(ctx, "missing"); err == nil || !strings.Contains(err.Error(), "replication slot missing does not exist") {
+		t.Errorf("got error %v for a missing slot, want it not to exist", err)
+	}
+}